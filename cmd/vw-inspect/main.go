@@ -0,0 +1,300 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command vw-inspect shows what the virtual workspace provider sees behind an
+// APIExport virtual workspace, without deploying a controller. It reads the
+// virtual workspace through the same wildcard cache as the provider and takes
+// the same engagement decisions.
+//
+// Usage:
+//
+//	vw-inspect [flags] clusters          # logical clusters the provider engages
+//	vw-inspect [flags] engagement        # engagement decisions for all logical clusters
+//	vw-inspect [flags] objects RESOURCE  # objects of a resource per logical cluster
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kcp-dev/logicalcluster/v3"
+	"github.com/spf13/pflag"
+
+	"github.com/kcp-dev/multicluster-provider/virtualworkspace"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
+)
+
+type options struct {
+	kubeconfig          string
+	server              string
+	engagementResources []string
+	engagementPolicy    string
+	engagementFilter    string
+	cluster             string
+	timeout             time.Duration
+}
+
+func main() {
+	log.SetLogger(zap.New(zap.WriteTo(os.Stderr)))
+
+	if err := run(signals.SetupSignalHandler(), os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, out io.Writer) error {
+	opts := options{}
+	flags := pflag.NewFlagSet("vw-inspect", pflag.ContinueOnError)
+	flags.StringVar(&opts.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file. Defaults to the usual kubeconfig loading rules.")
+	flags.StringVar(&opts.server, "server", "", "URL of the APIExport virtual workspace, overriding the server of the kubeconfig.")
+	flags.StringSliceVar(&opts.engagementResources, "engagement-resources", []string{"apibindings.apis.kcp.io"}, "Resources whose objects decide whether a logical cluster is engaged, as resource.group.")
+	flags.StringVar(&opts.engagementPolicy, "engagement-policy", string(virtualworkspace.EngageOnAny), "Engagement policy, Any or All.")
+	flags.StringVar(&opts.engagementFilter, "engagement-filter", "", "Engagement filter, LogicalClusterReady or APIBindingBound. It only applies to engagement resources of its kind. Defaults to none.")
+	flags.StringVar(&opts.cluster, "cluster", "", "Only show objects of this logical cluster.")
+	flags.DurationVar(&opts.timeout, "timeout", 5*time.Minute, "Time to wait for the initial list of the virtual workspace.")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: vw-inspect [flags] clusters|engagement|objects RESOURCE\n\nFlags:\n%s", flags.FlagUsages())
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("no command given")
+	}
+	command, commandArgs := flags.Arg(0), flags.Args()[1:]
+
+	filter, err := engagementFilter(opts.engagementFilter)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(opts)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+
+	// discovery goes against the wildcard endpoint, like in the wildcard cache.
+	wildcardCfg := rest.CopyConfig(cfg)
+	wildcardCfg.Host = strings.TrimSuffix(cfg.Host, "/") + "/clusters/*"
+	httpClient, err := rest.HTTPClientFor(wildcardCfg)
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP client: %w", err)
+	}
+	mapper, err := apiutil.NewDynamicRESTMapper(wildcardCfg, httpClient)
+	if err != nil {
+		return fmt.Errorf("failed to create REST mapper: %w", err)
+	}
+
+	wc, err := virtualworkspace.NewWildcardCache(cfg, cache.Options{HTTPClient: httpClient, Mapper: mapper})
+	if err != nil {
+		return fmt.Errorf("failed to create wildcard cache: %w", err)
+	}
+	go func() {
+		if err := wc.Start(ctx); err != nil {
+			log.FromContext(ctx).Error(err, "wildcard cache stopped")
+		}
+	}()
+
+	switch command {
+	case "clusters", "engagement":
+		if len(commandArgs) != 0 {
+			return fmt.Errorf("%s takes no arguments", command)
+		}
+		objs := make([]client.Object, 0, len(opts.engagementResources))
+		for _, resource := range opts.engagementResources {
+			obj, err := objectFor(mapper, resource)
+			if err != nil {
+				return err
+			}
+			objs = append(objs, obj)
+		}
+		if len(objs) == 0 {
+			return errors.New("at least one engagement resource is required")
+		}
+
+		provider, err := virtualworkspace.New(cfg, objs[0], virtualworkspace.Options{
+			WildcardCache:     wc,
+			EngagementObjects: objs[1:],
+			EngagementPolicy:  virtualworkspace.EngagementPolicy(opts.engagementPolicy),
+			EngagementFilter:  filter,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create provider: %w", err)
+		}
+		decisions, err := provider.EngagementDecisions(ctx)
+		if err != nil {
+			return err
+		}
+
+		if command == "clusters" {
+			return printClusters(out, decisions)
+		}
+		kinds := make([]string, 0, len(objs))
+		for _, obj := range objs {
+			kinds = append(kinds, obj.GetObjectKind().GroupVersionKind().Kind)
+		}
+		return printEngagement(out, decisions, kinds)
+
+	case "objects":
+		if len(commandArgs) != 1 {
+			return errors.New("objects takes exactly one resource")
+		}
+		obj, err := objectFor(mapper, commandArgs[0])
+		if err != nil {
+			return err
+		}
+		inf, err := wc.GetInformer(ctx, obj)
+		if err != nil {
+			return fmt.Errorf("failed to list %s: %w", commandArgs[0], err)
+		}
+		shInf, ok := inf.(toolscache.SharedIndexInformer)
+		if !ok {
+			return fmt.Errorf("unexpected informer type %T", inf)
+		}
+		return printObjects(out, shInf.GetIndexer().List(), logicalcluster.Name(opts.cluster))
+
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+// loadConfig returns the rest.Config of the kubeconfig, pointed at the
+// virtual workspace if a server is given.
+func loadConfig(opts options) (*rest.Config, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = opts.kubeconfig
+	overrides := &clientcmd.ConfigOverrides{}
+	if opts.server != "" {
+		overrides.ClusterInfo.Server = opts.server
+	}
+	cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	return cfg, nil
+}
+
+// engagementFilter returns the engagement filter of the given name.
+func engagementFilter(name string) (func(client.Object) bool, error) {
+	switch name {
+	case "":
+		return nil, nil
+	case "LogicalClusterReady":
+		return virtualworkspace.LogicalClusterReady, nil
+	case "APIBindingBound":
+		return virtualworkspace.APIBindingBound, nil
+	}
+	return nil, fmt.Errorf("unknown engagement filter %q", name)
+}
+
+// objectFor returns an unstructured object of the given resource.group, as
+// served by the virtual workspace.
+func objectFor(mapper meta.RESTMapper, resource string) (*unstructured.Unstructured, error) {
+	gvk, err := mapper.KindFor(schema.ParseGroupResource(resource).WithVersion(""))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find resource %q: %w", resource, err)
+	}
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	return obj, nil
+}
+
+func printClusters(out io.Writer, decisions []virtualworkspace.EngagementDecision) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "CLUSTER\tPATH")
+	for _, decision := range decisions {
+		if decision.Engage {
+			fmt.Fprintf(w, "%s\t%s\n", decision.Cluster, orNone(decision.Path.String()))
+		}
+	}
+	return w.Flush()
+}
+
+func printEngagement(out io.Writer, decisions []virtualworkspace.EngagementDecision, kinds []string) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	header := []string{"CLUSTER", "PATH", "ENGAGE"}
+	for _, kind := range kinds {
+		header = append(header, strings.ToUpper(kind)+"S")
+	}
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, decision := range decisions {
+		row := []string{decision.Cluster.String(), orNone(decision.Path.String()), strconv.FormatBool(decision.Engage)}
+		for _, kind := range kinds {
+			row = append(row, strconv.Itoa(decision.Objects[kind]))
+		}
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+func printObjects(out io.Writer, items []any, clusterName logicalcluster.Name) error {
+	objs := make([]client.Object, 0, len(items))
+	for _, item := range items {
+		obj, ok := item.(client.Object)
+		if !ok {
+			continue
+		}
+		if clusterName.Empty() || logicalcluster.From(obj) == clusterName {
+			objs = append(objs, obj)
+		}
+	}
+	slices.SortFunc(objs, func(a, b client.Object) int {
+		return strings.Compare(
+			logicalcluster.From(a).String()+"/"+a.GetNamespace()+"/"+a.GetName(),
+			logicalcluster.From(b).String()+"/"+b.GetNamespace()+"/"+b.GetName(),
+		)
+	})
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "CLUSTER\tNAMESPACE\tNAME")
+	for _, obj := range objs {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", logicalcluster.From(obj), orNone(obj.GetNamespace()), obj.GetName())
+	}
+	return w.Flush()
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
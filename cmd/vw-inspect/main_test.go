@@ -0,0 +1,122 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kcp-dev/logicalcluster/v3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kcp-dev/multicluster-provider/virtualworkspace/fakeserver"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+
+	srv := fakeserver.New(nil)
+	defer srv.Close()
+	create := func(clusterName logicalcluster.Name, obj client.Object) {
+		cli, err := client.New(srv.ClusterConfig(clusterName), client.Options{})
+		require.NoError(t, err)
+		require.NoError(t, cli.Create(ctx, obj))
+	}
+	create("foo", &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "a"}})
+	create("foo", &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "a"}})
+	create("bar", &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "b"}})
+
+	// the kubeconfig points elsewhere, the virtual workspace is given by flag.
+	kubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+	require.NoError(t, clientcmd.WriteToFile(clientcmdapi.Config{
+		Clusters:       map[string]*clientcmdapi.Cluster{"kcp": {Server: "https://kcp.invalid"}},
+		AuthInfos:      map[string]*clientcmdapi.AuthInfo{"admin": {}},
+		Contexts:       map[string]*clientcmdapi.Context{"kcp": {Cluster: "kcp", AuthInfo: "admin"}},
+		CurrentContext: "kcp",
+	}, kubeconfig))
+	flags := []string{"--kubeconfig", kubeconfig, "--server", srv.URL}
+
+	tests := map[string]struct {
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		"clusters": {
+			args: []string{"--engagement-resources", "configmaps,secrets", "--engagement-policy", "All", "clusters"},
+			want: `
+CLUSTER  PATH
+foo      <none>
+`,
+		},
+		"engagement": {
+			args: []string{"--engagement-resources", "configmaps,secrets", "--engagement-policy", "All", "engagement"},
+			want: `
+CLUSTER  PATH    ENGAGE  CONFIGMAPS  SECRETS
+bar      <none>  false   1           0
+foo      <none>  true    1           1
+`,
+		},
+		"objects": {
+			args: []string{"objects", "configmaps"},
+			want: `
+CLUSTER  NAMESPACE  NAME
+bar      default    b
+foo      default    a
+`,
+		},
+		"objects of one cluster": {
+			args: []string{"--cluster", "foo", "objects", "configmaps"},
+			want: `
+CLUSTER  NAMESPACE  NAME
+foo      default    a
+`,
+		},
+		"unknown resource": {
+			args:    []string{"objects", "widgets"},
+			wantErr: true,
+		},
+		"unknown filter": {
+			args:    []string{"--engagement-filter", "Some", "clusters"},
+			wantErr: true,
+		},
+		"unknown command": {
+			args:    []string{"sync"},
+			wantErr: true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := run(ctx, append(flags, tt.args...), &out)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, strings.TrimPrefix(tt.want, "\n"), out.String())
+		})
+	}
+}
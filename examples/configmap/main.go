@@ -19,7 +19,6 @@ package main
 import (
 	"context"
 	"fmt"
-	"net/http"
 	"os"
 
 	"github.com/spf13/pflag"
@@ -86,20 +85,17 @@ func main() {
 		os.Exit(1)
 	}
 
-	provider.
-		cfg.WrapTransport = func(rt http.RoundTripper) http.RoundTripper {
-		return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
-			fmt.Println(r.URL)
-			return rt.RoundTrip(r)
-		})
-	}
-
 	mgr, err := mcmanager.New(cfg, provider, opts)
 	if err != nil {
 		entryLog.Error(err, "unable to set up overall controller manager")
 		os.Exit(1)
 	}
 
+	if err := provider.SetupWithManager(mgr); err != nil {
+		entryLog.Error(err, "unable to add provider to manager")
+		os.Exit(1)
+	}
+
 	if err := mcbuilder.ControllerManagedBy(mgr).
 		Named("kcp-configmap-controller").
 		For(&corev1.ConfigMap{}).
@@ -132,25 +128,9 @@ func main() {
 		os.Exit(1)
 	}
 
-	if provider != nil {
-		entryLog.Info("Starting provider")
-		go func() {
-			if err := provider.Run(ctx, mgr); err != nil {
-				entryLog.Error(err, "unable to run provider")
-				os.Exit(1)
-			}
-		}()
-	}
-
 	entryLog.Info("Starting manager")
 	if err := mgr.Start(ctx); err != nil {
 		entryLog.Error(err, "unable to run manager")
 		os.Exit(1)
 	}
 }
-
-type RoundTripperFunc func(*http.Request) (*http.Response, error)
-
-func (f RoundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
-	return f(r)
-}
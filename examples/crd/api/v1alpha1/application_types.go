@@ -19,6 +19,7 @@ package v1alpha1
 import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -37,8 +38,36 @@ type ApplicationSpec struct {
 type ApplicationStatus struct {
 	Status           string `json:"status,omitempty"`
 	ConnectionString string `json:"connectionString,omitempty"`
+
+	// ObservedGeneration is the generation of the Application that the
+	// status was computed for.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions describe the state of the Application. The Ready condition
+	// reflects the availability of its Deployment in the host cluster.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
+const (
+	// ApplicationConditionReady is the condition type telling whether the
+	// Deployment of the Application is available in the host cluster.
+	ApplicationConditionReady = "Ready"
+
+	// ApplicationReasonAvailable is the reason of the Ready condition when
+	// the Deployment is available.
+	ApplicationReasonAvailable = "DeploymentAvailable"
+	// ApplicationReasonProgressing is the reason of the Ready condition while
+	// the Deployment rolls out its latest generation.
+	ApplicationReasonProgressing = "DeploymentProgressing"
+	// ApplicationReasonUnavailable is the reason of the Ready condition when
+	// the Deployment is rolled out but not available.
+	ApplicationReasonUnavailable = "DeploymentUnavailable"
+)
+
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 
@@ -51,6 +80,19 @@ type Application struct {
 	Status ApplicationStatus `json:"status,omitempty"`
 }
 
+// DatabaseSecretKey returns the key of the database secret of the
+// Application in its workspace. The secret defaults to the namespace of the
+// Application. The webhook and the controller both resolve it with this
+// method, so that they agree on the secret.
+func (a *Application) DatabaseSecretKey() types.NamespacedName {
+	ref := a.Spec.DatabaseSecretRef
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = a.Namespace
+	}
+	return types.NamespacedName{Namespace: namespace, Name: ref.Name}
+}
+
 // +kubebuilder:object:root=true
 
 // ApplicationList contains a list of Application.
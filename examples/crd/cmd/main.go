@@ -33,15 +33,17 @@ import (
 
 	apisv1alpha1 "github.com/kcp-dev/kcp/sdk/apis/apis/v1alpha1"
 	"github.com/kcp-dev/multicluster-provider/virtualworkspace"
+	"github.com/kcp-dev/multicluster-provider/virtualworkspace/hostmapping"
 	mcbuilder "github.com/multicluster-runtime/multicluster-runtime/pkg/builder"
 	mcmanager "github.com/multicluster-runtime/multicluster-runtime/pkg/manager"
 	mcreconcile "github.com/multicluster-runtime/multicluster-runtime/pkg/reconcile"
 
+	appsv1 "k8s.io/api/apps/v1"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
-	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
@@ -53,6 +55,7 @@ import (
 
 	applicationapisv1alpha1 "github.com/kcp-dev/multicluster-provider/examples/crd/api/v1alpha1"
 	"github.com/kcp-dev/multicluster-provider/examples/crd/internal/controller"
+	webhookapisv1alpha1 "github.com/kcp-dev/multicluster-provider/examples/crd/internal/webhook/v1alpha1"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -209,15 +212,6 @@ func main() {
 		cfg.Host = server
 	}
 
-	var err error
-	provider, err := virtualworkspace.New(cfg, &apisv1alpha1.APIBinding{}, virtualworkspace.Options{
-		Scheme: clientgoscheme.Scheme,
-	})
-	if err != nil {
-		setupLog.Error(err, "unable to construct cluster provider")
-		os.Exit(1)
-	}
-
 	providerKubeConfig = filepath.Clean(providerKubeConfig)
 	if _, err := os.Stat(providerKubeConfig); err != nil {
 		setupLog.Error(err, "unable to find provider kubeconfig")
@@ -229,11 +223,22 @@ func main() {
 		os.Exit(1)
 	}
 
-	providerClusterDynamicClient, err := client.New(config, client.Options{
-		Scheme: clientgoscheme.Scheme,
+	// MULTICLUSTER: The provider cluster running the workloads is served as
+	// host cluster next to the kcp workspaces.
+	hostCluster, err := cluster.New(config, func(o *cluster.Options) {
+		o.Scheme = clientgoscheme.Scheme
+	})
+	if err != nil {
+		setupLog.Error(err, "unable to create host cluster")
+		os.Exit(1)
+	}
+
+	provider, err := virtualworkspace.New(cfg, &apisv1alpha1.APIBinding{}, virtualworkspace.Options{
+		Scheme:      clientgoscheme.Scheme,
+		HostCluster: hostCluster,
 	})
 	if err != nil {
-		setupLog.Error(err, "unable to create dynamic client")
+		setupLog.Error(err, "unable to construct cluster provider")
 		os.Exit(1)
 	}
 
@@ -261,9 +266,42 @@ func main() {
 		os.Exit(1)
 	}
 
+	// MULTICLUSTER: The provider engages clusters only on the elected leader.
+	if err := provider.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to add cluster provider to manager")
+		os.Exit(1)
+	}
+
+	// MULTICLUSTER: The state of the provider, i.e. the engaged workspaces and
+	// the objects cached per workspace, is served next to the metrics.
+	if err := mgr.AddMetricsServerExtraHandler("/debug/kcp", provider.DebugHandler()); err != nil {
+		setupLog.Error(err, "unable to add provider debug handler to metrics server")
+		os.Exit(1)
+	}
+
+	// MULTICLUSTER: Every namespace of every workspace gets its own namespace
+	// on the host cluster. The host namespaces of a disengaged workspace are
+	// deleted once its APIBinding is gone as well, as disengagement alone also
+	// happens temporarily, e.g. when the workspace moves to another replica.
+	// The host objects of an application are deleted with the application.
+	hostNamespaces := hostmapping.New(hostCluster.GetClient(), hostmapping.Options{})
+	if err := mgr.Add(hostNamespaces); err != nil {
+		setupLog.Error(err, "unable to add host namespace mapper to manager")
+		os.Exit(1)
+	}
+
+	// MULTICLUSTER: Changes of the workloads on the host cluster trigger the
+	// reconciliation of their Application.
+	hostDeployments, err := provider.HostSource(&appsv1.Deployment{}, hostmapping.OwnerRequests)
+	if err != nil {
+		setupLog.Error(err, "unable to watch host cluster")
+		os.Exit(1)
+	}
+
 	if err := mcbuilder.ControllerManagedBy(mgr).
 		Named("kcp-applications-controller").
 		For(&applicationapisv1alpha1.Application{}).
+		WatchesRawSource(hostDeployments).
 		Complete(mcreconcile.Func(
 			func(ctx context.Context, req mcreconcile.Request) (ctrl.Result, error) {
 				log := log.FromContext(ctx).WithValues("cluster", req.ClusterName)
@@ -273,12 +311,16 @@ func main() {
 				if err != nil {
 					return reconcile.Result{}, fmt.Errorf("failed to get cluster: %w", err)
 				}
-				client := cl.GetClient()
+				host, err := mgr.GetCluster(ctx, virtualworkspace.HostClusterName)
+				if err != nil {
+					return reconcile.Result{}, fmt.Errorf("failed to get host cluster: %w", err)
+				}
 
 				reconciler := &controller.ApplicationReconciler{
-					Client:         client,
+					Client:         cl.GetClient(),
 					Scheme:         cl.GetScheme(),
-					ProviderClient: providerClusterDynamicClient,
+					HostClient:     host.GetClient(),
+					HostNamespaces: hostNamespaces,
 				}
 				return reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: req.NamespacedName})
 			},
@@ -286,6 +328,9 @@ func main() {
 		setupLog.Error(err, "unable to create controller", "controller", "Application")
 		os.Exit(1)
 	}
+
+	// MULTICLUSTER: Admission requests are routed to the workspace of the object.
+	webhookapisv1alpha1.SetupApplicationWebhook(mgr.GetWebhookServer(), provider, clientgoscheme.Scheme)
 	// +kubebuilder:scaffold:builder
 
 	// TODO(mjudeikis): This needs to be implemented in mcmanager.
@@ -314,16 +359,6 @@ func main() {
 		os.Exit(1)
 	}
 
-	if provider != nil {
-		setupLog.Info("Starting provider")
-		go func() {
-			if err := provider.Run(ctx, mgr); err != nil {
-				setupLog.Error(err, "unable to run provider")
-				os.Exit(1)
-			}
-		}()
-	}
-
 	setupLog.Info("starting manager", "server", server)
 	if err := mgr.Start(ctx); err != nil {
 		setupLog.Error(err, "problem running manager")
@@ -4,6 +4,7 @@ go 1.23.5
 
 require (
 	github.com/kcp-dev/kcp/sdk v0.26.1
+	github.com/kcp-dev/logicalcluster/v3 v3.0.5
 	github.com/kcp-dev/multicluster-provider v0.0.0-20250310140656-89fbeb34dc44
 	github.com/multicluster-runtime/multicluster-runtime v0.20.0-alpha.5
 	github.com/onsi/ginkgo/v2 v2.22.0
@@ -50,7 +51,6 @@ require (
 	github.com/josharian/intern v1.0.0 // indirect
 	github.com/json-iterator/go v1.1.12 // indirect
 	github.com/kcp-dev/apimachinery/v2 v2.0.1-0.20240817110845-a9eb9752bfeb // indirect
-	github.com/kcp-dev/logicalcluster/v3 v3.0.5 // indirect
 	github.com/mailru/easyjson v0.7.7 // indirect
 	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
 	github.com/modern-go/reflect2 v1.0.2 // indirect
@@ -103,4 +103,7 @@ require (
 )
 
 replace github.com/multicluster-runtime/multicluster-runtime => github.com/multicluster-runtime/multicluster-runtime v0.0.0-20250314182220-6648ea69ab14
-replace github.com/kcp-dev/multicluster-provider => github.com/kcp-dev/multicluster-provider v0.0.0-20250313155532-e66c5ab2532c
+
+// The example is built against the provider in this repository, as it uses
+// APIs like Provider.SetupWithManager that are not in a release yet.
+replace github.com/kcp-dev/multicluster-provider => ../../
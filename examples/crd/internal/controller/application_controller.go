@@ -23,6 +23,8 @@ import (
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
@@ -32,11 +34,15 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
+	"github.com/kcp-dev/logicalcluster/v3"
+	"github.com/kcp-dev/multicluster-provider/virtualworkspace/hostmapping"
+
 	apisv1alpha1 "github.com/kcp-dev/multicluster-provider/examples/crd/api/v1alpha1"
 )
 
 const (
-	// FinalizerName is the finalizer name for the Application CRD
+	// FinalizerName is the finalizer of the controller on Applications. It
+	// keeps a deleted Application around until its host objects are gone.
 	FinalizerName = "finalizer.apis.contrib.kcp.io/no-no-no"
 )
 
@@ -45,7 +51,12 @@ type ApplicationReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
 
-	ProviderClient client.Client
+	// HostClient is the client of the host cluster running the workloads
+	// of the Applications.
+	HostClient client.Client
+	// HostNamespaces maps the namespaces of the Applications to namespaces
+	// of the host cluster.
+	HostNamespaces *hostmapping.Mapper
 }
 
 // +kubebuilder:rbac:groups=apis.contrib.kcp.io,resources=applications,verbs=get;list;watch;create;update;patch;delete
@@ -69,75 +80,78 @@ func (r *ApplicationReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
+	if !obj.DeletionTimestamp.IsZero() {
+		return r.finalize(ctx, obj)
+	}
+	if controllerutil.AddFinalizer(obj, FinalizerName) {
+		if err := r.Client.Update(ctx, obj); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
 	var secret corev1.Secret
-	err := r.Client.Get(ctx, client.ObjectKey{
-		Namespace: req.Namespace,
-		Name:      obj.Spec.DatabaseSecretRef.Name,
-	}, &secret)
-	if err != nil {
+	if err := r.Client.Get(ctx, obj.DatabaseSecretKey(), &secret); err != nil {
 		return ctrl.Result{
 			Requeue: true,
 		}, err
 	}
 
-	namespace, ok := obj.Annotations["kcp.io/cluster"]
-	if !ok {
-		return ctrl.Result{}, fmt.Errorf("cluster label not found")
-	}
-
-	deployment, err := getApplicationDeployment(obj, namespace)
+	namespace, err := r.HostNamespaces.EnsureHostNamespace(ctx, logicalcluster.From(obj), obj.Namespace)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	_, err = controllerutil.CreateOrUpdate(ctx, r.ProviderClient, deployment, func() error {
-		return nil
-	})
-	if err != nil {
-		return ctrl.Result{}, err
-	}
-
-	svc, err := getApplicationService(obj, namespace)
+	serverJson, err := getServerJson(obj, secret)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	_, err = controllerutil.CreateOrUpdate(ctx, r.ProviderClient, svc, func() error {
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: obj.Name, Namespace: namespace}}
+	if err := r.ensureHostObject(ctx, deployment, obj, func() error {
+		setApplicationDeploymentSpec(deployment, obj)
 		return nil
-	})
-	if err != nil {
+	}); err != nil {
 		return ctrl.Result{}, err
 	}
 
-	serverJson, err := getServerJson(obj, secret)
-	if err != nil {
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: obj.Name, Namespace: namespace}}
+	if err := r.ensureHostObject(ctx, svc, obj, func() error {
+		setApplicationServiceSpec(svc, obj)
+		return nil
+	}); err != nil {
 		return ctrl.Result{}, err
 	}
 
-	serverSecret := &corev1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      obj.Name + "-server",
-			Namespace: namespace,
-			Finalizers: []string{
-				FinalizerName,
-			},
-		},
-		Data: map[string][]byte{
+	serverSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: obj.Name + "-server", Namespace: namespace}}
+	if err := r.ensureHostObject(ctx, serverSecret, obj, func() error {
+		serverSecret.Data = map[string][]byte{
 			"servers.json": serverJson,
-		},
+		}
+		return nil
+	}); err != nil {
+		return ctrl.Result{}, err
 	}
 
-	_, err = controllerutil.CreateOrUpdate(ctx, r.ProviderClient, serverSecret, func() error {
-		return nil
-	})
-	if err != nil {
+	if err := r.removeLegacyHostObjects(ctx, obj); err != nil {
 		return ctrl.Result{}, err
 	}
 
-	// Update the status
-	obj.Status.Status = "Ready"
+	// Update the status from the host Deployment, whose changes trigger the
+	// reconciliation through the watch on the host cluster.
+	status := obj.Status.DeepCopy()
+	ready := deploymentReadyCondition(deployment)
+	ready.ObservedGeneration = obj.Generation
+	meta.SetStatusCondition(&obj.Status.Conditions, ready)
+	obj.Status.ObservedGeneration = obj.Generation
+	obj.Status.Status = "NotReady"
+	if ready.Status == metav1.ConditionTrue {
+		obj.Status.Status = "Ready"
+	}
 	obj.Status.ConnectionString = "kubectl port-forward svc/" + obj.Name + " 8080:8080 -n " + namespace
 
+	if equality.Semantic.DeepEqual(status, &obj.Status) {
+		return ctrl.Result{}, nil
+	}
 	if err := r.Client.Status().Update(ctx, obj); err != nil {
 		return ctrl.Result{}, err
 	}
@@ -145,6 +159,46 @@ func (r *ApplicationReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	return ctrl.Result{}, nil
 }
 
+// deploymentReadyCondition returns the Ready condition of an Application from
+// the status of its host Deployment.
+func deploymentReadyCondition(deployment *appsv1.Deployment) metav1.Condition {
+	replicas := ptr.Deref(deployment.Spec.Replicas, 1)
+	if deployment.Status.ObservedGeneration < deployment.Generation || deployment.Status.UpdatedReplicas < replicas {
+		return metav1.Condition{
+			Type:    apisv1alpha1.ApplicationConditionReady,
+			Status:  metav1.ConditionFalse,
+			Reason:  apisv1alpha1.ApplicationReasonProgressing,
+			Message: fmt.Sprintf("Deployment %s is rolling out", deployment.Name),
+		}
+	}
+
+	for _, cond := range deployment.Status.Conditions {
+		if cond.Type != appsv1.DeploymentAvailable {
+			continue
+		}
+		if cond.Status == corev1.ConditionTrue {
+			return metav1.Condition{
+				Type:    apisv1alpha1.ApplicationConditionReady,
+				Status:  metav1.ConditionTrue,
+				Reason:  apisv1alpha1.ApplicationReasonAvailable,
+				Message: fmt.Sprintf("Deployment %s is available", deployment.Name),
+			}
+		}
+		return metav1.Condition{
+			Type:    apisv1alpha1.ApplicationConditionReady,
+			Status:  metav1.ConditionFalse,
+			Reason:  apisv1alpha1.ApplicationReasonUnavailable,
+			Message: fmt.Sprintf("Deployment %s is not available: %s", deployment.Name, cond.Message),
+		}
+	}
+	return metav1.Condition{
+		Type:    apisv1alpha1.ApplicationConditionReady,
+		Status:  metav1.ConditionFalse,
+		Reason:  apisv1alpha1.ApplicationReasonUnavailable,
+		Message: fmt.Sprintf("Deployment %s is not available", deployment.Name),
+	}
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *ApplicationReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
@@ -153,6 +207,124 @@ func (r *ApplicationReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		Complete(r)
 }
 
+// finalize deletes the host objects of the Application, and removes its
+// finalizer once they are gone.
+func (r *ApplicationReconciler) finalize(ctx context.Context, obj *apisv1alpha1.Application) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(obj, FinalizerName) {
+		return ctrl.Result{}, nil
+	}
+
+	clusterName := logicalcluster.From(obj)
+	for _, hostObj := range applicationHostObjects(obj, r.HostNamespaces.HostNamespace(clusterName, obj.Namespace)) {
+		if err := r.releaseHostObject(ctx, hostObj); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	if err := r.removeLegacyHostObjects(ctx, obj); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	done, err := r.HostNamespaces.DeleteOwned(ctx, clusterName, client.ObjectKeyFromObject(obj),
+		&appsv1.DeploymentList{}, &corev1.ServiceList{}, &corev1.SecretList{})
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !done {
+		return ctrl.Result{Requeue: true}, nil
+	}
+
+	controllerutil.RemoveFinalizer(obj, FinalizerName)
+	if err := r.Client.Update(ctx, obj); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	return ctrl.Result{}, nil
+}
+
+// ensureHostObject creates or updates the host object of the Application,
+// with mutate setting its desired state. Host objects do not carry
+// FinalizerName, so that they can be deleted with their host namespace; it is
+// removed from those created by earlier versions.
+func (r *ApplicationReconciler) ensureHostObject(ctx context.Context, hostObj client.Object, app *apisv1alpha1.Application, mutate controllerutil.MutateFn) error {
+	_, err := controllerutil.CreateOrUpdate(ctx, r.HostClient, hostObj, func() error {
+		if err := mutate(); err != nil {
+			return err
+		}
+		controllerutil.RemoveFinalizer(hostObj, FinalizerName)
+		r.setOwner(hostObj, app)
+		return nil
+	})
+	return err
+}
+
+// applicationHostObjects returns the keys of the host objects of the
+// Application in the given host namespace.
+func applicationHostObjects(app *apisv1alpha1.Application, namespace string) []client.Object {
+	return []client.Object{
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: app.Name}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: app.Name}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: app.Name + "-server"}},
+	}
+}
+
+// removeLegacyHostObjects deletes the host objects that versions before the
+// hostmapping package created in the host namespace named after the logical
+// cluster of the Application. Objects which do not look like they were created
+// for the Application are left alone, and so is the namespace itself.
+func (r *ApplicationReconciler) removeLegacyHostObjects(ctx context.Context, app *apisv1alpha1.Application) error {
+	for _, hostObj := range applicationHostObjects(app, logicalcluster.From(app).String()) {
+		if err := r.HostClient.Get(ctx, client.ObjectKeyFromObject(hostObj), hostObj); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return err
+			}
+			continue
+		}
+		if !isLegacyHostObject(hostObj, app) {
+			continue
+		}
+		if err := r.releaseHostObject(ctx, hostObj); err != nil {
+			return err
+		}
+		if err := r.HostClient.Delete(ctx, hostObj); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isLegacyHostObject returns true if the host object was created for the
+// Application by a version before the hostmapping package, which neither
+// labelled nor annotated its host objects.
+func isLegacyHostObject(hostObj client.Object, app *apisv1alpha1.Application) bool {
+	switch obj := hostObj.(type) {
+	case *appsv1.Deployment:
+		return obj.Spec.Selector != nil && obj.Spec.Selector.MatchLabels["app"] == app.Name
+	case *corev1.Service:
+		return obj.Spec.Selector["app"] == app.Name
+	default:
+		return controllerutil.ContainsFinalizer(hostObj, FinalizerName)
+	}
+}
+
+// releaseHostObject removes FinalizerName from a host object created by an
+// earlier version, so that it goes away once deleted.
+func (r *ApplicationReconciler) releaseHostObject(ctx context.Context, hostObj client.Object) error {
+	if err := r.HostClient.Get(ctx, client.ObjectKeyFromObject(hostObj), hostObj); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !controllerutil.RemoveFinalizer(hostObj, FinalizerName) {
+		return nil
+	}
+	return client.IgnoreNotFound(r.HostClient.Update(ctx, hostObj))
+}
+
+func (r *ApplicationReconciler) setOwner(obj client.Object, app *apisv1alpha1.Application) {
+	r.HostNamespaces.SetOwner(obj, app)
+
+	labels := obj.GetLabels()
+	labels["app"] = app.Name
+	obj.SetLabels(labels)
+}
+
 func getServerJson(app *apisv1alpha1.Application, secret corev1.Secret) ([]byte, error) {
 	d := map[string]interface{}{
 		"Servers": map[string]interface{}{
@@ -167,100 +339,83 @@ func getServerJson(app *apisv1alpha1.Application, secret corev1.Secret) ([]byte,
 	return json.Marshal(d)
 }
 
-func getApplicationService(app *apisv1alpha1.Application, namespace string) (*corev1.Service, error) {
-	return &corev1.Service{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      app.Name,
-			Namespace: namespace,
-			Finalizers: []string{
-				FinalizerName,
-			},
-		},
-		Spec: corev1.ServiceSpec{
-			Selector: map[string]string{
-				"app": app.Name,
-			},
-			Ports: []corev1.ServicePort{
-				{
-					Port:       8080,
-					TargetPort: intstr.FromInt(80),
-				},
-			},
+// setApplicationServiceSpec sets the desired spec of the host Service of the
+// Application, keeping the fields defaulted by the API server.
+func setApplicationServiceSpec(svc *corev1.Service, app *apisv1alpha1.Application) {
+	svc.Spec.Selector = map[string]string{
+		"app": app.Name,
+	}
+	svc.Spec.Ports = []corev1.ServicePort{
+		{
+			Protocol:   corev1.ProtocolTCP,
+			Port:       8080,
+			TargetPort: intstr.FromInt(80),
 		},
-	}, nil
+	}
 }
 
-func getApplicationDeployment(app *apisv1alpha1.Application, namespace string) (*appsv1.Deployment, error) {
-	return &appsv1.Deployment{
+// setApplicationDeploymentSpec sets the desired spec of the host Deployment
+// of the Application.
+func setApplicationDeploymentSpec(deployment *appsv1.Deployment, app *apisv1alpha1.Application) {
+	deployment.Spec.Replicas = ptr.To[int32](1)
+	deployment.Spec.Selector = &metav1.LabelSelector{
+		MatchLabels: map[string]string{
+			"app": app.Name,
+		},
+	}
+	deployment.Spec.Template = corev1.PodTemplateSpec{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      app.Name,
-			Namespace: namespace,
-			Finalizers: []string{
-				FinalizerName,
+			Labels: map[string]string{
+				"app": app.Name,
 			},
 		},
-		Spec: appsv1.DeploymentSpec{
-			Replicas: ptr.To[int32](1),
-			Selector: &metav1.LabelSelector{
-				MatchLabels: map[string]string{
-					"app": app.Name,
-				},
-			},
-			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: map[string]string{
-						"app": app.Name,
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:            "pgadmin",
+					Image:           "dpage/pgadmin4:9.1.0",
+					ImagePullPolicy: corev1.PullIfNotPresent,
+					Ports: []corev1.ContainerPort{
+						{
+							ContainerPort: 80,
+						},
 					},
-				},
-				Spec: corev1.PodSpec{
-					Containers: []corev1.Container{
+					Env: []corev1.EnvVar{
 						{
-							Name:            "pgadmin",
-							Image:           "dpage/pgadmin4:9.1.0",
-							ImagePullPolicy: corev1.PullIfNotPresent,
-							Ports: []corev1.ContainerPort{
-								{
-									ContainerPort: 80,
-								},
-							},
-							Env: []corev1.EnvVar{
-								{
-									Name:  "PGADMIN_DEFAULT_EMAIL",
-									Value: "admin@kcp.io",
-								},
-								{
-									Name:  "PGADMIN_DEFAULT_PASSWORD",
-									Value: "admin",
-								},
-								{
-									Name:  "PGADMIN_PORT",
-									Value: "80",
-								},
-								{
-									Name:  "PGADMIN_SETUP_EMAIL",
-									Value: "admin@kcp.io",
-								},
-								{
-									Name:  "PGADMIN_SETUP_PASSWORD",
-									Value: "admin",
-								},
-								{
-									Name:  "PGADMIN_CONFIG_SERVER_MODE",
-									Value: "False",
-								},
-								{
-									Name:  "PGADMIN_CONFIG_ENHANCED_COOKIE_PROTECTION",
-									Value: "False",
-								},
-								{
-									Name: "PGADMIN_SERVER_JSON_FILE",
-									ValueFrom: &corev1.EnvVarSource{
-										SecretKeyRef: &corev1.SecretKeySelector{
-											Key: "servers.json",
-											LocalObjectReference: corev1.LocalObjectReference{
-												Name: app.Name + "-server",
-											},
-										},
+							Name:  "PGADMIN_DEFAULT_EMAIL",
+							Value: "admin@kcp.io",
+						},
+						{
+							Name:  "PGADMIN_DEFAULT_PASSWORD",
+							Value: "admin",
+						},
+						{
+							Name:  "PGADMIN_PORT",
+							Value: "80",
+						},
+						{
+							Name:  "PGADMIN_SETUP_EMAIL",
+							Value: "admin@kcp.io",
+						},
+						{
+							Name:  "PGADMIN_SETUP_PASSWORD",
+							Value: "admin",
+						},
+						{
+							Name:  "PGADMIN_CONFIG_SERVER_MODE",
+							Value: "False",
+						},
+						{
+							Name:  "PGADMIN_CONFIG_ENHANCED_COOKIE_PROTECTION",
+							Value: "False",
+						},
+						{
+							Name: "PGADMIN_SERVER_JSON_FILE",
+							ValueFrom: &corev1.EnvVarSource{
+								SecretKeyRef: &corev1.SecretKeySelector{
+									Key: "servers.json",
+									LocalObjectReference: corev1.LocalObjectReference{
+										Name: app.Name + "-server",
 									},
 								},
 							},
@@ -269,5 +424,5 @@ func getApplicationDeployment(app *apisv1alpha1.Application, namespace string) (
 				},
 			},
 		},
-	}, nil
+	}
 }
@@ -21,12 +21,20 @@ import (
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	"github.com/kcp-dev/logicalcluster/v3"
+	"github.com/kcp-dev/multicluster-provider/virtualworkspace/hostmapping"
+
 	apisv1alpha1 "github.com/kcp-dev/multicluster-provider/examples/crd/api/v1alpha1"
 )
 
@@ -38,47 +46,228 @@ var _ = Describe("Application Controller", func() {
 
 		typeNamespacedName := types.NamespacedName{
 			Name:      resourceName,
-			Namespace: "default", // TODO(user):Modify as needed
+			Namespace: "default",
+		}
+
+		// the test environment plays both the workspace and the host cluster.
+		var controllerReconciler *ApplicationReconciler
+		var hostNamespace string
+
+		reconcileUntilGone := func(g Gomega) {
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			g.Expect(err).NotTo(HaveOccurred())
+			err = k8sClient.Get(ctx, typeNamespacedName, &apisv1alpha1.Application{})
+			g.Expect(errors.IsNotFound(err)).To(BeTrue(), "Application must be gone")
 		}
-		application := &apisv1alpha1.Application{}
 
 		BeforeEach(func() {
+			controllerReconciler = &ApplicationReconciler{
+				Client:         k8sClient,
+				Scheme:         k8sClient.Scheme(),
+				HostClient:     k8sClient,
+				HostNamespaces: hostmapping.New(k8sClient, hostmapping.Options{}),
+			}
+			hostNamespace = controllerReconciler.HostNamespaces.HostNamespace("foo", "default")
+
+			By("creating the database secret")
+			err := k8sClient.Create(ctx, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+				Name:      "kcp-superuser",
+				Namespace: "default",
+			}})
+			if err != nil && !errors.IsAlreadyExists(err) {
+				Expect(err).NotTo(HaveOccurred())
+			}
+
 			By("creating the custom resource for the Kind Application")
-			err := k8sClient.Get(ctx, typeNamespacedName, application)
-			if err != nil && errors.IsNotFound(err) {
-				resource := &apisv1alpha1.Application{
-					ObjectMeta: metav1.ObjectMeta{
-						Name:      resourceName,
-						Namespace: "default",
-					},
-					// TODO(user): Specify other spec details if needed.
-				}
-				Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+			resource := &apisv1alpha1.Application{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        resourceName,
+					Namespace:   "default",
+					Annotations: map[string]string{logicalcluster.AnnotationKey: "foo"},
+				},
+				Spec: apisv1alpha1.ApplicationSpec{
+					DatabaseRef:       "db-one",
+					DatabaseSecretRef: corev1.SecretReference{Name: "kcp-superuser"},
+				},
 			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
 		})
 
 		AfterEach(func() {
-			// TODO(user): Cleanup logic after each test, like removing the resource instance.
+			By("Cleanup the specific resource instance Application")
 			resource := &apisv1alpha1.Application{}
 			err := k8sClient.Get(ctx, typeNamespacedName, resource)
+			if errors.IsNotFound(err) {
+				return
+			}
 			Expect(err).NotTo(HaveOccurred())
-
-			By("Cleanup the specific resource instance Application")
 			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+			Eventually(reconcileUntilGone).Should(Succeed())
 		})
+
 		It("should successfully reconcile the resource", func() {
 			By("Reconciling the created resource")
-			controllerReconciler := &ApplicationReconciler{
-				Client: k8sClient,
-				Scheme: k8sClient.Scheme(),
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			resource := &apisv1alpha1.Application{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Finalizers).To(ContainElement(FinalizerName))
+			Expect(resource.Status.ObservedGeneration).To(Equal(resource.Generation))
+			Expect(resource.Status.Status).To(Equal("NotReady"))
+			ready := meta.FindStatusCondition(resource.Status.Conditions, apisv1alpha1.ApplicationConditionReady)
+			Expect(ready).NotTo(BeNil())
+			Expect(ready.Status).To(Equal(metav1.ConditionFalse))
+			Expect(ready.Reason).To(Equal(apisv1alpha1.ApplicationReasonProgressing))
+
+			By("checking the host objects")
+			for _, hostObj := range []client.Object{&appsv1.Deployment{}, &corev1.Service{}} {
+				Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: hostNamespace, Name: resourceName}, hostObj)).To(Succeed())
+				Expect(hostObj.GetAnnotations()).To(HaveKeyWithValue(hostmapping.OwnerNameAnnotation, resourceName))
+				Expect(hostObj.GetFinalizers()).To(BeEmpty())
 			}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: hostNamespace, Name: resourceName + "-server"}, &corev1.Secret{})).To(Succeed())
+		})
 
+		It("should reflect the status of the host Deployment", func() {
+			By("Reconciling the created resource")
 			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
 				NamespacedName: typeNamespacedName,
 			})
 			Expect(err).NotTo(HaveOccurred())
-			// TODO(user): Add more specific assertions depending on your controller's reconciliation logic.
-			// Example: If you expect a certain status condition after reconciliation, verify it here.
+
+			By("making the host Deployment available, as the deployment controller would")
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: hostNamespace, Name: resourceName}, deployment)).To(Succeed())
+			deployment.Status = appsv1.DeploymentStatus{
+				ObservedGeneration: deployment.Generation,
+				Replicas:           1,
+				UpdatedReplicas:    1,
+				ReadyReplicas:      1,
+				AvailableReplicas:  1,
+				Conditions: []appsv1.DeploymentCondition{{
+					Type:   appsv1.DeploymentAvailable,
+					Status: corev1.ConditionTrue,
+					Reason: "MinimumReplicasAvailable",
+				}},
+			}
+			Expect(k8sClient.Status().Update(ctx, deployment)).To(Succeed())
+
+			By("Reconciling the resource again")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			resource := &apisv1alpha1.Application{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.Status).To(Equal("Ready"))
+			ready := meta.FindStatusCondition(resource.Status.Conditions, apisv1alpha1.ApplicationConditionReady)
+			Expect(ready).NotTo(BeNil())
+			Expect(ready.Status).To(Equal(metav1.ConditionTrue))
+			Expect(ready.Reason).To(Equal(apisv1alpha1.ApplicationReasonAvailable))
+			Expect(ready.ObservedGeneration).To(Equal(resource.Generation))
+		})
+
+		It("should restore the desired state of the host objects", func() {
+			By("Reconciling the created resource")
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("changing the host objects behind the back of the controller")
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: hostNamespace, Name: resourceName}, deployment)).To(Succeed())
+			deployment.Spec.Replicas = ptr.To[int32](3)
+			deployment.Spec.Template.Spec.Containers[0].Image = "busybox"
+			Expect(k8sClient.Update(ctx, deployment)).To(Succeed())
+			svc := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: hostNamespace, Name: resourceName}, svc)).To(Succeed())
+			svc.Spec.Ports[0].Port = 9090
+			Expect(k8sClient.Update(ctx, svc)).To(Succeed())
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: hostNamespace, Name: resourceName + "-server"}, secret)).To(Succeed())
+			secret.Data = map[string][]byte{"servers.json": []byte("{}")}
+			Expect(k8sClient.Update(ctx, secret)).To(Succeed())
+
+			By("Reconciling the resource again")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: hostNamespace, Name: resourceName}, deployment)).To(Succeed())
+			Expect(deployment.Spec.Replicas).To(Equal(ptr.To[int32](1)))
+			Expect(deployment.Spec.Template.Spec.Containers[0].Image).To(Equal("dpage/pgadmin4:9.1.0"))
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: hostNamespace, Name: resourceName}, svc)).To(Succeed())
+			Expect(svc.Spec.Ports[0].Port).To(Equal(int32(8080)))
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: hostNamespace, Name: resourceName + "-server"}, secret)).To(Succeed())
+			Expect(string(secret.Data["servers.json"])).To(ContainSubstring(resourceName))
+		})
+
+		It("should remove the host objects of earlier versions", func() {
+			By("creating the host objects in the namespace named after the logical cluster")
+			err := k8sClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "foo"}})
+			if err != nil && !errors.IsAlreadyExists(err) {
+				Expect(err).NotTo(HaveOccurred())
+			}
+			legacyDeployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: resourceName}}
+			setApplicationDeploymentSpec(legacyDeployment, &apisv1alpha1.Application{ObjectMeta: metav1.ObjectMeta{Name: resourceName}})
+			legacySvc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: resourceName}}
+			setApplicationServiceSpec(legacySvc, &apisv1alpha1.Application{ObjectMeta: metav1.ObjectMeta{Name: resourceName}})
+			for _, hostObj := range []client.Object{
+				legacyDeployment,
+				legacySvc,
+				&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: resourceName + "-server", Finalizers: []string{FinalizerName}}},
+			} {
+				Expect(k8sClient.Create(ctx, hostObj)).To(Succeed())
+			}
+
+			By("Reconciling the created resource")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("checking the host objects of earlier versions are gone")
+			for _, hostObj := range applicationHostObjects(&apisv1alpha1.Application{ObjectMeta: metav1.ObjectMeta{Name: resourceName}}, "foo") {
+				err := k8sClient.Get(ctx, client.ObjectKeyFromObject(hostObj), hostObj)
+				Expect(errors.IsNotFound(err)).To(BeTrue(), "host object %s must be gone", hostObj.GetName())
+			}
+		})
+
+		It("should clean up the host objects on deletion", func() {
+			By("Reconciling the created resource")
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("adding the finalizer of earlier versions to a host object")
+			svc := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: hostNamespace, Name: resourceName}, svc)).To(Succeed())
+			svc.Finalizers = append(svc.Finalizers, FinalizerName)
+			Expect(k8sClient.Update(ctx, svc)).To(Succeed())
+
+			By("deleting the resource")
+			resource := &apisv1alpha1.Application{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+			Eventually(reconcileUntilGone).Should(Succeed())
+
+			By("checking the host objects are gone")
+			for key, hostObj := range map[string]client.Object{
+				resourceName:             &appsv1.Deployment{},
+				resourceName + "-server": &corev1.Secret{},
+			} {
+				err := k8sClient.Get(ctx, client.ObjectKey{Namespace: hostNamespace, Name: key}, hostObj)
+				Expect(errors.IsNotFound(err)).To(BeTrue(), "host object %s must be gone", key)
+			}
+			err = k8sClient.Get(ctx, client.ObjectKey{Namespace: hostNamespace, Name: resourceName}, &corev1.Service{})
+			Expect(errors.IsNotFound(err)).To(BeTrue(), "host service must be gone")
 		})
 	})
 })
@@ -0,0 +1,95 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/kcp-dev/logicalcluster/v3"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/kcp-dev/multicluster-provider/virtualworkspace"
+
+	apisv1alpha1 "github.com/kcp-dev/multicluster-provider/examples/crd/api/v1alpha1"
+)
+
+// ValidatingPath is the path the Application validating webhook is served at.
+const ValidatingPath = "/validate-apis-contrib-kcp-io-v1alpha1-application"
+
+// ApplicationValidator validates Applications against the state of the
+// workspace they are created in.
+type ApplicationValidator struct {
+	decoder admission.Decoder
+}
+
+var _ virtualworkspace.AdmissionHandler = &ApplicationValidator{}
+
+// SetupApplicationWebhook registers the Application validating
+// webhook with the webhook server, routing requests to the workspace of the
+// Application.
+//
+// MULTICLUSTER: This is where it differs from the default scaffold, which
+// registers the webhook with ctrl.NewWebhookManagedBy and a single cluster.
+func SetupApplicationWebhook(server webhook.Server, clusters virtualworkspace.ClusterGetter, scheme *runtime.Scheme) {
+	server.Register(ValidatingPath, virtualworkspace.NewAdmissionWebhook(clusters, &ApplicationValidator{
+		decoder: admission.NewDecoder(scheme),
+	}))
+}
+
+// Handle rejects Applications that reference a database secret which does not
+// exist in their workspace.
+func (v *ApplicationValidator) Handle(ctx context.Context, clusterName logicalcluster.Name, cl cluster.Cluster, req admission.Request) admission.Response {
+	if req.Operation != admissionv1.Create && req.Operation != admissionv1.Update {
+		return admission.Allowed("")
+	}
+
+	app := &apisv1alpha1.Application{}
+	if err := v.decoder.Decode(req, app); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	if app.Spec.DatabaseSecretRef.Name == "" {
+		return admission.Allowed("")
+	}
+	// the namespace of the object may be left to the request on create.
+	if app.Namespace == "" {
+		app.Namespace = req.Namespace
+	}
+	key := app.DatabaseSecretKey()
+
+	log.FromContext(ctx).V(1).Info("Validating Application", "name", app.Name, "secret", key)
+
+	secret := &corev1.Secret{}
+	if err := cl.GetClient().Get(ctx, key, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return admission.Denied(fmt.Sprintf("database secret %s does not exist in workspace %s", key, clusterName))
+		}
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	return admission.Allowed("")
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kcp
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/util/rand"
+
+	"github.com/kcp-dev/multicluster-provider/examples/crd/internal/controller"
+	"github.com/kcp-dev/multicluster-provider/examples/crd/test/utils"
+)
+
+// applicationName is the name of the Application created in the consumer workspace.
+const applicationName = "e2e-application"
+
+var _ = Describe("Application deletion", Ordered, func() {
+	var (
+		parent       string
+		providerPath string
+		consumerPath string
+		clusterName  string
+		manager      *exec.Cmd
+	)
+
+	// Before running the tests, set up a provider workspace exporting the Application API,
+	// a consumer workspace binding it, and start the controller against the virtual workspace
+	// of the APIExport.
+	BeforeAll(func() {
+		_, parent = kcpServer()
+		suffix := rand.String(5)
+
+		By("creating the provider workspace with the APIExport")
+		providerPath, _ = createWorkspace(parent, "e2e-provider-"+suffix)
+		_, err := kubectl(providerPath, "apply",
+			"-f", "config/kcp/apiresourceschema-applications.apis.contrib.kcp.io.yaml",
+			"-f", "config/kcp/apiexport-apis.contrib.kcp.io.yaml")
+		Expect(err).NotTo(HaveOccurred(), "Failed to apply the APIExport")
+
+		By("creating the consumer workspace binding the APIExport")
+		consumerPath, clusterName = createWorkspace(parent, "e2e-consumer-"+suffix)
+		apply(consumerPath, fmt.Sprintf(`apiVersion: apis.kcp.io/v1alpha1
+kind: APIBinding
+metadata:
+  name: apis.contrib.kcp.io
+spec:
+  reference:
+    export:
+      path: %s
+      name: apis.contrib.kcp.io
+  permissionClaims:
+  - resource: secrets
+    all: true
+    state: Accepted
+`, providerPath))
+		_, err = kubectl(consumerPath, "wait", "--for=jsonpath={.status.phase}=Bound",
+			"apibinding/apis.contrib.kcp.io", "--timeout=2m")
+		Expect(err).NotTo(HaveOccurred(), "APIBinding did not get bound")
+
+		By("starting the controller against the virtual workspace")
+		var url string
+		Eventually(func(g Gomega) {
+			url, err = kubectl(providerPath, "get", "apiexport", "apis.contrib.kcp.io",
+				"-o", "jsonpath={.status.virtualWorkspaces[0].url}")
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(url).NotTo(BeEmpty(), "APIExport has no virtual workspace URL yet")
+		}).Should(Succeed())
+
+		dir, err := utils.GetProjectDir()
+		Expect(err).NotTo(HaveOccurred())
+		manager = exec.Command(filepath.Join(dir, controllerBinary),
+			"--server", strings.TrimSpace(url),
+			"--provider-kubeconfig", hostKubeconfig,
+			"--webhook-cert-path", writeServingCert(),
+			"--health-probe-bind-address", "0",
+		)
+		manager.Env = append(os.Environ(), "KUBECONFIG="+kcpKubeconfig)
+		manager.Stdout = GinkgoWriter
+		manager.Stderr = GinkgoWriter
+		Expect(manager.Start()).To(Succeed(), "Failed to start the controller")
+	})
+
+	// After all tests have been executed, clean up by stopping the controller and deleting the
+	// workspaces.
+	AfterAll(func() {
+		if manager != nil && manager.Process != nil {
+			By("stopping the controller")
+			_ = manager.Process.Signal(os.Interrupt)
+			_ = manager.Wait()
+		}
+
+		By("removing the workspaces")
+		for _, path := range []string{consumerPath, providerPath} {
+			if path != "" {
+				_, _ = kubectl(parent, "delete", "workspace", path[strings.LastIndex(path, ":")+1:], "--wait=false")
+			}
+		}
+	})
+
+	SetDefaultEventuallyTimeout(2 * time.Minute)
+	SetDefaultEventuallyPollingInterval(time.Second)
+
+	// hostObjects returns the Deployments, Services and Secrets of the consumer workspace in the
+	// host cluster.
+	hostObjects := func(g Gomega) []string {
+		cmd := exec.Command("kubectl", "--kubeconfig", hostKubeconfig,
+			"get", "deployments,services,secrets", "--all-namespaces",
+			"-l", "multicluster.kcp.io/cluster="+clusterName, "-o", "name")
+		output, err := utils.Run(cmd)
+		g.Expect(err).NotTo(HaveOccurred())
+		return utils.GetNonEmptyLines(output)
+	}
+
+	It("should create the host objects of an Application", func() {
+		By("creating an Application with its database secret")
+		apply(consumerPath, fmt.Sprintf(`apiVersion: v1
+kind: Secret
+metadata:
+  name: e2e-database
+  namespace: default
+stringData:
+  password: e2e
+---
+apiVersion: apis.contrib.kcp.io/v1alpha1
+kind: Application
+metadata:
+  name: %s
+  namespace: default
+spec:
+  databaseRef: e2e
+  databaseSecretRef:
+    name: e2e-database
+`, applicationName))
+
+		By("waiting for the finalizer on the Application")
+		Eventually(func(g Gomega) {
+			finalizers, err := kubectl(consumerPath, "get", "application", applicationName, "-n", "default",
+				"-o", "jsonpath={.metadata.finalizers}")
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(finalizers).To(ContainSubstring(controller.FinalizerName))
+		}).Should(Succeed())
+
+		By("waiting for the Deployment, Service and Secret in the host cluster")
+		Eventually(func(g Gomega) {
+			g.Expect(hostObjects(g)).To(ConsistOf(
+				"deployment.apps/"+applicationName,
+				"service/"+applicationName,
+				"secret/"+applicationName+"-server",
+			))
+		}).Should(Succeed())
+	})
+
+	It("should remove the host objects and release the finalizer when the Application is deleted", func() {
+		By("deleting the Application")
+		_, err := kubectl(consumerPath, "delete", "application", applicationName, "-n", "default", "--wait=false")
+		Expect(err).NotTo(HaveOccurred(), "Failed to delete the Application")
+
+		By("waiting for the host objects to be removed")
+		Eventually(func(g Gomega) {
+			g.Expect(hostObjects(g)).To(BeEmpty())
+		}).Should(Succeed())
+
+		By("waiting for the Application to be gone, i.e. its finalizer to be released")
+		Eventually(func(g Gomega) {
+			output, err := kubectl(consumerPath, "get", "application", applicationName, "-n", "default",
+				"--ignore-not-found", "-o", "name")
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(strings.TrimSpace(output)).To(BeEmpty())
+		}).Should(Succeed())
+	})
+})
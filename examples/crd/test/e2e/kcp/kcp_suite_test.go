@@ -0,0 +1,160 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kcp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/kcp-dev/multicluster-provider/examples/crd/test/utils"
+)
+
+var (
+	// Required Environment Variables, the suite is skipped without them:
+	// - KCP_KUBECONFIG: kubeconfig of a kcp admin, pointing to the workspace
+	//   the test workspaces are created in, e.g. .kcp/admin.kubeconfig of
+	//   `kcp start`.
+	// - HOST_KUBECONFIG: kubeconfig of the host cluster the controller
+	//   creates the workloads in, e.g. a Kind cluster.
+	kcpKubeconfig  = os.Getenv("KCP_KUBECONFIG")
+	hostKubeconfig = os.Getenv("HOST_KUBECONFIG")
+
+	// controllerBinary is the controller built from the code source changes
+	// to be tested. It runs on the host of the tests.
+	controllerBinary = "bin/mcp-example-crd"
+)
+
+// TestKCP runs the end-to-end (e2e) test suite of the example against kcp. Unlike the Kind-based
+// suite in test/e2e, it serves the Application API from an APIExport, binds it in a consumer
+// workspace and runs the controller against the APIExport virtual workspace, with the host
+// cluster running the workloads.
+func TestKCP(t *testing.T) {
+	RegisterFailHandler(Fail)
+	_, _ = fmt.Fprintf(GinkgoWriter, "Starting crd kcp integration test suite\n")
+	RunSpecs(t, "e2e kcp suite")
+}
+
+var _ = BeforeSuite(func() {
+	if kcpKubeconfig == "" || hostKubeconfig == "" {
+		Skip("KCP_KUBECONFIG and HOST_KUBECONFIG must be set to run the kcp e2e tests")
+	}
+
+	By("building the controller binary")
+	cmd := exec.Command("go", "build", "-o", controllerBinary, "./cmd/main.go")
+	_, err := utils.Run(cmd)
+	ExpectWithOffset(1, err).NotTo(HaveOccurred(), "Failed to build the controller binary")
+})
+
+// kcpServer returns the base URL of kcp and the path of the workspace the
+// kubeconfig points to.
+func kcpServer() (base string, parent string) {
+	cmd := exec.Command("kubectl", "--kubeconfig", kcpKubeconfig,
+		"config", "view", "--minify", "-o", "jsonpath={.clusters[0].cluster.server}")
+	server, err := utils.Run(cmd)
+	ExpectWithOffset(1, err).NotTo(HaveOccurred(), "Failed to read the kcp server")
+
+	base, parent, found := strings.Cut(strings.TrimSpace(server), "/clusters/")
+	if !found {
+		parent = "root"
+	}
+	return base, strings.TrimSuffix(parent, "/")
+}
+
+// kubectl runs kubectl against the kcp workspace with the given path.
+func kubectl(path string, args ...string) (string, error) {
+	base, _ := kcpServer()
+	cmd := exec.Command("kubectl", append([]string{
+		"--kubeconfig", kcpKubeconfig,
+		"--server", base + "/clusters/" + path,
+	}, args...)...)
+	return utils.Run(cmd)
+}
+
+// apply applies the given manifest in the kcp workspace with the given path.
+func apply(path string, manifest string) {
+	base, _ := kcpServer()
+	cmd := exec.Command("kubectl", "--kubeconfig", kcpKubeconfig, "--server", base+"/clusters/"+path, "apply", "-f", "-")
+	cmd.Stdin = strings.NewReader(manifest)
+	_, err := utils.Run(cmd)
+	ExpectWithOffset(1, err).NotTo(HaveOccurred(), "Failed to apply manifest in workspace %s", path)
+}
+
+// createWorkspace creates a workspace in the parent workspace, waits for it to
+// be ready and returns its path and the name of its logical cluster.
+func createWorkspace(parent, name string) (path string, clusterName string) {
+	apply(parent, fmt.Sprintf(`apiVersion: tenancy.kcp.io/v1alpha1
+kind: Workspace
+metadata:
+  name: %s
+`, name))
+
+	_, err := kubectl(parent, "wait", "--for=jsonpath={.status.phase}=Ready", "workspace/"+name, "--timeout=2m")
+	ExpectWithOffset(1, err).NotTo(HaveOccurred(), "Workspace %s did not get ready", name)
+
+	clusterName, err = kubectl(parent, "get", "workspace", name, "-o", "jsonpath={.spec.cluster}")
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	ExpectWithOffset(1, clusterName).NotTo(BeEmpty(), "Workspace %s has no logical cluster", name)
+
+	return parent + ":" + name, strings.TrimSpace(clusterName)
+}
+
+// writeServingCert writes a self-signed serving certificate for localhost to
+// a temporary directory and returns it, for the webhook server of the
+// controller.
+func writeServingCert() string {
+	dir, err := os.MkdirTemp("", "crd-e2e-kcp-webhook-")
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	DeferCleanup(os.RemoveAll, dir)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+
+	ExpectWithOffset(1, os.WriteFile(filepath.Join(dir, "tls.crt"),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), 0o600)).To(Succeed())
+	ExpectWithOffset(1, os.WriteFile(filepath.Join(dir, "tls.key"),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)).To(Succeed())
+
+	return dir
+}
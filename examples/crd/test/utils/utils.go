@@ -197,7 +197,10 @@ func GetProjectDir() (string, error) {
 	if err != nil {
 		return wd, err
 	}
-	wd = strings.Replace(wd, "/test/e2e", "", -1)
+	// suites live in test/e2e and in packages below it.
+	if i := strings.LastIndex(wd, "/test/e2e"); i >= 0 {
+		wd = wd[:i]
+	}
 	return wd, nil
 }
 
@@ -24,6 +24,10 @@ import (
 
 	"github.com/kcp-dev/logicalcluster/v3"
 
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	toolscache "k8s.io/client-go/tools/cache"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
@@ -52,12 +56,9 @@ func (c *scopedCache) IndexField(ctx context.Context, obj client.Object, field s
 
 // Get returns a single object from the cache.
 func (c *scopedCache) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
-	inf, gvk, scope, found, err := c.base.getSharedInformer(obj)
+	inf, gvk, scope, err := c.getSharedInformer(ctx, obj)
 	if err != nil {
-		return fmt.Errorf("failed to get informer for %T %s: %w", obj, obj.GetObjectKind().GroupVersionKind(), err)
-	}
-	if !found {
-		//return fmt.Errorf("no informer found for %T %s", obj, obj.GetObjectKind().GroupVersionKind())
+		return err
 	}
 
 	cr := cacheReader{
@@ -73,12 +74,9 @@ func (c *scopedCache) Get(ctx context.Context, key client.ObjectKey, obj client.
 
 // List returns a list of objects from the cache.
 func (c *scopedCache) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
-	inf, gvk, scope, found, err := c.base.getSharedInformer(list)
+	inf, gvk, scope, err := c.getSharedInformer(ctx, list)
 	if err != nil {
-		return fmt.Errorf("failed to get informer for %T %s: %w", list, list.GetObjectKind().GroupVersionKind(), err)
-	}
-	if !found {
-		//return fmt.Errorf("no informer found for %T %s", list, list.GetObjectKind().GroupVersionKind())
+		return err
 	}
 
 	cr := cacheReader{
@@ -92,6 +90,42 @@ func (c *scopedCache) List(ctx context.Context, list client.ObjectList, opts ...
 	return cr.List(ctx, list, opts...)
 }
 
+// getSharedInformer returns the wildcard informer for the type of the given
+// object or list. Like the controller-runtime cache, it starts a missing
+// informer and waits for it to sync.
+func (c *scopedCache) getSharedInformer(ctx context.Context, obj runtime.Object) (toolscache.SharedIndexInformer, schema.GroupVersionKind, apimeta.RESTScopeName, error) {
+	inf, gvk, scope, found, err := c.base.getSharedInformer(obj)
+	if err != nil {
+		return nil, gvk, "", fmt.Errorf("failed to get informer for %T %s: %w", obj, gvk, err)
+	}
+	if found {
+		return inf, gvk, scope, nil
+	}
+
+	switch obj.(type) {
+	case runtime.Unstructured:
+		u := &unstructured.Unstructured{}
+		u.SetGroupVersionKind(gvk)
+		_, err = c.base.GetInformer(ctx, u)
+	case *metav1.PartialObjectMetadata, *metav1.PartialObjectMetadataList:
+		_, err = c.base.GetInformer(ctx, &metav1.PartialObjectMetadata{TypeMeta: metav1.TypeMeta{APIVersion: gvk.GroupVersion().String(), Kind: gvk.Kind}})
+	default:
+		_, err = c.base.GetInformerForKind(ctx, gvk)
+	}
+	if err != nil {
+		return nil, gvk, "", fmt.Errorf("failed to start informer for %T %s: %w", obj, gvk, err)
+	}
+
+	inf, gvk, scope, found, err = c.base.getSharedInformer(obj)
+	if err != nil {
+		return nil, gvk, "", fmt.Errorf("failed to get informer for %T %s: %w", obj, gvk, err)
+	}
+	if !found {
+		return nil, gvk, "", fmt.Errorf("no informer found for %T %s", obj, gvk)
+	}
+	return inf, gvk, scope, nil
+}
+
 // GetInformer returns an informer for the given object kind.
 func (c *scopedCache) GetInformer(ctx context.Context, obj client.Object, opts ...cache.InformerGetOption) (cache.Informer, error) {
 	inf, err := c.base.GetInformer(ctx, obj, opts...)
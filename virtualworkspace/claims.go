@@ -0,0 +1,256 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualworkspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	kcpcache "github.com/kcp-dev/apimachinery/v2/pkg/cache"
+	"github.com/kcp-dev/logicalcluster/v3"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/sdk/apis/apis/v1alpha1"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+)
+
+// ClaimNotAcceptedError is returned by scoped clients of a provider tracking
+// permission claims for requests to resources the APIExport claims, but no
+// APIBinding in the logical cluster accepted the claim for. The API server
+// would reject those requests as forbidden, which is also what
+// apierrors.IsForbidden reports for this error.
+type ClaimNotAcceptedError struct {
+	// Cluster is the logical cluster of the client.
+	Cluster logicalcluster.Name
+	// GroupResource is the claimed resource.
+	GroupResource schema.GroupResource
+}
+
+func (e *ClaimNotAcceptedError) Error() string {
+	return fmt.Sprintf("permission claim for %s has not been accepted in logical cluster %q", e.GroupResource, e.Cluster)
+}
+
+// Status implements apierrors.APIStatus.
+func (e *ClaimNotAcceptedError) Status() metav1.Status {
+	return metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusForbidden,
+		Reason:  metav1.StatusReasonForbidden,
+		Message: e.Error(),
+		Details: &metav1.StatusDetails{Group: e.GroupResource.Group, Kind: e.GroupResource.Resource},
+	}
+}
+
+// IsClaimNotAcceptedError returns true if the error, or any error it wraps,
+// is a ClaimNotAcceptedError.
+func IsClaimNotAcceptedError(err error) bool {
+	var target *ClaimNotAcceptedError
+	return errors.As(err, &target)
+}
+
+// PermissionClaimsGetter is implemented by the clusters of the provider.
+type PermissionClaimsGetter interface {
+	// AcceptedPermissionClaims returns the permission claims accepted by
+	// the APIBindings in the logical cluster.
+	AcceptedPermissionClaims() []apisv1alpha1.PermissionClaim
+}
+
+// AcceptedPermissionClaims returns the permission claims accepted in the
+// cluster, and false if the cluster is not a cluster of this provider.
+func AcceptedPermissionClaims(cl cluster.Cluster) ([]apisv1alpha1.PermissionClaim, bool) {
+	getter, ok := cl.(PermissionClaimsGetter)
+	if !ok {
+		return nil, false
+	}
+	return getter.AcceptedPermissionClaims(), true
+}
+
+// permissionClaims reads the permission claims of a logical cluster from the
+// APIBindings in the wildcard cache, so that they are always up to date.
+type permissionClaims struct {
+	bindings    toolscache.Indexer
+	clusterName logicalcluster.Name
+}
+
+// get returns the claims accepted in the logical cluster, and the resources
+// that are claimed by the APIExport and hence need an accepted claim.
+func (c *permissionClaims) get() (accepted []apisv1alpha1.PermissionClaim, claimed sets.Set[schema.GroupResource]) {
+	claimed = sets.New[schema.GroupResource]()
+
+	objs, err := c.bindings.ByIndex(kcpcache.ClusterIndexName, c.clusterName.String())
+	if err != nil {
+		return nil, claimed
+	}
+	for _, obj := range objs {
+		binding, ok := obj.(*apisv1alpha1.APIBinding)
+		if !ok {
+			continue
+		}
+		for _, claim := range binding.Status.ExportPermissionClaims {
+			claimed.Insert(schema.GroupResource{Group: claim.Group, Resource: claim.Resource})
+		}
+		for _, claim := range binding.Spec.PermissionClaims {
+			claimed.Insert(schema.GroupResource{Group: claim.Group, Resource: claim.Resource})
+			if claim.State == apisv1alpha1.ClaimAccepted {
+				accepted = append(accepted, claim.PermissionClaim)
+			}
+		}
+	}
+	return accepted, claimed
+}
+
+// check returns a ClaimNotAcceptedError if the resource is claimed, but the
+// claim has not been accepted.
+func (c *permissionClaims) check(gr schema.GroupResource) error {
+	accepted, claimed := c.get()
+	if !claimed.Has(gr) {
+		return nil
+	}
+	for _, claim := range accepted {
+		if claim.Group == gr.Group && claim.Resource == gr.Resource {
+			return nil
+		}
+	}
+	return &ClaimNotAcceptedError{Cluster: c.clusterName, GroupResource: gr}
+}
+
+var _ client.Client = &claimCheckingClient{}
+
+// claimCheckingClient fails requests to claimed resources without accepted
+// claim before they reach the API server.
+type claimCheckingClient struct {
+	client.Client
+	claims *permissionClaims
+}
+
+func (c *claimCheckingClient) check(obj runtime.Object) error {
+	gvk, err := c.GroupVersionKindFor(obj)
+	if err != nil {
+		// let the request fail as usual.
+		return nil
+	}
+	if apimeta.IsListType(obj) {
+		gvk.Kind = strings.TrimSuffix(gvk.Kind, "List")
+	}
+	mapping, err := c.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil
+	}
+	return c.claims.check(mapping.Resource.GroupResource())
+}
+
+func (c *claimCheckingClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	if err := c.check(obj); err != nil {
+		return err
+	}
+	return c.Client.Get(ctx, key, obj, opts...)
+}
+
+func (c *claimCheckingClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	if err := c.check(list); err != nil {
+		return err
+	}
+	return c.Client.List(ctx, list, opts...)
+}
+
+func (c *claimCheckingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if err := c.check(obj); err != nil {
+		return err
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *claimCheckingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if err := c.check(obj); err != nil {
+		return err
+	}
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func (c *claimCheckingClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if err := c.check(obj); err != nil {
+		return err
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func (c *claimCheckingClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	if err := c.check(obj); err != nil {
+		return err
+	}
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func (c *claimCheckingClient) DeleteAllOf(ctx context.Context, obj client.Object, opts ...client.DeleteAllOfOption) error {
+	if err := c.check(obj); err != nil {
+		return err
+	}
+	return c.Client.DeleteAllOf(ctx, obj, opts...)
+}
+
+func (c *claimCheckingClient) Status() client.SubResourceWriter {
+	return c.SubResource("status")
+}
+
+func (c *claimCheckingClient) SubResource(subResource string) client.SubResourceClient {
+	return &claimCheckingSubResourceClient{SubResourceClient: c.Client.SubResource(subResource), parent: c}
+}
+
+var _ client.SubResourceClient = &claimCheckingSubResourceClient{}
+
+type claimCheckingSubResourceClient struct {
+	client.SubResourceClient
+	parent *claimCheckingClient
+}
+
+func (c *claimCheckingSubResourceClient) Get(ctx context.Context, obj client.Object, subResource client.Object, opts ...client.SubResourceGetOption) error {
+	if err := c.parent.check(obj); err != nil {
+		return err
+	}
+	return c.SubResourceClient.Get(ctx, obj, subResource, opts...)
+}
+
+func (c *claimCheckingSubResourceClient) Create(ctx context.Context, obj client.Object, subResource client.Object, opts ...client.SubResourceCreateOption) error {
+	if err := c.parent.check(obj); err != nil {
+		return err
+	}
+	return c.SubResourceClient.Create(ctx, obj, subResource, opts...)
+}
+
+func (c *claimCheckingSubResourceClient) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+	if err := c.parent.check(obj); err != nil {
+		return err
+	}
+	return c.SubResourceClient.Update(ctx, obj, opts...)
+}
+
+func (c *claimCheckingSubResourceClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+	if err := c.parent.check(obj); err != nil {
+		return err
+	}
+	return c.SubResourceClient.Patch(ctx, obj, patch, opts...)
+}
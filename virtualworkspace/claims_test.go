@@ -0,0 +1,107 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualworkspace
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kcp-dev/multicluster-provider/virtualworkspace/fakeserver"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/sdk/apis/apis/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestProviderPermissionClaims(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sch := runtime.NewScheme()
+	require.NoError(t, scheme.AddToScheme(sch))
+	require.NoError(t, apisv1alpha1.AddToScheme(sch))
+
+	srv := fakeserver.New(sch, append(slices.Clone(fakeserver.DefaultResources), fakeserver.Resource{
+		GroupVersionKind: apisv1alpha1.SchemeGroupVersion.WithKind("APIBinding"),
+		Resource:         "apibindings",
+		Status:           true,
+	})...)
+	defer srv.Close()
+
+	cli, err := client.New(srv.ClusterConfig("foo"), client.Options{Scheme: sch})
+	require.NoError(t, err)
+	secretsClaim := apisv1alpha1.PermissionClaim{GroupResource: apisv1alpha1.GroupResource{Resource: "secrets"}, All: true}
+	binding := &apisv1alpha1.APIBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "binding"},
+		Spec: apisv1alpha1.APIBindingSpec{
+			PermissionClaims: []apisv1alpha1.AcceptablePermissionClaim{
+				{PermissionClaim: secretsClaim, State: apisv1alpha1.ClaimRejected},
+			},
+		},
+	}
+	require.NoError(t, cli.Create(ctx, binding))
+	require.NoError(t, cli.Create(ctx, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "a"}}))
+	require.NoError(t, cli.Create(ctx, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "a"}}))
+
+	p, err := New(srv.Config(), &apisv1alpha1.APIBinding{}, Options{
+		Scheme:                sch,
+		TrackPermissionClaims: true,
+	})
+	require.NoError(t, err)
+	defer p.Stop()
+
+	mgr := newEngagementRecorder()
+	go func() {
+		_ = p.Run(ctx, mgr)
+	}()
+	require.Eventually(t, func() bool {
+		return slices.Equal(mgr.active(), []string{"foo"})
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "cluster must be engaged")
+
+	cl, err := p.Get(ctx, "foo")
+	require.NoError(t, err)
+	claims, ok := AcceptedPermissionClaims(cl)
+	require.True(t, ok, "scoped cluster must expose permission claims")
+	require.Empty(t, claims, "rejected claim must not be accepted")
+
+	err = cl.GetClient().Get(ctx, client.ObjectKey{Namespace: "default", Name: "a"}, &corev1.Secret{})
+	require.True(t, IsClaimNotAcceptedError(err), "expected ClaimNotAcceptedError, got %v", err)
+	require.True(t, apierrors.IsForbidden(err), "ClaimNotAcceptedError must be forbidden")
+	err = cl.GetClient().List(ctx, &corev1.SecretList{})
+	require.True(t, IsClaimNotAcceptedError(err), "expected ClaimNotAcceptedError for list, got %v", err)
+	require.NoError(t, cl.GetClient().Get(ctx, client.ObjectKey{Namespace: "default", Name: "a"}, &corev1.ConfigMap{}),
+		"unclaimed resources must not be checked")
+
+	binding.Spec.PermissionClaims[0].State = apisv1alpha1.ClaimAccepted
+	require.NoError(t, cli.Update(ctx, binding))
+	require.Eventually(t, func() bool {
+		claims, _ := AcceptedPermissionClaims(cl)
+		return len(claims) == 1 && claims[0].GroupResource == secretsClaim.GroupResource
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "accepted claim must be exposed")
+	require.NoError(t, cl.GetClient().Get(ctx, client.ObjectKey{Namespace: "default", Name: "a"}, &corev1.Secret{}),
+		"requests must pass once the claim is accepted")
+}
@@ -23,25 +23,66 @@ import (
 	"net/http"
 	"net/url"
 
+	"github.com/go-logr/logr"
 	"github.com/kcp-dev/logicalcluster/v3"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/sdk/apis/apis/v1alpha1"
 
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/flowcontrol"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 	"sigs.k8s.io/controller-runtime/pkg/cluster"
 )
 
-func newScopedCluster(cfg *rest.Config, clusterName logicalcluster.Name, wildcardCA WildcardCache, scheme *runtime.Scheme) (*scopedCluster, error) {
+// scopedClusterOptions are the optional settings of a scoped cluster.
+type scopedClusterOptions struct {
+	// rateLimiter replaces the rate limiter of the rest.Config if set.
+	rateLimiter flowcontrol.RateLimiter
+	// guardWrites rejects writes of objects of other logical clusters.
+	guardWrites bool
+	// tracerProvider records spans for all requests if set. Their span
+	// context is propagated to the server with propagator.
+	tracerProvider trace.TracerProvider
+	propagator     propagation.TextMapPropagator
+	// workspacePath is the workspace path of the logical cluster, if known.
+	workspacePath logicalcluster.Path
+	// logger logs all requests if set.
+	logger *logr.Logger
+	// impersonate is the identity all requests are made as, if set.
+	impersonate *rest.ImpersonationConfig
+	// claims makes the client fail requests to claimed resources whose claim
+	// has not been accepted, if set.
+	claims *permissionClaims
+}
+
+func newScopedCluster(cfg *rest.Config, clusterName logicalcluster.Name, wildcardCA WildcardCache, scheme *runtime.Scheme, opts scopedClusterOptions) (*scopedCluster, error) {
 	cfg = rest.CopyConfig(cfg)
 	host, err := url.JoinPath(cfg.Host, clusterName.Path().RequestPath())
 	if err != nil {
 		return nil, fmt.Errorf("failed to construct scoped cluster URL: %w", err)
 	}
 	cfg.Host = host
+	if opts.rateLimiter != nil {
+		cfg.RateLimiter = opts.rateLimiter
+	}
+	if opts.impersonate != nil {
+		cfg.Impersonate = *opts.impersonate
+	}
+	if opts.tracerProvider != nil {
+		cfg = withTracing(cfg, opts.tracerProvider, opts.propagator, clusterAttributes(clusterName, opts.workspacePath)...)
+	}
+	if opts.logger != nil {
+		cfg.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			return &loggingRoundTripper{delegate: rt, log: *opts.logger}
+		})
+	}
 
 	// construct a scoped cache that uses the wildcard cache as base.
 	ca := &scopedCache{
@@ -59,6 +100,12 @@ func newScopedCluster(cfg *rest.Config, clusterName logicalcluster.Name, wildcar
 	if err != nil {
 		return nil, err
 	}
+	if opts.guardWrites {
+		cli = newGuardedClient(cli, clusterName)
+	}
+	if opts.claims != nil {
+		cli = &claimCheckingClient{Client: cli, claims: opts.claims}
+	}
 
 	httpClient, err := rest.HTTPClientFor(cfg)
 	if err != nil {
@@ -78,6 +125,7 @@ func newScopedCluster(cfg *rest.Config, clusterName logicalcluster.Name, wildcar
 		httpClient:  httpClient,
 		mapper:      mapper,
 		cache:       ca,
+		claims:      opts.claims,
 	}, nil
 }
 
@@ -93,6 +141,7 @@ type scopedCluster struct {
 	client     client.Client
 	mapper     meta.RESTMapper
 	cache      cache.Cache
+	claims     *permissionClaims
 }
 
 func (c *scopedCluster) GetHTTPClient() *http.Client {
@@ -135,6 +184,17 @@ func (c *scopedCluster) GetAPIReader() client.Reader {
 	return c.cache
 }
 
+// AcceptedPermissionClaims returns the permission claims accepted by the
+// APIBindings in the logical cluster. It returns nil if the provider does not
+// track permission claims.
+func (c *scopedCluster) AcceptedPermissionClaims() []apisv1alpha1.PermissionClaim {
+	if c.claims == nil {
+		return nil
+	}
+	accepted, _ := c.claims.get()
+	return accepted
+}
+
 // Start starts the cluster.
 func (c *scopedCluster) Start(ctx context.Context) error {
 	return errors.New("scoped cluster cannot be started")
@@ -0,0 +1,173 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualworkspace
+
+import (
+	"cmp"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"time"
+
+	kcpcache "github.com/kcp-dev/apimachinery/v2/pkg/cache"
+	"github.com/kcp-dev/logicalcluster/v3"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	k8scache "k8s.io/client-go/tools/cache"
+)
+
+// DebugState is the state of a provider as served by Provider.DebugHandler.
+type DebugState struct {
+	// Clusters are the engaged logical clusters and those whose last
+	// reconciliation failed, sorted by name.
+	Clusters []ClusterDebugState `json:"clusters"`
+	// Informers are the informers of the wildcard cache, sorted by flavour
+	// and type. They are only known for caches created by NewWildcardCache.
+	Informers []InformerDebugState `json:"informers,omitempty"`
+}
+
+// ClusterDebugState is the state of a logical cluster known to the provider.
+type ClusterDebugState struct {
+	Name    logicalcluster.Name `json:"name"`
+	Engaged bool                `json:"engaged"`
+	// EngagedSince is when the cluster was engaged.
+	EngagedSince *time.Time `json:"engagedSince,omitempty"`
+	// IneligibleSince is when the engaged cluster stopped being eligible for
+	// engagement, while it waits for the disengage grace period.
+	IneligibleSince *time.Time `json:"ineligibleSince,omitempty"`
+	// LastError is the error of the last reconciliation of the cluster, if
+	// it failed. It is retried with backoff.
+	LastError     string     `json:"lastError,omitempty"`
+	LastErrorTime *time.Time `json:"lastErrorTime,omitempty"`
+}
+
+// InformerDebugState is the state of an informer of the wildcard cache.
+type InformerDebugState struct {
+	// Flavour is the kind of objects the informer serves: structured,
+	// unstructured or metadata.
+	Flavour    string `json:"flavour"`
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Synced     bool   `json:"synced"`
+	// Objects is the number of objects in the informer per logical cluster.
+	Objects map[logicalcluster.Name]int `json:"objects"`
+}
+
+// informerLister is implemented by wildcard caches that can list their
+// informers.
+type informerLister interface {
+	debugInformers() []InformerDebugState
+}
+
+// DebugHandler returns an HTTP handler serving the DebugState of the provider
+// as JSON, to find out why objects of a logical cluster are not reconciled.
+// Mount it on the metrics server of the manager, which is protected like the
+// metrics, e.g. with mgr.AddMetricsServerExtraHandler("/debug/kcp", h). The
+// state lists the names of all engaged logical clusters.
+func (p *Provider) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(p.debugState()); err != nil {
+			p.log.Error(err, "failed to write debug state")
+		}
+	})
+}
+
+// debugState returns the current DebugState of the provider.
+func (p *Provider) debugState() DebugState {
+	state := DebugState{Clusters: []ClusterDebugState{}}
+
+	p.lock.RLock()
+	names := sets.KeySet(p.clusters).Union(sets.KeySet(p.failures))
+	for _, clusterName := range sets.List(names) {
+		cs := ClusterDebugState{Name: clusterName}
+		if _, ok := p.clusters[clusterName]; ok {
+			cs.Engaged = true
+		}
+		if since, ok := p.engagedSince[clusterName]; ok {
+			cs.EngagedSince = &since
+		}
+		if since, ok := p.ineligibleSince[clusterName]; ok {
+			cs.IneligibleSince = &since
+		}
+		if failure, ok := p.failures[clusterName]; ok {
+			cs.LastError = failure.err.Error()
+			cs.LastErrorTime = &failure.at
+		}
+		state.Clusters = append(state.Clusters, cs)
+	}
+	p.lock.RUnlock()
+
+	if lister, ok := p.cache.(informerLister); ok {
+		state.Informers = lister.debugInformers()
+	}
+	return state
+}
+
+// debugInformers implements informerLister.
+func (c *wildcardCache) debugInformers() []InformerDebugState {
+	c.tracker.lock.RLock()
+	var infs []InformerDebugState
+	for flavour, byGVK := range map[string]map[schema.GroupVersionKind]k8scache.SharedIndexInformer{
+		"structured":   c.tracker.Structured,
+		"unstructured": c.tracker.Unstructured,
+		"metadata":     c.tracker.Metadata,
+	} {
+		for gvk, inf := range byGVK {
+			infs = append(infs, InformerDebugState{
+				Flavour:    flavour,
+				APIVersion: gvk.GroupVersion().String(),
+				Kind:       gvk.Kind,
+				Synced:     inf.HasSynced(),
+				Objects:    objectsPerCluster(inf.GetIndexer()),
+			})
+		}
+	}
+	c.tracker.lock.RUnlock()
+
+	slices.SortFunc(infs, func(a, b InformerDebugState) int {
+		return cmp.Or(
+			cmp.Compare(a.Flavour, b.Flavour),
+			cmp.Compare(a.APIVersion, b.APIVersion),
+			cmp.Compare(a.Kind, b.Kind),
+		)
+	})
+	return infs
+}
+
+// objectsPerCluster counts the objects in the indexer per logical cluster by
+// the cluster index.
+func objectsPerCluster(indexer k8scache.Indexer) map[logicalcluster.Name]int {
+	counts := map[logicalcluster.Name]int{}
+	for _, key := range indexer.ListIndexFuncValues(kcpcache.ClusterIndexName) {
+		objs, err := indexer.ByIndex(kcpcache.ClusterIndexName, key)
+		if err != nil || len(objs) == 0 {
+			continue
+		}
+		counts[logicalcluster.Name(key)] = len(objs)
+	}
+	return counts
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualworkspace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kcp-dev/logicalcluster/v3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kcp-dev/multicluster-provider/virtualworkspace/fakeserver"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/rest"
+)
+
+func TestProviderDebugHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := fakeserver.New(nil)
+	defer srv.Close()
+	createConfigMap(t, srv, "foo", "a")
+	createConfigMap(t, srv, "foo", "b")
+	createConfigMap(t, srv, "bar", "a")
+
+	p, err := New(srv.Config(), &corev1.ConfigMap{}, Options{
+		Impersonate: func(_ context.Context, clusterName logicalcluster.Name) (*rest.ImpersonationConfig, error) {
+			if clusterName == "bar" {
+				return nil, errors.New("no identity")
+			}
+			return nil, nil
+		},
+	})
+	require.NoError(t, err)
+	defer p.Stop()
+	mgr := newEngagementRecorder()
+	go func() {
+		_ = p.Run(ctx, mgr)
+	}()
+	require.Eventually(t, func() bool {
+		return slices.Equal(mgr.active(), []string{"foo"})
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "foo must be engaged")
+
+	get := func() DebugState {
+		rec := httptest.NewRecorder()
+		p.DebugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/kcp", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+		var state DebugState
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &state))
+		return state
+	}
+	require.Eventually(t, func() bool {
+		state := get()
+		return len(state.Clusters) == 2 && state.Clusters[0].LastError != ""
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "failed engagement of bar must be reported")
+
+	state := get()
+	bar, foo := state.Clusters[0], state.Clusters[1]
+	require.Equal(t, logicalcluster.Name("bar"), bar.Name)
+	require.False(t, bar.Engaged)
+	require.Nil(t, bar.EngagedSince)
+	require.Contains(t, bar.LastError, "no identity")
+	require.NotNil(t, bar.LastErrorTime)
+	require.Equal(t, logicalcluster.Name("foo"), foo.Name)
+	require.True(t, foo.Engaged)
+	require.NotNil(t, foo.EngagedSince)
+	require.Empty(t, foo.LastError)
+
+	require.Equal(t, []InformerDebugState{{
+		Flavour:    "structured",
+		APIVersion: "v1",
+		Kind:       "ConfigMap",
+		Synced:     true,
+		Objects:    map[logicalcluster.Name]int{"foo": 2, "bar": 1},
+	}}, state.Informers)
+
+	rec := httptest.NewRecorder()
+	p.DebugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/debug/kcp", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
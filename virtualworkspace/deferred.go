@@ -0,0 +1,477 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualworkspace
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	kcpcache "github.com/kcp-dev/apimachinery/v2/pkg/cache"
+	kcpinformers "github.com/kcp-dev/apimachinery/v2/third_party/informers"
+	"github.com/kcp-dev/logicalcluster/v3"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/sdk/apis/apis/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	k8scache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// deferredClaims starts and stops the informers of claimed resources
+// depending on whether the APIBinding of any engaged logical cluster accepts
+// the claim. Before, the virtual workspace does not serve the resource for
+// any logical cluster, so that a wildcard informer would only fail or watch
+// nothing.
+//
+// Only the APIBindings of logical clusters engaged by the provider count, so
+// that a replica does not watch claimed resources for clusters owned by
+// other replicas or rejected by the engagement filter.
+type deferredClaims struct {
+	cache     *wildcardCache
+	resources sets.Set[schema.GroupResource]
+
+	// lock is held for writing while informers are started or stopped, and
+	// for reading while the cache is read for a deferred resource.
+	lock      sync.RWMutex
+	accepted  sets.Set[schema.GroupResource]
+	informers map[informerKey]*deferredInformer
+
+	// claims are the accepted deferred claims by logical cluster and
+	// APIBinding name, engaged is the number of running engagements by
+	// logical cluster, and acceptedBy is the number of APIBindings of engaged
+	// logical clusters accepting each resource.
+	claims     map[logicalcluster.Name]map[string]sets.Set[schema.GroupResource]
+	engaged    map[logicalcluster.Name]int
+	acceptedBy map[schema.GroupResource]int
+}
+
+// informerKey identifies an informer of the wildcard cache the same way the
+// controller-runtime cache does: by GroupVersionKind and object flavour.
+type informerKey struct {
+	gvk      schema.GroupVersionKind
+	flavour  string
+	resource schema.GroupResource
+}
+
+func newDeferredClaims(c *wildcardCache, resources []schema.GroupResource) *deferredClaims {
+	return &deferredClaims{
+		cache:     c,
+		resources: sets.New(resources...),
+		accepted:  sets.New[schema.GroupResource](),
+		informers: map[informerKey]*deferredInformer{},
+
+		claims:     map[logicalcluster.Name]map[string]sets.Set[schema.GroupResource]{},
+		engaged:    map[logicalcluster.Name]int{},
+		acceptedBy: map[schema.GroupResource]int{},
+	}
+}
+
+// watchBindings registers the handler that updates the accepted claims from
+// the APIBindings of all logical clusters. The APIBinding informer starts
+// with the cache. The claims only count once their logical cluster is engaged.
+func (d *deferredClaims) watchBindings(ctx context.Context) error {
+	inf, err := d.cache.Cache.GetInformer(ctx, &apisv1alpha1.APIBinding{}, cache.BlockUntilSynced(false))
+	if err != nil {
+		return fmt.Errorf("failed to get APIBinding informer: %w", err)
+	}
+	_, err = inf.AddEventHandler(k8scache.ResourceEventHandlerFuncs{
+		AddFunc:    d.updateBinding,
+		UpdateFunc: func(_, obj any) { d.updateBinding(obj) },
+		DeleteFunc: d.deleteBinding,
+	})
+	return err
+}
+
+func (d *deferredClaims) updateBinding(obj any) {
+	binding, ok := obj.(*apisv1alpha1.APIBinding)
+	if !ok {
+		return
+	}
+	accepted := sets.New[schema.GroupResource]()
+	if binding.DeletionTimestamp == nil {
+		for _, claim := range binding.Spec.PermissionClaims {
+			gr := schema.GroupResource{Group: claim.Group, Resource: claim.Resource}
+			if claim.State == apisv1alpha1.ClaimAccepted && d.resources.Has(gr) {
+				accepted.Insert(gr)
+			}
+		}
+	}
+	d.setClaims(logicalcluster.From(binding), binding.Name, accepted)
+}
+
+func (d *deferredClaims) deleteBinding(obj any) {
+	key, err := kcpcache.DeletionHandlingMetaClusterNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("failed to get key of APIBinding: %w", err))
+		return
+	}
+	clusterName, _, name, err := kcpcache.SplitMetaClusterNamespaceKey(key)
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("failed to split key of APIBinding: %w", err))
+		return
+	}
+	d.setClaims(clusterName, name, nil)
+}
+
+// isDeferred returns whether informers of the resource are deferred.
+func (d *deferredClaims) isDeferred(gr schema.GroupResource) bool {
+	return d.resources.Has(gr)
+}
+
+// setClaims records the accepted deferred claims of the APIBinding with the
+// given name in the logical cluster. If the cluster is engaged, it starts the
+// informers of resources whose claim got accepted by the first APIBinding,
+// and stops those of resources no APIBinding accepts anymore.
+func (d *deferredClaims) setClaims(clusterName logicalcluster.Name, name string, accepted sets.Set[schema.GroupResource]) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	previous := d.claims[clusterName][name]
+	if previous.Equal(accepted) {
+		return
+	}
+	switch {
+	case accepted.Len() > 0 && d.claims[clusterName] == nil:
+		d.claims[clusterName] = map[string]sets.Set[schema.GroupResource]{name: accepted}
+	case accepted.Len() > 0:
+		d.claims[clusterName][name] = accepted
+	default:
+		delete(d.claims[clusterName], name)
+		if len(d.claims[clusterName]) == 0 {
+			delete(d.claims, clusterName)
+		}
+	}
+
+	if d.engaged[clusterName] == 0 {
+		return
+	}
+	changed := d.count(previous.Difference(accepted), -1)
+	changed = changed.Union(d.count(accepted.Difference(previous), 1))
+	d.apply(changed)
+}
+
+// engage counts the accepted claims of the logical cluster until the
+// returned function is called when the cluster is disengaged. Engagements
+// may overlap, the claims count while any is running.
+func (d *deferredClaims) engage(clusterName logicalcluster.Name) (disengage func()) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.engaged[clusterName]++
+	if d.engaged[clusterName] == 1 {
+		d.apply(d.countCluster(clusterName, 1))
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			d.lock.Lock()
+			defer d.lock.Unlock()
+
+			d.engaged[clusterName]--
+			if d.engaged[clusterName] == 0 {
+				delete(d.engaged, clusterName)
+				d.apply(d.countCluster(clusterName, -1))
+			}
+		})
+	}
+}
+
+// countCluster adds delta to the number of APIBindings accepting the claims
+// of all APIBindings of the logical cluster. It returns the resources whose
+// claims got accepted or are not accepted anymore. The caller must hold the
+// lock.
+func (d *deferredClaims) countCluster(clusterName logicalcluster.Name, delta int) sets.Set[schema.GroupResource] {
+	changed := sets.New[schema.GroupResource]()
+	for _, accepted := range d.claims[clusterName] {
+		changed = changed.Union(d.count(accepted, delta))
+	}
+	return changed
+}
+
+// count adds delta to the number of APIBindings accepting the given
+// resources. It returns the resources whose claims got accepted or are not
+// accepted anymore. The caller must hold the lock.
+func (d *deferredClaims) count(resources sets.Set[schema.GroupResource], delta int) sets.Set[schema.GroupResource] {
+	changed := sets.New[schema.GroupResource]()
+	for gr := range resources {
+		d.acceptedBy[gr] += delta
+		switch {
+		case d.acceptedBy[gr] <= 0:
+			delete(d.acceptedBy, gr)
+			if d.accepted.Has(gr) {
+				d.accepted.Delete(gr)
+				changed.Insert(gr)
+			}
+		case !d.accepted.Has(gr):
+			d.accepted.Insert(gr)
+			changed.Insert(gr)
+		}
+	}
+	return changed
+}
+
+// apply starts or stops the informers of the given resources according to
+// whether their claims are accepted. The caller must hold the lock.
+func (d *deferredClaims) apply(changed sets.Set[schema.GroupResource]) {
+	for _, inf := range d.informers {
+		switch {
+		case !changed.Has(inf.key.resource):
+		case d.accepted.Has(inf.key.resource):
+			inf.start()
+		default:
+			inf.stop()
+		}
+	}
+}
+
+// informer returns the deferred informer for the given object, creating and,
+// if its claim is accepted, starting it if necessary.
+func (d *deferredClaims) informer(key informerKey, obj client.Object) *deferredInformer {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	inf, ok := d.informers[key]
+	if !ok {
+		inf = newDeferredInformer(d.cache, key, obj)
+		d.informers[key] = inf
+		if d.accepted.Has(key.resource) {
+			inf.start()
+		}
+	}
+	return inf
+}
+
+// placeholder returns the never started informer standing in for a deferred
+// informer while its claim is not accepted, and false if the informer is
+// running or unknown.
+func (d *deferredClaims) placeholder(key informerKey) (k8scache.SharedIndexInformer, bool) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	inf, ok := d.informers[key]
+	if !ok || inf.active != nil {
+		return nil, false
+	}
+	return inf.placeholder, true
+}
+
+var _ cache.Informer = &deferredInformer{}
+
+// deferredInformer is the informer handed out for a deferred resource. It
+// keeps the event handlers and indexers added to it, and adds them to the
+// wildcard informer whenever it is started. Objects disappearing because the
+// informer is stopped are not delivered as deletions.
+type deferredInformer struct {
+	cache *wildcardCache
+	key   informerKey
+	obj   client.Object
+
+	// placeholder is an empty informer with the same indexers, serving reads
+	// while the informer is stopped.
+	placeholder k8scache.SharedIndexInformer
+
+	lock     sync.Mutex
+	active   cache.Informer
+	handlers map[*deferredRegistration]struct{}
+	indexers k8scache.Indexers
+}
+
+func newDeferredInformer(c *wildcardCache, key informerKey, obj client.Object) *deferredInformer {
+	return &deferredInformer{
+		cache: c,
+		key:   key,
+		obj:   obj,
+		placeholder: kcpinformers.NewSharedIndexInformer(nil, obj, 0, k8scache.Indexers{
+			kcpcache.ClusterIndexName:             ClusterIndexFunc,
+			kcpcache.ClusterAndNamespaceIndexName: ClusterAndNamespaceIndexFunc,
+		}),
+		handlers: map[*deferredRegistration]struct{}{},
+		indexers: k8scache.Indexers{},
+	}
+}
+
+// start creates the wildcard informer and adds all handlers and indexers.
+func (i *deferredInformer) start() {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if i.active != nil {
+		return
+	}
+
+	inf, err := i.cache.Cache.GetInformer(context.Background(), i.obj, cache.BlockUntilSynced(false))
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("failed to start informer for claimed %s: %w", i.key.resource, err))
+		return
+	}
+	if len(i.indexers) > 0 {
+		if err := inf.AddIndexers(i.indexers); err != nil {
+			utilruntime.HandleError(fmt.Errorf("failed to add indexers for claimed %s: %w", i.key.resource, err))
+		}
+	}
+	for reg := range i.handlers {
+		if err := reg.register(inf); err != nil {
+			utilruntime.HandleError(fmt.Errorf("failed to add event handler for claimed %s: %w", i.key.resource, err))
+		}
+	}
+	i.active = inf
+}
+
+// stop stops and removes the wildcard informer. Handlers and indexers are
+// kept for the next start.
+func (i *deferredInformer) stop() {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if i.active == nil {
+		return
+	}
+
+	for reg := range i.handlers {
+		reg.unregister(i.active)
+	}
+	if err := i.cache.Cache.RemoveInformer(context.Background(), i.obj); err != nil {
+		utilruntime.HandleError(fmt.Errorf("failed to stop informer for claimed %s: %w", i.key.resource, err))
+	}
+	i.cache.tracker.remove(i.obj, i.key.gvk)
+	i.active = nil
+}
+
+func (i *deferredInformer) AddEventHandler(handler k8scache.ResourceEventHandler) (k8scache.ResourceEventHandlerRegistration, error) {
+	return i.addEventHandler(&deferredRegistration{handler: handler})
+}
+
+func (i *deferredInformer) AddEventHandlerWithResyncPeriod(handler k8scache.ResourceEventHandler, resyncPeriod time.Duration) (k8scache.ResourceEventHandlerRegistration, error) {
+	return i.addEventHandler(&deferredRegistration{handler: handler, resyncPeriod: &resyncPeriod})
+}
+
+func (i *deferredInformer) addEventHandler(reg *deferredRegistration) (k8scache.ResourceEventHandlerRegistration, error) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if i.active != nil {
+		if err := reg.register(i.active); err != nil {
+			return nil, err
+		}
+	}
+	i.handlers[reg] = struct{}{}
+	return reg, nil
+}
+
+func (i *deferredInformer) RemoveEventHandler(handle k8scache.ResourceEventHandlerRegistration) error {
+	reg, ok := handle.(*deferredRegistration)
+	if !ok {
+		return fmt.Errorf("unexpected event handler registration %T", handle)
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if i.active != nil {
+		reg.unregister(i.active)
+	}
+	delete(i.handlers, reg)
+	return nil
+}
+
+func (i *deferredInformer) AddIndexers(indexers k8scache.Indexers) error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if err := i.placeholder.AddIndexers(indexers); err != nil {
+		return err
+	}
+	if i.active != nil {
+		if err := i.active.AddIndexers(indexers); err != nil {
+			return err
+		}
+	}
+	for name, fn := range indexers {
+		i.indexers[name] = fn
+	}
+	return nil
+}
+
+// HasSynced returns true while the informer is stopped, as there is nothing
+// to sync.
+func (i *deferredInformer) HasSynced() bool {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	return i.active == nil || i.active.HasSynced()
+}
+
+// IsStopped returns false, as the informer is restarted whenever its claim
+// gets accepted.
+func (i *deferredInformer) IsStopped() bool {
+	return false
+}
+
+var _ k8scache.ResourceEventHandlerRegistration = &deferredRegistration{}
+
+// deferredRegistration is an event handler of a deferredInformer, registered
+// with the wildcard informer while it runs.
+type deferredRegistration struct {
+	handler      k8scache.ResourceEventHandler
+	resyncPeriod *time.Duration
+
+	lock   sync.Mutex
+	active k8scache.ResourceEventHandlerRegistration
+}
+
+func (r *deferredRegistration) register(inf cache.Informer) error {
+	var (
+		reg k8scache.ResourceEventHandlerRegistration
+		err error
+	)
+	if r.resyncPeriod != nil {
+		reg, err = inf.AddEventHandlerWithResyncPeriod(r.handler, *r.resyncPeriod)
+	} else {
+		reg, err = inf.AddEventHandler(r.handler)
+	}
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.active = reg
+	return nil
+}
+
+func (r *deferredRegistration) unregister(inf cache.Informer) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.active == nil {
+		return
+	}
+	if err := inf.RemoveEventHandler(r.active); err != nil {
+		utilruntime.HandleError(fmt.Errorf("failed to remove event handler: %w", err))
+	}
+	r.active = nil
+}
+
+// HasSynced returns true while the informer is stopped, as there is nothing
+// to sync.
+func (r *deferredRegistration) HasSynced() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.active == nil || r.active.HasSynced()
+}
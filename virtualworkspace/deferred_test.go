@@ -0,0 +1,184 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualworkspace
+
+import (
+	"context"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kcp-dev/multicluster-provider/virtualworkspace/fakeserver"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/sdk/apis/apis/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/scheme"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestWildcardCacheDeferredClaims(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sch := runtime.NewScheme()
+	require.NoError(t, scheme.AddToScheme(sch))
+	require.NoError(t, apisv1alpha1.AddToScheme(sch))
+
+	srv := fakeserver.New(sch, append(slices.Clone(fakeserver.DefaultResources), fakeserver.Resource{
+		GroupVersionKind: apisv1alpha1.SchemeGroupVersion.WithKind("APIBinding"),
+		Resource:         "apibindings",
+		Status:           true,
+	})...)
+	defer srv.Close()
+
+	cli, err := client.New(srv.ClusterConfig("foo"), client.Options{Scheme: sch})
+	require.NoError(t, err)
+	require.NoError(t, cli.Create(ctx, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "a"}}))
+	binding := &apisv1alpha1.APIBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "binding"},
+		Spec: apisv1alpha1.APIBindingSpec{
+			PermissionClaims: []apisv1alpha1.AcceptablePermissionClaim{{
+				PermissionClaim: apisv1alpha1.PermissionClaim{GroupResource: apisv1alpha1.GroupResource{Resource: "secrets"}, All: true},
+				State:           apisv1alpha1.ClaimRejected,
+			}},
+		},
+	}
+	require.NoError(t, cli.Create(ctx, binding))
+
+	wc, err := NewWildcardCacheWithOptions(srv.Config(), cache.Options{Scheme: sch}, WildcardCacheOptions{
+		DeferredClaims: []schema.GroupResource{{Resource: "secrets"}},
+	})
+	require.NoError(t, err)
+	go func() {
+		_ = wc.Start(ctx)
+	}()
+	require.True(t, wc.WaitForCacheSync(ctx))
+	engagementCtx, disengage := context.WithCancel(ctx)
+	wc.(engagementTracker).trackEngagement(engagementCtx, "foo")
+
+	inf, err := wc.GetInformer(ctx, &corev1.Secret{})
+	require.NoError(t, err)
+	var added atomic.Int32
+	_, err = inf.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(any) { added.Add(1) },
+	})
+	require.NoError(t, err)
+
+	require.Never(t, func() bool {
+		return added.Load() > 0
+	}, 200*time.Millisecond, 10*time.Millisecond, "informer must not start before the claim is accepted")
+	secrets := &corev1.SecretList{}
+	require.NoError(t, wc.List(ctx, secrets))
+	require.Empty(t, secrets.Items)
+	err = wc.Get(ctx, client.ObjectKey{Namespace: "default", Name: "a"}, &corev1.Secret{})
+	require.True(t, apierrors.IsNotFound(err), "expected NotFound, got %v", err)
+	_, _, _, found, err := wc.getSharedInformer(&corev1.Secret{})
+	require.NoError(t, err)
+	require.True(t, found, "deferred informer must be served by a placeholder")
+
+	binding.Spec.PermissionClaims[0].State = apisv1alpha1.ClaimAccepted
+	require.NoError(t, cli.Update(ctx, binding))
+	require.Eventually(t, func() bool {
+		return added.Load() == 1
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "handlers must be added once the claim is accepted")
+	require.Eventually(t, func() bool {
+		secrets := &corev1.SecretList{}
+		return wc.List(ctx, secrets) == nil && len(secrets.Items) == 1
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "secrets must be read once the claim is accepted")
+
+	binding.Spec.PermissionClaims[0].State = apisv1alpha1.ClaimRejected
+	require.NoError(t, cli.Update(ctx, binding))
+	require.Eventually(t, func() bool {
+		shInf, _, _, found, err := wc.getSharedInformer(&corev1.Secret{})
+		return err == nil && found && len(shInf.GetStore().List()) == 0
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "informer must stop when no claim is accepted")
+
+	binding.Spec.PermissionClaims[0].State = apisv1alpha1.ClaimAccepted
+	require.NoError(t, cli.Update(ctx, binding))
+	require.Eventually(t, func() bool {
+		return added.Load() == 2
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "handlers must be re-added when the claim is accepted again")
+
+	disengage()
+	require.Eventually(t, func() bool {
+		shInf, _, _, found, err := wc.getSharedInformer(&corev1.Secret{})
+		return err == nil && found && len(shInf.GetStore().List()) == 0
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "informer must stop when the accepting cluster is disengaged")
+}
+
+func TestDeferredClaimsAcceptedBy(t *testing.T) {
+	secrets := schema.GroupResource{Resource: "secrets"}
+	configMaps := schema.GroupResource{Resource: "configmaps"}
+	d := newDeferredClaims(nil, []schema.GroupResource{secrets, configMaps})
+	disengageFoo := d.engage("foo")
+	disengageBar := d.engage("bar")
+
+	d.setClaims("foo", "binding", sets.New(secrets))
+	d.setClaims("bar", "binding", sets.New(secrets, configMaps))
+	require.Equal(t, sets.New(secrets, configMaps), d.accepted)
+
+	d.setClaims("bar", "binding", sets.New(secrets))
+	require.Equal(t, sets.New(secrets), d.accepted, "claims no APIBinding accepts anymore must be dropped")
+
+	d.setClaims("bar", "binding", nil)
+	require.Equal(t, sets.New(secrets), d.accepted, "claims must stay accepted while any APIBinding accepts them")
+
+	d.setClaims("foo", "binding", nil)
+	require.Empty(t, d.accepted)
+	require.Empty(t, d.claims)
+	require.Empty(t, d.acceptedBy)
+
+	disengageFoo()
+	disengageBar()
+	require.Empty(t, d.engaged)
+}
+
+func TestDeferredClaimsEngagedOnly(t *testing.T) {
+	secrets := schema.GroupResource{Resource: "secrets"}
+	d := newDeferredClaims(nil, []schema.GroupResource{secrets})
+
+	d.setClaims("foo", "binding", sets.New(secrets))
+	require.Empty(t, d.accepted, "claims of clusters that are not engaged must not count")
+
+	disengage := d.engage("foo")
+	require.Equal(t, sets.New(secrets), d.accepted, "claims must count once their cluster is engaged")
+
+	// overlapping engagements, e.g. while a cluster is re-engaged, keep the
+	// claims until the last one ends.
+	disengageAgain := d.engage("foo")
+	disengage()
+	disengage()
+	require.Equal(t, sets.New(secrets), d.accepted)
+	disengageAgain()
+	require.Empty(t, d.accepted, "claims must not count once their cluster is disengaged")
+	require.Empty(t, d.acceptedBy)
+
+	d.setClaims("foo", "binding", nil)
+	require.Empty(t, d.claims)
+}
@@ -0,0 +1,266 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualworkspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	kcpcache "github.com/kcp-dev/apimachinery/v2/pkg/cache"
+	"github.com/kcp-dev/logicalcluster/v3"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/sdk/apis/apis/v1alpha1"
+	kcpcore "github.com/kcp-dev/kcp/sdk/apis/core"
+	corev1alpha1 "github.com/kcp-dev/kcp/sdk/apis/core/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/sets"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// EngagementPolicy decides whether a logical cluster is engaged based on the
+// objects of the engagement types in it.
+type EngagementPolicy string
+
+const (
+	// EngageOnAny engages a logical cluster as long as it has an object of
+	// any of the engagement types.
+	EngageOnAny EngagementPolicy = "Any"
+	// EngageOnAll engages a logical cluster as long as it has objects of all
+	// engagement types.
+	EngageOnAll EngagementPolicy = "All"
+)
+
+// LogicalClusterReady is an engagement filter that only accepts LogicalCluster
+// objects in phase Ready which are not being deleted. Used with LogicalCluster
+// as engagement type, it engages logical clusters for their whole lifetime,
+// independent of the objects in them. Objects of other kinds are accepted, so
+// that the filter can be combined with further engagement types.
+func LogicalClusterReady(obj client.Object) bool {
+	switch obj := obj.(type) {
+	case *corev1alpha1.LogicalCluster:
+		return obj.DeletionTimestamp == nil && obj.Status.Phase == corev1alpha1.LogicalClusterPhaseReady
+	case *unstructured.Unstructured:
+		if obj.GroupVersionKind().GroupKind() != corev1alpha1.SchemeGroupVersion.WithKind("LogicalCluster").GroupKind() {
+			return true
+		}
+		phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+		return obj.GetDeletionTimestamp() == nil && phase == string(corev1alpha1.LogicalClusterPhaseReady)
+	}
+	return true
+}
+
+// APIBindingBound is an engagement filter that only accepts APIBinding objects
+// in phase Bound which are not being deleted. Used with APIBinding as
+// engagement type, it engages logical clusters while they are bound to an
+// APIExport. Objects of other kinds are accepted, so that the filter can be
+// combined with further engagement types.
+func APIBindingBound(obj client.Object) bool {
+	switch obj := obj.(type) {
+	case *apisv1alpha1.APIBinding:
+		return obj.DeletionTimestamp == nil && obj.Status.Phase == apisv1alpha1.APIBindingPhaseBound
+	case *unstructured.Unstructured:
+		if obj.GroupVersionKind().GroupKind() != apisv1alpha1.SchemeGroupVersion.WithKind("APIBinding").GroupKind() {
+			return true
+		}
+		phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+		return obj.GetDeletionTimestamp() == nil && phase == string(apisv1alpha1.APIBindingPhaseBound)
+	}
+	return true
+}
+
+// engagementSource is an informer of one of the types whose objects decide
+// whether logical clusters are engaged.
+type engagementSource struct {
+	object   client.Object
+	informer cache.Informer
+	indexer  toolscache.Indexer
+}
+
+// engagementSources are the informers of all engagement types.
+type engagementSources []engagementSource
+
+// getEngagementSources returns the informers of the given engagement types
+// from the wildcard cache, creating them if necessary.
+func getEngagementSources(ctx context.Context, wildcardCache WildcardCache, objs []client.Object) (engagementSources, error) {
+	sources := make(engagementSources, 0, len(objs))
+	for _, obj := range objs {
+		inf, err := wildcardCache.GetInformer(ctx, obj, cache.BlockUntilSynced(false))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get informer for %T: %w", obj, err)
+		}
+		shInf, _, _, _, err := wildcardCache.getSharedInformer(obj)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get shared informer for %T: %w", obj, err)
+		}
+		sources = append(sources, engagementSource{object: obj, informer: inf, indexer: shInf.GetIndexer()})
+	}
+	return sources, nil
+}
+
+// wantsEngagement returns whether the logical cluster has objects of the
+// engagement types as required by the policy. Objects rejected by the filter,
+// if any, are ignored.
+func (s engagementSources) wantsEngagement(policy EngagementPolicy, filter func(client.Object) bool, clusterName logicalcluster.Name) (bool, error) {
+	for _, source := range s {
+		found, err := source.hasObjects(filter, clusterName)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case found && policy != EngageOnAll:
+			return true, nil
+		case !found && policy == EngageOnAll:
+			return false, nil
+		}
+	}
+	return policy == EngageOnAll && len(s) > 0, nil
+}
+
+func (s engagementSource) hasObjects(filter func(client.Object) bool, clusterName logicalcluster.Name) (bool, error) {
+	if filter == nil {
+		keys, err := s.indexer.IndexKeys(kcpcache.ClusterIndexName, clusterName.String())
+		if err != nil {
+			return false, fmt.Errorf("failed to get index keys for %T: %w", s.object, err)
+		}
+		return len(keys) > 0, nil
+	}
+
+	objs, err := s.indexer.ByIndex(kcpcache.ClusterIndexName, clusterName.String())
+	if err != nil {
+		return false, fmt.Errorf("failed to get objects of %T: %w", s.object, err)
+	}
+	for _, obj := range objs {
+		if cobj, ok := obj.(client.Object); ok && filter(cobj) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// workspacePath returns the workspace path of the logical cluster as found on
+// its engagement objects, e.g. on LogicalCluster objects. It returns an empty
+// path if none of them carries it.
+func (s engagementSources) workspacePath(clusterName logicalcluster.Name) logicalcluster.Path {
+	for _, source := range s {
+		objs, err := source.indexer.ByIndex(kcpcache.ClusterIndexName, clusterName.String())
+		if err != nil {
+			continue
+		}
+		for _, obj := range objs {
+			cobj, ok := obj.(client.Object)
+			if !ok {
+				continue
+			}
+			if path, ok := cobj.GetAnnotations()[kcpcore.LogicalClusterPathAnnotationKey]; ok {
+				return logicalcluster.NewPath(path)
+			}
+		}
+	}
+	return logicalcluster.Path{}
+}
+
+// clusters returns the logical clusters with objects of any engagement type.
+func (s engagementSources) clusters() sets.Set[logicalcluster.Name] {
+	seen := sets.New[logicalcluster.Name]()
+	for _, source := range s {
+		for _, value := range source.indexer.ListIndexFuncValues(kcpcache.ClusterIndexName) {
+			seen.Insert(logicalcluster.Name(value))
+		}
+	}
+	return seen
+}
+
+// EngagementDecision is the decision of the provider whether to engage a
+// logical cluster, as returned by Provider.EngagementDecisions.
+type EngagementDecision struct {
+	Cluster logicalcluster.Name
+	// Path is the workspace path of the logical cluster, if any engagement
+	// object carries it.
+	Path logicalcluster.Path
+	// Engage is whether the provider engages the logical cluster.
+	Engage bool
+	// Objects is the number of objects of every engagement type, by kind,
+	// that the engagement filter accepts.
+	Objects map[string]int
+}
+
+// EngagementDecisions returns the decisions of the provider for all logical
+// clusters with objects of any engagement type, sorted by name, without
+// engaging any of them. Sharding and the disengage grace period are not taken
+// into account. The wildcard cache must be started.
+func (p *Provider) EngagementDecisions(ctx context.Context) ([]EngagementDecision, error) {
+	sources, err := getEngagementSources(ctx, p.cache, p.objects)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get logical cluster informers: %w", err)
+	}
+	if !p.cache.WaitForCacheSync(ctx) {
+		return nil, errors.New("failed to sync wildcard cache")
+	}
+
+	kinds := make([]string, 0, len(sources))
+	for _, source := range sources {
+		gvk, err := apiutil.GVKForObject(source.object, p.scheme)
+		if err != nil {
+			return nil, err
+		}
+		kinds = append(kinds, gvk.Kind)
+	}
+
+	var decisions []EngagementDecision
+	for _, clusterName := range sets.List(sources.clusters()) {
+		engage, err := sources.wantsEngagement(p.policy, p.filter, clusterName)
+		if err != nil {
+			return nil, err
+		}
+		decision := EngagementDecision{
+			Cluster: clusterName,
+			Path:    sources.workspacePath(clusterName),
+			Engage:  engage,
+			Objects: map[string]int{},
+		}
+		for i, source := range sources {
+			n, err := source.countObjects(p.filter, clusterName)
+			if err != nil {
+				return nil, err
+			}
+			decision.Objects[kinds[i]] += n
+		}
+		decisions = append(decisions, decision)
+	}
+	return decisions, nil
+}
+
+// countObjects returns the number of objects in the logical cluster accepted
+// by the filter, if any.
+func (s engagementSource) countObjects(filter func(client.Object) bool, clusterName logicalcluster.Name) (int, error) {
+	objs, err := s.indexer.ByIndex(kcpcache.ClusterIndexName, clusterName.String())
+	if err != nil {
+		return 0, fmt.Errorf("failed to get objects of %T: %w", s.object, err)
+	}
+	n := 0
+	for _, obj := range objs {
+		if cobj, ok := obj.(client.Object); ok && (filter == nil || filter(cobj)) {
+			n++
+		}
+	}
+	return n, nil
+}
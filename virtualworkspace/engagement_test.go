@@ -0,0 +1,125 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualworkspace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/sdk/apis/apis/v1alpha1"
+	corev1alpha1 "github.com/kcp-dev/kcp/sdk/apis/core/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestEngagementFilters(t *testing.T) {
+	now := metav1.Now()
+	unstructuredObj := func(gvk schema.GroupVersionKind, phase string) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{}
+		u.SetGroupVersionKind(gvk)
+		u.SetName("a")
+		if phase != "" {
+			require.NoError(t, unstructured.SetNestedField(u.Object, phase, "status", "phase"))
+		}
+		return u
+	}
+	logicalClusterGVK := corev1alpha1.SchemeGroupVersion.WithKind("LogicalCluster")
+	apiBindingGVK := apisv1alpha1.SchemeGroupVersion.WithKind("APIBinding")
+
+	tests := map[string]struct {
+		filter func(client.Object) bool
+		obj    client.Object
+		want   bool
+	}{
+		"ready LogicalCluster": {
+			filter: LogicalClusterReady,
+			obj:    &corev1alpha1.LogicalCluster{Status: corev1alpha1.LogicalClusterStatus{Phase: corev1alpha1.LogicalClusterPhaseReady}},
+			want:   true,
+		},
+		"initializing LogicalCluster": {
+			filter: LogicalClusterReady,
+			obj:    &corev1alpha1.LogicalCluster{Status: corev1alpha1.LogicalClusterStatus{Phase: corev1alpha1.LogicalClusterPhaseInitializing}},
+		},
+		"deleting LogicalCluster": {
+			filter: LogicalClusterReady,
+			obj: &corev1alpha1.LogicalCluster{
+				ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &now},
+				Status:     corev1alpha1.LogicalClusterStatus{Phase: corev1alpha1.LogicalClusterPhaseReady},
+			},
+		},
+		"ready unstructured LogicalCluster": {
+			filter: LogicalClusterReady,
+			obj:    unstructuredObj(logicalClusterGVK, string(corev1alpha1.LogicalClusterPhaseReady)),
+			want:   true,
+		},
+		"unstructured LogicalCluster without phase": {
+			filter: LogicalClusterReady,
+			obj:    unstructuredObj(logicalClusterGVK, ""),
+		},
+		"other kind for LogicalClusterReady": {
+			filter: LogicalClusterReady,
+			obj:    &corev1.ConfigMap{},
+			want:   true,
+		},
+		"other unstructured kind for LogicalClusterReady": {
+			filter: LogicalClusterReady,
+			obj:    unstructuredObj(apiBindingGVK, ""),
+			want:   true,
+		},
+		"bound APIBinding": {
+			filter: APIBindingBound,
+			obj:    &apisv1alpha1.APIBinding{Status: apisv1alpha1.APIBindingStatus{Phase: apisv1alpha1.APIBindingPhaseBound}},
+			want:   true,
+		},
+		"binding APIBinding": {
+			filter: APIBindingBound,
+			obj:    &apisv1alpha1.APIBinding{Status: apisv1alpha1.APIBindingStatus{Phase: apisv1alpha1.APIBindingPhaseBinding}},
+		},
+		"deleting APIBinding": {
+			filter: APIBindingBound,
+			obj: &apisv1alpha1.APIBinding{
+				ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &now},
+				Status:     apisv1alpha1.APIBindingStatus{Phase: apisv1alpha1.APIBindingPhaseBound},
+			},
+		},
+		"bound unstructured APIBinding": {
+			filter: APIBindingBound,
+			obj:    unstructuredObj(apiBindingGVK, string(apisv1alpha1.APIBindingPhaseBound)),
+			want:   true,
+		},
+		"other kind for APIBindingBound": {
+			filter: APIBindingBound,
+			obj:    &corev1.ConfigMap{},
+			want:   true,
+		},
+		"other unstructured kind for APIBindingBound": {
+			filter: APIBindingBound,
+			obj:    unstructuredObj(logicalClusterGVK, ""),
+			want:   true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tt.want, tt.filter(tt.obj))
+		})
+	}
+}
@@ -0,0 +1,452 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	kcpcache "github.com/kcp-dev/apimachinery/v2/pkg/cache"
+	kcpinformers "github.com/kcp-dev/apimachinery/v2/third_party/informers"
+	"github.com/kcp-dev/logicalcluster/v3"
+
+	"github.com/kcp-dev/multicluster-provider/virtualworkspace"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8scache "k8s.io/client-go/tools/cache"
+	fcache "k8s.io/client-go/tools/cache/testing"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+var _ cache.Cache = &WildcardCache{}
+
+// WildcardCache is an in-memory wildcard cache. Instead of watching a
+// /clusters/* endpoint, its informers are fed with the objects written
+// through the clients of a Provider's clusters. The informers are indexed
+// like those of the real wildcard cache, so code built on top of
+// GetSharedInformer behaves the same. AsWildcardCache turns it into a
+// virtualworkspace.WildcardCache.
+//
+// Only structured objects known to the scheme are supported.
+type WildcardCache struct {
+	scheme *runtime.Scheme
+	mapper apimeta.RESTMapper
+
+	lock    sync.RWMutex
+	ctx     context.Context
+	types   map[schema.GroupVersionKind]*wildcardType
+	indexes map[schema.GroupVersionKind]k8scache.Indexers
+}
+
+// wildcardType holds the objects of one kind across all clusters and, once
+// requested, the informer over them.
+type wildcardType struct {
+	source  *fcache.FakeControllerSource
+	objects map[objectKey]runtime.Object
+
+	informer kcpcache.ScopeableSharedIndexInformer
+	cancel   context.CancelFunc
+}
+
+type objectKey struct {
+	cluster   logicalcluster.Name
+	namespace string
+	name      string
+}
+
+// NewWildcardCache returns an empty WildcardCache. The mapper decides which
+// kinds are cluster-scoped; use NewRESTMapper for a sensible default.
+func NewWildcardCache(scheme *runtime.Scheme, mapper apimeta.RESTMapper) *WildcardCache {
+	return &WildcardCache{
+		scheme:  scheme,
+		mapper:  mapper,
+		types:   map[schema.GroupVersionKind]*wildcardType{},
+		indexes: map[schema.GroupVersionKind]k8scache.Indexers{},
+	}
+}
+
+// Start runs all informers until the context is done. Informers requested
+// later are started right away.
+func (c *WildcardCache) Start(ctx context.Context) error {
+	c.lock.Lock()
+	if c.ctx != nil {
+		c.lock.Unlock()
+		return errors.New("fake wildcard cache was already started")
+	}
+	c.ctx = ctx
+	for _, t := range c.types {
+		if t.informer != nil {
+			c.runInformerLocked(t)
+		}
+	}
+	c.lock.Unlock()
+
+	<-ctx.Done()
+	return nil
+}
+
+// WaitForCacheSync waits until all informers have synced.
+func (c *WildcardCache) WaitForCacheSync(ctx context.Context) bool {
+	c.lock.RLock()
+	var synced []k8scache.InformerSynced
+	for _, t := range c.types {
+		if t.informer != nil {
+			synced = append(synced, t.informer.HasSynced)
+		}
+	}
+	c.lock.RUnlock()
+
+	return k8scache.WaitForCacheSync(ctx.Done(), synced...)
+}
+
+// GetInformer returns the informer for the type of the given object, creating
+// it if necessary.
+func (c *WildcardCache) GetInformer(ctx context.Context, obj client.Object, opts ...cache.InformerGetOption) (cache.Informer, error) {
+	gvk, err := c.gvkFor(obj)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetInformerForKind(ctx, gvk, opts...)
+}
+
+// GetInformerForKind returns the informer for the given GroupVersionKind,
+// creating it if necessary.
+func (c *WildcardCache) GetInformerForKind(ctx context.Context, gvk schema.GroupVersionKind, opts ...cache.InformerGetOption) (cache.Informer, error) {
+	getOpts := cache.InformerGetOptions{}
+	for _, opt := range opts {
+		opt(&getOpts)
+	}
+
+	inf, err := c.informerFor(gvk)
+	if err != nil {
+		return nil, err
+	}
+
+	if getOpts.BlockUntilSynced == nil || *getOpts.BlockUntilSynced {
+		c.lock.RLock()
+		started := c.ctx != nil
+		c.lock.RUnlock()
+		if started && !k8scache.WaitForCacheSync(ctx.Done(), inf.HasSynced) {
+			return nil, apierrors.NewTimeoutError(fmt.Sprintf("failed waiting for %s informer to sync", gvk), 0)
+		}
+	}
+
+	return inf, nil
+}
+
+// GetSharedInformer returns the informer for the type of the given object or
+// list, its GroupVersionKind and REST scope, and whether the informer exists.
+// It does not create informers.
+func (c *WildcardCache) GetSharedInformer(obj runtime.Object) (k8scache.SharedIndexInformer, schema.GroupVersionKind, apimeta.RESTScopeName, bool, error) {
+	gvk, err := c.gvkFor(obj)
+	if err != nil {
+		return nil, gvk, "", false, err
+	}
+
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, gvk, "", false, err
+	}
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	t, ok := c.types[gvk]
+	if !ok || t.informer == nil {
+		return nil, gvk, mapping.Scope.Name(), false, nil
+	}
+	return t.informer, gvk, mapping.Scope.Name(), true, nil
+}
+
+// AsWildcardCache returns the cache as a virtualworkspace.WildcardCache, e.g.
+// to hand it to virtualworkspace.Options to drive the real provider.
+func (c *WildcardCache) AsWildcardCache() virtualworkspace.WildcardCache {
+	return virtualworkspace.WildcardCacheFor(c, c.GetSharedInformer)
+}
+
+// RemoveInformer stops the informer for the type of the given object. The
+// objects stay in the cache.
+func (c *WildcardCache) RemoveInformer(_ context.Context, obj client.Object) error {
+	gvk, err := c.gvkFor(obj)
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if t, ok := c.types[gvk]; ok && t.informer != nil {
+		if t.cancel != nil {
+			t.cancel()
+		}
+		t.informer, t.cancel = nil, nil
+	}
+	return nil
+}
+
+// IndexField adds a field index to the informer for the type of the given
+// object, like the wildcard cache of the virtualworkspace package does.
+func (c *WildcardCache) IndexField(_ context.Context, obj client.Object, field string, extractValue client.IndexerFunc) error {
+	gvk, err := c.gvkFor(obj)
+	if err != nil {
+		return err
+	}
+
+	indexers := k8scache.Indexers{virtualworkspace.FieldIndexName(field): virtualworkspace.ClusterFieldIndexFunc(extractValue)}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.indexes[gvk] == nil {
+		c.indexes[gvk] = k8scache.Indexers{}
+	}
+	for name, fn := range indexers {
+		c.indexes[gvk][name] = fn
+	}
+	if t, ok := c.types[gvk]; ok && t.informer != nil {
+		return t.informer.AddIndexers(indexers)
+	}
+	return nil
+}
+
+// Get returns the object with the given key. As the key does not contain a
+// logical cluster, it fails if the object exists in more than one cluster.
+func (c *WildcardCache) Get(_ context.Context, key client.ObjectKey, obj client.Object, _ ...client.GetOption) error {
+	gvk, err := c.gvkFor(obj)
+	if err != nil {
+		return err
+	}
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	var found runtime.Object
+	if t, ok := c.types[gvk]; ok {
+		for k, o := range t.objects {
+			if k.namespace != key.Namespace || k.name != key.Name {
+				continue
+			}
+			if found != nil {
+				return fmt.Errorf("%s %s exists in multiple logical clusters", gvk.Kind, key)
+			}
+			found = o
+		}
+	}
+	if found == nil {
+		return apierrors.NewNotFound(c.resourceFor(gvk), key.Name)
+	}
+
+	return copyInto(found, obj, gvk)
+}
+
+// List returns the objects of all logical clusters matching the options.
+// Field selectors are not supported.
+func (c *WildcardCache) List(_ context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	gvk, err := c.gvkFor(list)
+	if err != nil {
+		return err
+	}
+
+	listOpts := client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+	if listOpts.FieldSelector != nil && !listOpts.FieldSelector.Empty() {
+		return errors.New("field selectors are not supported by the fake wildcard cache")
+	}
+	sel := listOpts.LabelSelector
+	if sel == nil {
+		sel = labels.Everything()
+	}
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	var items []runtime.Object
+	if t, ok := c.types[gvk]; ok {
+		for k, o := range t.objects {
+			if listOpts.Namespace != "" && k.namespace != listOpts.Namespace {
+				continue
+			}
+			accessor, err := apimeta.Accessor(o)
+			if err != nil {
+				return err
+			}
+			if !sel.Matches(labels.Set(accessor.GetLabels())) {
+				continue
+			}
+			item := o.DeepCopyObject()
+			item.GetObjectKind().SetGroupVersionKind(gvk)
+			items = append(items, item)
+		}
+	}
+
+	return apimeta.SetList(list, items)
+}
+
+// upsert stores a copy of the given object of a cluster and notifies the
+// informer of its type.
+func (c *WildcardCache) upsert(clusterName logicalcluster.Name, obj client.Object) error {
+	gvk, err := c.gvkFor(obj)
+	if err != nil {
+		return err
+	}
+	obj = obj.DeepCopyObject().(client.Object)
+	key := objectKey{cluster: clusterName, namespace: obj.GetNamespace(), name: obj.GetName()}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	t := c.typeForLocked(gvk)
+	if _, ok := t.objects[key]; ok {
+		t.source.Modify(obj)
+	} else {
+		t.source.Add(obj)
+	}
+	t.objects[key] = obj
+	return nil
+}
+
+// delete removes the object of a cluster with the given key.
+func (c *WildcardCache) delete(clusterName logicalcluster.Name, gvk schema.GroupVersionKind, key client.ObjectKey) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.deleteLocked(gvk, objectKey{cluster: clusterName, namespace: key.Namespace, name: key.Name})
+}
+
+// deleteCluster removes all objects of a cluster.
+func (c *WildcardCache) deleteCluster(clusterName logicalcluster.Name) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for gvk, t := range c.types {
+		for key := range t.objects {
+			if key.cluster == clusterName {
+				c.deleteLocked(gvk, key)
+			}
+		}
+	}
+}
+
+func (c *WildcardCache) deleteLocked(gvk schema.GroupVersionKind, key objectKey) {
+	t, ok := c.types[gvk]
+	if !ok {
+		return
+	}
+	obj, ok := t.objects[key]
+	if !ok {
+		return
+	}
+	delete(t.objects, key)
+	t.source.Delete(obj.DeepCopyObject())
+}
+
+func (c *WildcardCache) informerFor(gvk schema.GroupVersionKind) (kcpcache.ScopeableSharedIndexInformer, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	t := c.typeForLocked(gvk)
+	if t.informer != nil {
+		return t.informer, nil
+	}
+
+	obj, err := c.scheme.New(gvk)
+	if err != nil {
+		return nil, err
+	}
+	t.informer = kcpinformers.NewSharedIndexInformer(t.source, obj, 0, k8scache.Indexers{
+		k8scache.NamespaceIndex:               k8scache.MetaNamespaceIndexFunc,
+		kcpcache.ClusterIndexName:             virtualworkspace.ClusterIndexFunc,
+		kcpcache.ClusterAndNamespaceIndexName: virtualworkspace.ClusterAndNamespaceIndexFunc,
+	})
+	if indexers := c.indexes[gvk]; len(indexers) > 0 {
+		if err := t.informer.AddIndexers(indexers); err != nil {
+			return nil, err
+		}
+	}
+	if c.ctx != nil {
+		c.runInformerLocked(t)
+	}
+
+	return t.informer, nil
+}
+
+func (c *WildcardCache) typeForLocked(gvk schema.GroupVersionKind) *wildcardType {
+	t, ok := c.types[gvk]
+	if !ok {
+		t = &wildcardType{
+			source:  fcache.NewFakeControllerSource(),
+			objects: map[objectKey]runtime.Object{},
+		}
+		c.types[gvk] = t
+	}
+	return t
+}
+
+func (c *WildcardCache) runInformerLocked(t *wildcardType) {
+	ctx, cancel := context.WithCancel(c.ctx)
+	t.cancel = cancel
+	go t.informer.Run(ctx.Done())
+}
+
+// gvkFor returns the GroupVersionKind of an object or of the items of a list.
+func (c *WildcardCache) gvkFor(obj runtime.Object) (schema.GroupVersionKind, error) {
+	switch obj.(type) {
+	case runtime.Unstructured, *metav1.PartialObjectMetadata, *metav1.PartialObjectMetadataList:
+		return schema.GroupVersionKind{}, fmt.Errorf("%T is not supported by the fake wildcard cache", obj)
+	}
+
+	gvk, err := apiutil.GVKForObject(obj, c.scheme)
+	if err != nil {
+		return gvk, err
+	}
+	if apimeta.IsListType(obj) {
+		gvk.Kind = strings.TrimSuffix(gvk.Kind, "List")
+	}
+	return gvk, nil
+}
+
+// resourceFor returns the resource of the given kind from the RESTMapper,
+// guessing it like the wildcard cache does for kinds the mapper does not know.
+func (c *WildcardCache) resourceFor(gvk schema.GroupVersionKind) schema.GroupResource {
+	if mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version); err == nil {
+		return mapping.Resource.GroupResource()
+	}
+	plural, _ := apimeta.UnsafeGuessKindToResource(gvk)
+	return plural.GroupResource()
+}
+
+func copyInto(from runtime.Object, to client.Object, gvk schema.GroupVersionKind) error {
+	fromVal := reflect.ValueOf(from.DeepCopyObject())
+	toVal := reflect.ValueOf(to)
+	if !fromVal.Type().AssignableTo(toVal.Type()) {
+		return fmt.Errorf("cache had type %s, but %s was asked for", fromVal.Type(), toVal.Type())
+	}
+	reflect.Indirect(toVal).Set(reflect.Indirect(fromVal))
+	to.GetObjectKind().SetGroupVersionKind(gvk)
+	return nil
+}
@@ -0,0 +1,359 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/kcp-dev/logicalcluster/v3"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+)
+
+var _ cluster.Cluster = &Cluster{}
+
+// Cluster is an in-memory logical cluster. Its client is a controller-runtime
+// fake client. Every write through the client stamps the logical cluster
+// annotation onto the object, like kcp does, and is reflected in the informers
+// of the WildcardCache shared by all clusters of a Provider.
+type Cluster struct {
+	name     logicalcluster.Name
+	scheme   *runtime.Scheme
+	mapper   apimeta.RESTMapper
+	wildcard *WildcardCache
+
+	client   client.WithWatch
+	cache    *clusterCache
+	recorder *record.FakeRecorder
+	indexes  sets.Set[indexKey]
+}
+
+func newCluster(name logicalcluster.Name, opts Options, wildcard *WildcardCache, indexes []index, objs []client.Object) (*Cluster, error) {
+	c := &Cluster{
+		name:     name,
+		scheme:   opts.Scheme,
+		mapper:   opts.RESTMapper,
+		wildcard: wildcard,
+		recorder: record.NewFakeRecorder(100),
+		indexes:  sets.New[indexKey](),
+	}
+
+	initObjs := make([]client.Object, 0, len(objs))
+	for _, obj := range objs {
+		obj = obj.DeepCopyObject().(client.Object)
+		c.stamp(obj)
+		initObjs = append(initObjs, obj)
+	}
+
+	builder := fake.NewClientBuilder().
+		WithScheme(opts.Scheme).
+		WithRESTMapper(opts.RESTMapper).
+		WithObjects(initObjs...).
+		WithStatusSubresource(opts.StatusSubresources...).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Create:            c.create,
+			Update:            c.update,
+			Patch:             c.patch,
+			Delete:            c.delete,
+			DeleteAllOf:       c.deleteAllOf,
+			SubResourceCreate: c.subResourceCreate,
+			SubResourceUpdate: c.subResourceUpdate,
+			SubResourcePatch:  c.subResourcePatch,
+		})
+	for _, idx := range indexes {
+		builder = builder.WithIndex(idx.obj, idx.field, idx.extractValue)
+		c.indexes.Insert(idx.indexKey)
+	}
+	c.client = builder.Build()
+	c.cache = &clusterCache{Reader: c.client, cluster: c}
+
+	ctx := context.Background()
+	for _, obj := range initObjs {
+		if err := c.sync(ctx, c.client, obj); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// Name returns the name of the logical cluster.
+func (c *Cluster) Name() logicalcluster.Name {
+	return c.name
+}
+
+// Recorder returns the recorder handed out by GetEventRecorderFor, giving
+// tests access to the recorded events.
+func (c *Cluster) Recorder() *record.FakeRecorder {
+	return c.recorder
+}
+
+// GetHTTPClient returns an HTTP client that is not connected to anything.
+func (c *Cluster) GetHTTPClient() *http.Client {
+	return &http.Client{}
+}
+
+// GetConfig returns a rest.Config pointing to a non-existing host.
+func (c *Cluster) GetConfig() *rest.Config {
+	return &rest.Config{Host: "https://fake.invalid" + c.name.Path().RequestPath()}
+}
+
+// GetCache returns a cache reading from the fake client and handing out
+// informers of the WildcardCache scoped to this cluster.
+func (c *Cluster) GetCache() cache.Cache {
+	return c.cache
+}
+
+// GetScheme returns the scheme of the cluster.
+func (c *Cluster) GetScheme() *runtime.Scheme {
+	return c.scheme
+}
+
+// GetClient returns the fake client of the cluster.
+func (c *Cluster) GetClient() client.Client {
+	return c.client
+}
+
+// GetFieldIndexer returns the cache of the cluster.
+func (c *Cluster) GetFieldIndexer() client.FieldIndexer {
+	return c.cache
+}
+
+// GetEventRecorderFor returns a fake recorder shared by all names.
+func (c *Cluster) GetEventRecorderFor(_ string) record.EventRecorder {
+	return c.recorder
+}
+
+// GetRESTMapper returns the RESTMapper of the cluster.
+func (c *Cluster) GetRESTMapper() apimeta.RESTMapper {
+	return c.mapper
+}
+
+// GetAPIReader returns the fake client of the cluster.
+func (c *Cluster) GetAPIReader() client.Reader {
+	return c.client
+}
+
+// Start fails as fake clusters have nothing to start.
+func (c *Cluster) Start(ctx context.Context) error {
+	return errors.New("fake cluster cannot be started")
+}
+
+// stamp sets what the kcp apiserver sets on new objects.
+func (c *Cluster) stamp(obj client.Object) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[logicalcluster.AnnotationKey] = c.name.String()
+	obj.SetAnnotations(annotations)
+	if obj.GetUID() == "" {
+		obj.SetUID(uuid.NewUUID())
+	}
+}
+
+// sync reflects the current state of the given object in the wildcard cache.
+func (c *Cluster) sync(ctx context.Context, cl client.Reader, obj client.Object) error {
+	gvk, err := apiutil.GVKForObject(obj, c.scheme)
+	if err != nil {
+		return err
+	}
+	current, err := c.scheme.New(gvk)
+	if err != nil {
+		return err
+	}
+	key := client.ObjectKeyFromObject(obj)
+	if err := cl.Get(ctx, key, current.(client.Object)); err != nil {
+		if apierrors.IsNotFound(err) {
+			c.wildcard.delete(c.name, gvk, key)
+			return nil
+		}
+		return err
+	}
+	return c.wildcard.upsert(c.name, current.(client.Object))
+}
+
+// resync reflects all objects of the given kind in the wildcard cache.
+func (c *Cluster) resync(ctx context.Context, cl client.Reader, gvk schema.GroupVersionKind) error {
+	list, err := c.scheme.New(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+	if err != nil {
+		return err
+	}
+	if err := cl.List(ctx, list.(client.ObjectList)); err != nil {
+		return err
+	}
+	items, err := apimeta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+
+	existing := sets.New[client.ObjectKey]()
+	for _, item := range items {
+		obj := item.(client.Object)
+		existing.Insert(client.ObjectKeyFromObject(obj))
+		if err := c.wildcard.upsert(c.name, obj); err != nil {
+			return err
+		}
+	}
+
+	c.wildcard.lock.RLock()
+	var gone []client.ObjectKey
+	if t, ok := c.wildcard.types[gvk]; ok {
+		for key := range t.objects {
+			if key.cluster == c.name && !existing.Has(client.ObjectKey{Namespace: key.namespace, Name: key.name}) {
+				gone = append(gone, client.ObjectKey{Namespace: key.namespace, Name: key.name})
+			}
+		}
+	}
+	c.wildcard.lock.RUnlock()
+	for _, key := range gone {
+		c.wildcard.delete(c.name, gvk, key)
+	}
+	return nil
+}
+
+func (c *Cluster) create(ctx context.Context, cl client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+	c.stamp(obj)
+	if err := cl.Create(ctx, obj, opts...); err != nil {
+		return err
+	}
+	return c.sync(ctx, cl, obj)
+}
+
+func (c *Cluster) update(ctx context.Context, cl client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+	c.stamp(obj)
+	if err := cl.Update(ctx, obj, opts...); err != nil {
+		return err
+	}
+	return c.sync(ctx, cl, obj)
+}
+
+func (c *Cluster) patch(ctx context.Context, cl client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if err := cl.Patch(ctx, obj, patch, opts...); err != nil {
+		return err
+	}
+	return c.sync(ctx, cl, obj)
+}
+
+func (c *Cluster) delete(ctx context.Context, cl client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+	if err := cl.Delete(ctx, obj, opts...); err != nil {
+		return err
+	}
+	return c.sync(ctx, cl, obj)
+}
+
+func (c *Cluster) deleteAllOf(ctx context.Context, cl client.WithWatch, obj client.Object, opts ...client.DeleteAllOfOption) error {
+	if err := cl.DeleteAllOf(ctx, obj, opts...); err != nil {
+		return err
+	}
+	gvk, err := apiutil.GVKForObject(obj, c.scheme)
+	if err != nil {
+		return err
+	}
+	return c.resync(ctx, cl, gvk)
+}
+
+func (c *Cluster) subResourceCreate(ctx context.Context, cl client.Client, subResource string, obj, subResourceObj client.Object, opts ...client.SubResourceCreateOption) error {
+	if err := cl.SubResource(subResource).Create(ctx, obj, subResourceObj, opts...); err != nil {
+		return err
+	}
+	return c.sync(ctx, cl, obj)
+}
+
+func (c *Cluster) subResourceUpdate(ctx context.Context, cl client.Client, subResource string, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+	if err := cl.SubResource(subResource).Update(ctx, obj, opts...); err != nil {
+		return err
+	}
+	return c.sync(ctx, cl, obj)
+}
+
+func (c *Cluster) subResourcePatch(ctx context.Context, cl client.Client, subResource string, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+	if err := cl.SubResource(subResource).Patch(ctx, obj, patch, opts...); err != nil {
+		return err
+	}
+	return c.sync(ctx, cl, obj)
+}
+
+var _ cache.Cache = &clusterCache{}
+
+// clusterCache reads from the fake client of a cluster, which always has the
+// latest state, and hands out the informers of the WildcardCache scoped to
+// the cluster.
+type clusterCache struct {
+	client.Reader
+	cluster *Cluster
+}
+
+func (c *clusterCache) GetInformer(ctx context.Context, obj client.Object, opts ...cache.InformerGetOption) (cache.Informer, error) {
+	gvk, err := c.cluster.wildcard.gvkFor(obj)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetInformerForKind(ctx, gvk, opts...)
+}
+
+func (c *clusterCache) GetInformerForKind(ctx context.Context, gvk schema.GroupVersionKind, opts ...cache.InformerGetOption) (cache.Informer, error) {
+	if _, err := c.cluster.wildcard.GetInformerForKind(ctx, gvk, opts...); err != nil {
+		return nil, err
+	}
+	inf, err := c.cluster.wildcard.informerFor(gvk)
+	if err != nil {
+		return nil, err
+	}
+	return inf.Cluster(c.cluster.name), nil
+}
+
+func (c *clusterCache) RemoveInformer(_ context.Context, _ client.Object) error {
+	return errors.New("informer cannot be removed from a fake cluster cache")
+}
+
+func (c *clusterCache) Start(_ context.Context) error {
+	return errors.New("fake cluster cache cannot be started")
+}
+
+func (c *clusterCache) WaitForCacheSync(ctx context.Context) bool {
+	return c.cluster.wildcard.WaitForCacheSync(ctx)
+}
+
+// IndexField fails unless the index was registered through the Provider
+// before the cluster was engaged, as indexes of fake clients are static.
+func (c *clusterCache) IndexField(_ context.Context, obj client.Object, field string, _ client.IndexerFunc) error {
+	gvk, err := c.cluster.wildcard.gvkFor(obj)
+	if err != nil {
+		return err
+	}
+	if !c.cluster.indexes.Has(indexKey{gvk: gvk, field: field}) {
+		return fmt.Errorf("index %q on %s must be added through the fake Provider before the cluster is engaged", field, gvk.Kind)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"strings"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// clusterScopedKinds are the well-known kinds of Kubernetes and kcp that are
+// not namespaced.
+var clusterScopedKinds = sets.New(
+	schema.GroupKind{Kind: "Namespace"},
+	schema.GroupKind{Kind: "Node"},
+	schema.GroupKind{Kind: "PersistentVolume"},
+	schema.GroupKind{Kind: "ComponentStatus"},
+	schema.GroupKind{Group: "rbac.authorization.k8s.io", Kind: "ClusterRole"},
+	schema.GroupKind{Group: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding"},
+	schema.GroupKind{Group: "storage.k8s.io", Kind: "StorageClass"},
+	schema.GroupKind{Group: "storage.k8s.io", Kind: "CSIDriver"},
+	schema.GroupKind{Group: "storage.k8s.io", Kind: "CSINode"},
+	schema.GroupKind{Group: "storage.k8s.io", Kind: "VolumeAttachment"},
+	schema.GroupKind{Group: "scheduling.k8s.io", Kind: "PriorityClass"},
+	schema.GroupKind{Group: "node.k8s.io", Kind: "RuntimeClass"},
+	schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"},
+	schema.GroupKind{Group: "admissionregistration.k8s.io", Kind: "MutatingWebhookConfiguration"},
+	schema.GroupKind{Group: "admissionregistration.k8s.io", Kind: "ValidatingWebhookConfiguration"},
+	schema.GroupKind{Group: "certificates.k8s.io", Kind: "CertificateSigningRequest"},
+	schema.GroupKind{Group: "apiregistration.k8s.io", Kind: "APIService"},
+	schema.GroupKind{Group: "apis.kcp.io", Kind: "APIBinding"},
+	schema.GroupKind{Group: "apis.kcp.io", Kind: "APIExport"},
+	schema.GroupKind{Group: "apis.kcp.io", Kind: "APIExportEndpointSlice"},
+	schema.GroupKind{Group: "apis.kcp.io", Kind: "APIResourceSchema"},
+	schema.GroupKind{Group: "apis.kcp.io", Kind: "APIConversion"},
+	schema.GroupKind{Group: "core.kcp.io", Kind: "LogicalCluster"},
+	schema.GroupKind{Group: "core.kcp.io", Kind: "Shard"},
+	schema.GroupKind{Group: "tenancy.kcp.io", Kind: "Workspace"},
+	schema.GroupKind{Group: "tenancy.kcp.io", Kind: "WorkspaceType"},
+)
+
+// NewRESTMapper returns a static RESTMapper for all kinds of the scheme. The
+// well-known cluster-scoped kinds of Kubernetes and kcp are mapped as such,
+// all other kinds as namespaced. Additional cluster-scoped kinds can be
+// passed explicitly.
+func NewRESTMapper(scheme *runtime.Scheme, clusterScoped ...schema.GroupKind) apimeta.RESTMapper {
+	rootScoped := clusterScopedKinds.Clone().Insert(clusterScoped...)
+
+	mapper := apimeta.NewDefaultRESTMapper(scheme.PrioritizedVersionsAllGroups())
+	for gvk := range scheme.AllKnownTypes() {
+		if gvk.Version == runtime.APIVersionInternal || strings.HasSuffix(gvk.Kind, "List") {
+			continue
+		}
+		scope := apimeta.RESTScopeNamespace
+		if rootScoped.Has(gvk.GroupKind()) {
+			scope = apimeta.RESTScopeRoot
+		}
+		mapper.Add(gvk, scope)
+	}
+	return mapper
+}
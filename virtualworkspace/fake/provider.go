@@ -0,0 +1,296 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fake provides an in-memory multicluster.Provider and wildcard cache
+// for unit testing multicluster reconcilers without a kcp instance.
+//
+// Logical clusters are engaged and disengaged explicitly from test code. Each
+// cluster is backed by a controller-runtime fake client and all clusters feed
+// one shared WildcardCache, so informers see the objects of all clusters
+// annotated with their logical cluster, just like with the virtualworkspace
+// provider.
+package fake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/kcp-dev/logicalcluster/v3"
+
+	mcmanager "github.com/multicluster-runtime/multicluster-runtime/pkg/manager"
+	"github.com/multicluster-runtime/multicluster-runtime/pkg/multicluster"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+)
+
+var _ multicluster.Provider = &Provider{}
+
+// Provider is an in-memory multicluster.Provider. Logical clusters are added
+// with EngageCluster and removed with DisengageCluster. While Run is active,
+// they are engaged with the manager as well.
+type Provider struct {
+	opts  Options
+	cache *WildcardCache
+
+	lock      sync.RWMutex
+	clusters  map[logicalcluster.Name]*Cluster
+	cancelFns map[logicalcluster.Name]context.CancelFunc
+	indexes   []index
+
+	// mgr and ctx are set while Run is active.
+	mgr mcmanager.Manager
+	ctx context.Context
+
+	// stopCache stops the wildcard cache started by the first Run.
+	stopCache context.CancelFunc
+	cacheDone chan struct{}
+}
+
+// Options are the options for creating a new fake provider.
+type Options struct {
+	// Scheme is the scheme of all clusters. It defaults to the client-go
+	// scheme.
+	Scheme *runtime.Scheme
+
+	// RESTMapper is the RESTMapper of all clusters. It defaults to
+	// NewRESTMapper for the scheme.
+	RESTMapper apimeta.RESTMapper
+
+	// StatusSubresources are the types whose status is only written through
+	// the status subresource. See fake.ClientBuilder.WithStatusSubresource.
+	StatusSubresources []client.Object
+}
+
+type indexKey struct {
+	gvk   schema.GroupVersionKind
+	field string
+}
+
+type index struct {
+	indexKey
+	obj          client.Object
+	extractValue client.IndexerFunc
+}
+
+// NewProvider returns a fake provider without any logical clusters.
+func NewProvider(opts Options) *Provider {
+	if opts.Scheme == nil {
+		opts.Scheme = scheme.Scheme
+	}
+	if opts.RESTMapper == nil {
+		opts.RESTMapper = NewRESTMapper(opts.Scheme)
+	}
+
+	return &Provider{
+		opts:      opts,
+		cache:     NewWildcardCache(opts.Scheme, opts.RESTMapper),
+		clusters:  map[logicalcluster.Name]*Cluster{},
+		cancelFns: map[logicalcluster.Name]context.CancelFunc{},
+	}
+}
+
+// Run starts the wildcard cache, engages all logical clusters with the
+// manager and blocks until the context is done. Clusters added while Run is
+// active are engaged right away. On return, all clusters are disengaged from
+// the manager but kept in the provider, and Run can be called again. The
+// manager may be nil to only start the wildcard cache.
+//
+// Like with the virtualworkspace provider, the wildcard cache is started by
+// the first Run and keeps running across calls until Stop is called.
+func (p *Provider) Run(ctx context.Context, mgr mcmanager.Manager) error {
+	p.lock.Lock()
+	if p.ctx != nil {
+		p.lock.Unlock()
+		return errors.New("fake provider is already running")
+	}
+	if p.cacheDone == nil {
+		cacheCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		done := make(chan struct{})
+		p.stopCache, p.cacheDone = cancel, done
+		go func() {
+			defer close(done)
+			_ = p.cache.Start(cacheCtx)
+		}()
+	}
+	p.mgr, p.ctx = mgr, ctx
+	clusterNames := slices.Sorted(maps.Keys(p.clusters))
+	p.lock.Unlock()
+
+	defer func() {
+		p.lock.Lock()
+		defer p.lock.Unlock()
+		for _, cancel := range p.cancelFns {
+			cancel()
+		}
+		clear(p.cancelFns)
+		p.mgr, p.ctx = nil, nil
+	}()
+
+	// engage outside of the lock, the manager may call back into Get.
+	var errs []error
+	for _, clusterName := range clusterNames {
+		errs = append(errs, p.engage(clusterName))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	<-ctx.Done()
+	return nil
+}
+
+// Stop stops the wildcard cache started by Run and waits until it stopped.
+func (p *Provider) Stop() {
+	p.lock.Lock()
+	stop, done := p.stopCache, p.cacheDone
+	p.lock.Unlock()
+
+	if stop == nil {
+		return
+	}
+	stop()
+	<-done
+}
+
+// EngageCluster adds a logical cluster holding the given objects. The objects
+// are copied and annotated with the logical cluster. While Run is active, the
+// cluster is engaged with the manager before EngageCluster returns.
+func (p *Provider) EngageCluster(name logicalcluster.Name, objs ...client.Object) (*Cluster, error) {
+	p.lock.Lock()
+	if _, ok := p.clusters[name]; ok {
+		p.lock.Unlock()
+		return nil, fmt.Errorf("cluster %q already exists", name)
+	}
+	cl, err := newCluster(name, p.opts, p.cache, p.indexes, objs)
+	if err != nil {
+		p.cache.deleteCluster(name)
+		p.lock.Unlock()
+		return nil, err
+	}
+	p.clusters[name] = cl
+	p.lock.Unlock()
+
+	if err := p.engage(name); err != nil {
+		p.lock.Lock()
+		defer p.lock.Unlock()
+		if p.clusters[name] == cl {
+			delete(p.clusters, name)
+			p.cache.deleteCluster(name)
+		}
+		return nil, err
+	}
+	return cl, nil
+}
+
+// DisengageCluster removes a logical cluster and all its objects, like a
+// deleted workspace. Its engagement context, if any, is cancelled.
+func (p *Provider) DisengageCluster(name logicalcluster.Name) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if cancel, ok := p.cancelFns[name]; ok {
+		cancel()
+		delete(p.cancelFns, name)
+	}
+	delete(p.clusters, name)
+	p.cache.deleteCluster(name)
+}
+
+// engage engages the given cluster with the manager while Run is active,
+// unless it is engaged already. The manager is called without holding the
+// lock.
+func (p *Provider) engage(name logicalcluster.Name) error {
+	p.lock.Lock()
+	mgr, cl := p.mgr, p.clusters[name]
+	if mgr == nil || cl == nil {
+		p.lock.Unlock()
+		return nil
+	}
+	if _, ok := p.cancelFns[name]; ok {
+		// Run and EngageCluster raced for the cluster, the other one
+		// engaged it.
+		p.lock.Unlock()
+		return nil
+	}
+	// the cancel func is registered upfront, so that a concurrent
+	// DisengageCluster or the end of Run cancels the engagement.
+	ctx, cancel := context.WithCancel(p.ctx)
+	p.cancelFns[name] = cancel
+	p.lock.Unlock()
+
+	if err := mgr.Engage(ctx, name.String(), cl); err != nil {
+		cancel()
+		p.lock.Lock()
+		delete(p.cancelFns, name)
+		p.lock.Unlock()
+		return fmt.Errorf("failed to engage cluster %q: %w", name, err)
+	}
+	return nil
+}
+
+// Get returns a cluster by name.
+func (p *Provider) Get(_ context.Context, name string) (cluster.Cluster, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	if cl, ok := p.clusters[logicalcluster.Name(name)]; ok {
+		return cl, nil
+	}
+
+	return nil, fmt.Errorf("cluster %q not found", name)
+}
+
+// GetWildcard returns the wildcard cache.
+func (p *Provider) GetWildcard() cache.Cache {
+	return p.cache
+}
+
+// WildcardCache returns the wildcard cache. Its AsWildcardCache can be handed
+// to virtualworkspace.Options to drive the real provider.
+func (p *Provider) WildcardCache() *WildcardCache {
+	return p.cache
+}
+
+// IndexField adds a field index to the wildcard cache and to the clients of
+// all clusters engaged afterwards. Indexes of existing clusters cannot be
+// changed.
+func (p *Provider) IndexField(ctx context.Context, obj client.Object, field string, extractValue client.IndexerFunc) error {
+	gvk, err := p.cache.gvkFor(obj)
+	if err != nil {
+		return err
+	}
+	if err := p.cache.IndexField(ctx, obj, field, extractValue); err != nil {
+		return err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.indexes = append(p.indexes, index{
+		indexKey:     indexKey{gvk: gvk, field: field},
+		obj:          obj,
+		extractValue: extractValue,
+	})
+	return nil
+}
@@ -0,0 +1,345 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	kcpcache "github.com/kcp-dev/apimachinery/v2/pkg/cache"
+	"github.com/kcp-dev/logicalcluster/v3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kcp-dev/multicluster-provider/virtualworkspace"
+	"github.com/kcp-dev/multicluster-provider/virtualworkspace/fakeserver"
+
+	mcmanager "github.com/multicluster-runtime/multicluster-runtime/pkg/manager"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+)
+
+func TestProvider(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p := NewProvider(Options{})
+	defer p.Stop()
+	require.NoError(t, p.IndexField(ctx, &corev1.ConfigMap{}, "data.key", func(obj client.Object) []string {
+		return []string{obj.(*corev1.ConfigMap).Data["key"]}
+	}))
+
+	foo, err := p.EngageCluster("foo", &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "initial"},
+		Data:       map[string]string{"key": "a"},
+	})
+	require.NoError(t, err)
+	_, err = p.EngageCluster("foo")
+	require.Error(t, err, "clusters must be unique")
+	bar, err := p.EngageCluster("bar")
+	require.NoError(t, err)
+
+	go func() {
+		_ = p.Run(ctx, nil)
+	}()
+
+	var (
+		lock sync.Mutex
+		seen []string
+	)
+	inf, err := foo.GetCache().GetInformer(ctx, &corev1.ConfigMap{})
+	require.NoError(t, err)
+	_, err = inf.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			lock.Lock()
+			defer lock.Unlock()
+			seen = append(seen, obj.(*corev1.ConfigMap).Name)
+		},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, bar.GetClient().Create(ctx, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "other"},
+		Data:       map[string]string{"key": "a"},
+	}))
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "created"}}
+	require.NoError(t, foo.GetClient().Create(ctx, cm))
+	require.Equal(t, "foo", cm.Annotations[logicalcluster.AnnotationKey], "object must be annotated with its cluster")
+	require.NotEmpty(t, cm.UID)
+
+	require.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(seen) == 2
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "cluster informer must see its own objects only")
+	require.ElementsMatch(t, []string{"initial", "created"}, seen)
+
+	shInf, _, _, found, err := p.WildcardCache().GetSharedInformer(&corev1.ConfigMap{})
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Eventually(t, func() bool {
+		objs, err := shInf.GetIndexer().ByIndex(kcpcache.ClusterIndexName, "bar")
+		return err == nil && len(objs) == 1
+	}, wait.ForeverTestTimeout, 10*time.Millisecond)
+	objs, err := shInf.GetIndexer().ByIndex(virtualworkspace.FieldIndexName("data.key"), "foo|default/a")
+	require.NoError(t, err)
+	require.Len(t, objs, 1, "field index must be scoped to the cluster")
+
+	cms := &corev1.ConfigMapList{}
+	require.NoError(t, foo.GetCache().List(ctx, cms, client.MatchingFields{"data.key": "a"}))
+	require.Len(t, cms.Items, 1)
+
+	err = p.WildcardCache().Get(ctx, client.ObjectKey{Namespace: "default", Name: "missing"}, &corev1.ConfigMap{})
+	require.True(t, apierrors.IsNotFound(err), "expected NotFound, got %v", err)
+	require.Equal(t, "configmaps", err.(apierrors.APIStatus).Status().Details.Kind, "NotFound must name the resource")
+
+	p.DisengageCluster("bar")
+	_, err = p.Get(ctx, "bar")
+	require.Error(t, err)
+	require.Eventually(t, func() bool {
+		objs, err := shInf.GetIndexer().ByIndex(kcpcache.ClusterIndexName, "bar")
+		return err == nil && len(objs) == 0
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "objects of a disengaged cluster must be removed")
+}
+
+// clusterRecorder is a multicluster runnable that looks up every engaged
+// cluster through the manager, like controllers do.
+type clusterRecorder struct {
+	mgr mcmanager.Manager
+
+	lock    sync.Mutex
+	engaged map[string]context.Context
+}
+
+func (r *clusterRecorder) Start(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (r *clusterRecorder) Engage(ctx context.Context, name string, _ cluster.Cluster) error {
+	if _, err := r.mgr.GetCluster(ctx, name); err != nil {
+		return err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.engaged[name] = ctx
+	return nil
+}
+
+// active returns the names of the clusters whose engagement is not done.
+func (r *clusterRecorder) active() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var names []string
+	for name, ctx := range r.engaged {
+		if ctx.Err() == nil {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestProviderWithManager(t *testing.T) {
+	srv := fakeserver.New(nil)
+	defer srv.Close()
+
+	p := NewProvider(Options{})
+	defer p.Stop()
+	_, err := p.EngageCluster("foo", &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "a"}})
+	require.NoError(t, err)
+
+	mgr, err := mcmanager.New(srv.ClusterConfig("host"), p, manager.Options{
+		Metrics: metricsserver.Options{BindAddress: "0"},
+	})
+	require.NoError(t, err)
+	rec := &clusterRecorder{mgr: mgr, engaged: map[string]context.Context{}}
+	require.NoError(t, mgr.Add(rec))
+
+	// run starts the provider with a new context and returns a function
+	// stopping it again.
+	run := func() func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			done <- p.Run(ctx, mgr)
+		}()
+		return func() {
+			cancel()
+			select {
+			case err := <-done:
+				require.NoError(t, err)
+			case <-time.After(wait.ForeverTestTimeout):
+				t.Fatal("provider did not stop")
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = mgr.Start(ctx)
+	}()
+
+	stop := run()
+	require.Eventually(t, func() bool {
+		return slices.Equal(rec.active(), []string{"foo"})
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "existing cluster must be engaged")
+	_, err = p.EngageCluster("bar")
+	require.NoError(t, err)
+	require.Equal(t, []string{"bar", "foo"}, rec.active(), "new cluster must be engaged right away")
+	stop()
+	require.Empty(t, rec.active(), "all clusters must be disengaged when Run returns")
+
+	// the wildcard cache keeps running for the next Run.
+	stop = run()
+	require.Eventually(t, func() bool {
+		return slices.Equal(rec.active(), []string{"bar", "foo"})
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "clusters must be engaged again")
+	syncCtx, syncCancel := context.WithTimeout(ctx, wait.ForeverTestTimeout)
+	defer syncCancel()
+	inf, err := p.GetWildcard().GetInformer(syncCtx, &corev1.ConfigMap{})
+	require.NoError(t, err, "wildcard cache must keep running")
+	require.Len(t, inf.(toolscache.SharedIndexInformer).GetIndexer().List(), 1)
+	stop()
+}
+
+func TestWildcardCacheDrivesProvider(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := fakeserver.New(nil)
+	defer srv.Close()
+
+	f := NewProvider(Options{})
+	_, err := f.EngageCluster("foo", &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "a"}})
+	require.NoError(t, err)
+
+	// the real provider starts the fake wildcard cache and engages the
+	// clusters found in it.
+	p, err := virtualworkspace.New(srv.Config(), &corev1.ConfigMap{}, virtualworkspace.Options{
+		WildcardCache: f.WildcardCache().AsWildcardCache(),
+	})
+	require.NoError(t, err)
+	mgr, err := mcmanager.New(srv.ClusterConfig("host"), p, manager.Options{
+		Metrics: metricsserver.Options{BindAddress: "0"},
+	})
+	require.NoError(t, err)
+	rec := &clusterRecorder{mgr: mgr, engaged: map[string]context.Context{}}
+	require.NoError(t, mgr.Add(rec))
+
+	go func() {
+		_ = mgr.Start(ctx)
+	}()
+	go func() {
+		_ = p.Run(ctx, mgr)
+	}()
+	require.Eventually(t, func() bool {
+		return slices.Equal(rec.active(), []string{"foo"})
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "cluster of the fake cache must be engaged")
+}
+
+// engagementCounter is a manager counting the engagements of every cluster.
+// Engagements of clusters in blocked wait until their channel is closed.
+type engagementCounter struct {
+	mcmanager.Manager
+
+	lock    sync.Mutex
+	counts  map[string]int
+	ctxs    []context.Context
+	blocked map[string]chan struct{}
+	entered chan string
+}
+
+func (c *engagementCounter) Engage(ctx context.Context, name string, _ cluster.Cluster) error {
+	c.lock.Lock()
+	c.counts[name]++
+	c.ctxs = append(c.ctxs, ctx)
+	block := c.blocked[name]
+	c.lock.Unlock()
+
+	if block != nil {
+		c.entered <- name
+		<-block
+	}
+	return nil
+}
+
+func (c *engagementCounter) count(name string) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.counts[name]
+}
+
+func TestProviderRunRacesEngageCluster(t *testing.T) {
+	p := NewProvider(Options{})
+	defer p.Stop()
+	_, err := p.EngageCluster("a")
+	require.NoError(t, err)
+	_, err = p.EngageCluster("b")
+	require.NoError(t, err)
+
+	release := make(chan struct{})
+	mgr := &engagementCounter{
+		counts:  map[string]int{},
+		blocked: map[string]chan struct{}{"a": release},
+		entered: make(chan string),
+	}
+
+	// Run snapshots a and b and engages them one after another outside of
+	// the lock. While it engages a, b is replaced and engaged by
+	// EngageCluster.
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- p.Run(ctx, mgr)
+	}()
+	select {
+	case name := <-mgr.entered:
+		require.Equal(t, "a", name)
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatal("provider did not engage a")
+	}
+	p.DisengageCluster("b")
+	_, err = p.EngageCluster("b")
+	require.NoError(t, err)
+	require.Equal(t, 1, mgr.count("b"))
+
+	close(release)
+	cancel()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatal("provider did not stop")
+	}
+	require.Equal(t, 1, mgr.count("a"))
+	require.Equal(t, 1, mgr.count("b"), "Run must not engage a cluster engaged by EngageCluster again")
+	for _, ctx := range mgr.ctxs {
+		require.Error(t, ctx.Err(), "all engagements must end with Run")
+	}
+}
@@ -0,0 +1,583 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fakeserver provides an in-process stand-in for a kcp virtual
+// workspace apiserver, for integration tests of the virtualworkspace provider
+// without kcp binaries.
+//
+// The server serves /clusters/* for lists and watches across all logical
+// clusters and /clusters/<name> for CRUD within one logical cluster. Objects
+// are kept in memory and annotated with the logical cluster they belong to,
+// like kcp does. Discovery is served for the configured resources only.
+package fakeserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/kcp-dev/logicalcluster/v3"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+)
+
+// Resource is a resource served by the server.
+type Resource struct {
+	// GroupVersionKind is the kind of the resource.
+	GroupVersionKind schema.GroupVersionKind
+	// Resource is the plural resource name.
+	Resource string
+	// Namespaced is true for namespaced resources.
+	Namespaced bool
+	// Status is true if the resource has a status subresource.
+	Status bool
+}
+
+// GroupVersionResource returns the GroupVersionResource of the resource.
+func (r Resource) GroupVersionResource() schema.GroupVersionResource {
+	return r.GroupVersionKind.GroupVersion().WithResource(r.Resource)
+}
+
+// DefaultResources are served if no resources are given to New.
+var DefaultResources = []Resource{
+	{GroupVersionKind: corev1.SchemeGroupVersion.WithKind("Namespace"), Resource: "namespaces", Status: true},
+	{GroupVersionKind: corev1.SchemeGroupVersion.WithKind("ConfigMap"), Resource: "configmaps", Namespaced: true},
+	{GroupVersionKind: corev1.SchemeGroupVersion.WithKind("Secret"), Resource: "secrets", Namespaced: true},
+}
+
+// Server is a fake virtual workspace apiserver.
+type Server struct {
+	*httptest.Server
+
+	resources []Resource
+	decoder   runtime.Decoder
+	store     *store
+}
+
+// New starts a fake virtual workspace apiserver serving the given resources.
+// Request bodies are decoded with the given scheme, which defaults to the
+// client-go scheme, so typed clients may use protobuf. Responses are always
+// JSON. The server must be closed by the caller.
+func New(sch *runtime.Scheme, resources ...Resource) *Server {
+	if sch == nil {
+		sch = scheme.Scheme
+	}
+	if len(resources) == 0 {
+		resources = DefaultResources
+	}
+
+	s := &Server{
+		resources: resources,
+		decoder:   serializer.NewCodecFactory(sch).UniversalDeserializer(),
+		store:     newStore(),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Config returns a rest.Config for the base path of the server, as expected
+// by virtualworkspace.New and virtualworkspace.NewWildcardCache.
+func (s *Server) Config() *rest.Config {
+	return &rest.Config{Host: s.URL}
+}
+
+// ClusterConfig returns a rest.Config for a single logical cluster.
+func (s *Server) ClusterConfig(clusterName logicalcluster.Name) *rest.Config {
+	return &rest.Config{Host: s.URL + clusterName.Path().RequestPath()}
+}
+
+// DeleteCluster removes all objects of a logical cluster at once, ignoring
+// finalizers, like the deletion of a workspace does.
+func (s *Server) DeleteCluster(clusterName logicalcluster.Name) {
+	s.store.deleteCluster(clusterName)
+}
+
+// Close ends all watches and shuts the server down.
+func (s *Server) Close() {
+	s.store.close()
+	s.Server.Close()
+}
+
+// Compact drops the watch history and closes all watches. Watches resuming
+// from a resource version before the compaction fail with 410 Gone.
+func (s *Server) Compact() {
+	s.store.compact()
+}
+
+// request is a parsed resource request.
+type request struct {
+	cluster     logicalcluster.Name
+	resource    Resource
+	namespace   string
+	name        string
+	subresource string
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 3 || parts[0] != "clusters" || parts[1] == "" {
+		writeError(w, apierrors.NewNotFound(schema.GroupResource{}, r.URL.Path))
+		return
+	}
+	clusterName := logicalcluster.Name(parts[1])
+	parts = parts[2:]
+
+	var gv schema.GroupVersion
+	switch {
+	case parts[0] == "api" && len(parts) == 1:
+		writeJSON(w, http.StatusOK, &metav1.APIVersions{
+			TypeMeta: metav1.TypeMeta{Kind: "APIVersions", APIVersion: "v1"},
+			Versions: []string{"v1"},
+		})
+		return
+	case parts[0] == "apis" && len(parts) == 1:
+		writeJSON(w, http.StatusOK, s.groups())
+		return
+	case parts[0] == "apis" && len(parts) == 2:
+		for _, g := range s.groups().Groups {
+			if g.Name == parts[1] {
+				writeJSON(w, http.StatusOK, &g)
+				return
+			}
+		}
+		writeError(w, apierrors.NewNotFound(schema.GroupResource{}, r.URL.Path))
+		return
+	case parts[0] == "api":
+		gv, parts = schema.GroupVersion{Version: parts[1]}, parts[2:]
+	case parts[0] == "apis":
+		gv, parts = schema.GroupVersion{Group: parts[1], Version: parts[2]}, parts[3:]
+	default:
+		writeError(w, apierrors.NewNotFound(schema.GroupResource{}, r.URL.Path))
+		return
+	}
+
+	if len(parts) == 0 {
+		list := s.resourceList(gv)
+		if len(list.APIResources) == 0 {
+			writeError(w, apierrors.NewNotFound(schema.GroupResource{}, r.URL.Path))
+			return
+		}
+		writeJSON(w, http.StatusOK, list)
+		return
+	}
+
+	req := request{cluster: clusterName}
+	if parts[0] == "namespaces" && len(parts) >= 3 {
+		req.namespace, parts = parts[1], parts[2:]
+	}
+	res, ok := s.resource(gv.WithResource(parts[0]))
+	if !ok || (req.namespace != "" && !res.Namespaced) {
+		writeError(w, apierrors.NewNotFound(gv.WithResource(parts[0]).GroupResource(), ""))
+		return
+	}
+	req.resource = res
+	if len(parts) > 1 {
+		req.name = parts[1]
+	}
+	if len(parts) > 2 {
+		req.subresource = parts[2]
+	}
+	if len(parts) > 3 || (req.subresource != "" && (req.subresource != "status" || !res.Status)) {
+		writeError(w, apierrors.NewNotFound(res.GroupVersionResource().GroupResource(), r.URL.Path))
+		return
+	}
+
+	// only lists and watches are possible across all clusters.
+	if clusterName == wildcardCluster && (r.Method != http.MethodGet || req.name != "") {
+		writeError(w, apierrors.NewMethodNotSupported(res.GroupVersionResource().GroupResource(), r.Method))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		switch {
+		case req.name != "":
+			s.get(w, req)
+		case r.URL.Query().Get("watch") == "true" || r.URL.Query().Get("watch") == "1":
+			s.watch(w, r, req)
+		default:
+			s.list(w, r, req)
+		}
+	case http.MethodPost:
+		s.create(w, r, req)
+	case http.MethodPut:
+		s.update(w, r, req)
+	case http.MethodPatch:
+		s.patch(w, r, req)
+	case http.MethodDelete:
+		s.delete(w, req)
+	default:
+		writeError(w, apierrors.NewMethodNotSupported(res.GroupVersionResource().GroupResource(), r.Method))
+	}
+}
+
+func (s *Server) resource(gvr schema.GroupVersionResource) (Resource, bool) {
+	for _, res := range s.resources {
+		if res.GroupVersionResource() == gvr {
+			return res, true
+		}
+	}
+	return Resource{}, false
+}
+
+func (s *Server) groups() *metav1.APIGroupList {
+	list := &metav1.APIGroupList{TypeMeta: metav1.TypeMeta{Kind: "APIGroupList", APIVersion: "v1"}}
+	for _, res := range s.resources {
+		gv := res.GroupVersionKind.GroupVersion()
+		if gv.Group == "" {
+			continue
+		}
+		gvd := metav1.GroupVersionForDiscovery{GroupVersion: gv.String(), Version: gv.Version}
+		i := slices.IndexFunc(list.Groups, func(g metav1.APIGroup) bool { return g.Name == gv.Group })
+		if i < 0 {
+			list.Groups = append(list.Groups, metav1.APIGroup{Name: gv.Group, PreferredVersion: gvd})
+			i = len(list.Groups) - 1
+		}
+		if !slices.Contains(list.Groups[i].Versions, gvd) {
+			list.Groups[i].Versions = append(list.Groups[i].Versions, gvd)
+		}
+	}
+	return list
+}
+
+func (s *Server) resourceList(gv schema.GroupVersion) *metav1.APIResourceList {
+	list := &metav1.APIResourceList{
+		TypeMeta:     metav1.TypeMeta{Kind: "APIResourceList", APIVersion: "v1"},
+		GroupVersion: gv.String(),
+	}
+	for _, res := range s.resources {
+		if res.GroupVersionKind.GroupVersion() != gv {
+			continue
+		}
+		list.APIResources = append(list.APIResources, metav1.APIResource{
+			Name:         res.Resource,
+			SingularName: strings.ToLower(res.GroupVersionKind.Kind),
+			Namespaced:   res.Namespaced,
+			Kind:         res.GroupVersionKind.Kind,
+			Verbs:        metav1.Verbs{"create", "delete", "get", "list", "patch", "update", "watch"},
+		})
+		if res.Status {
+			list.APIResources = append(list.APIResources, metav1.APIResource{
+				Name:       res.Resource + "/status",
+				Namespaced: res.Namespaced,
+				Kind:       res.GroupVersionKind.Kind,
+				Verbs:      metav1.Verbs{"get", "patch", "update"},
+			})
+		}
+	}
+	return list
+}
+
+func (s *Server) key(req request) objectKey {
+	return objectKey{cluster: req.cluster, namespace: req.namespace, name: req.name}
+}
+
+func (s *Server) filter(r *http.Request, req request) (filter, error) {
+	f := filter{resource: req.resource.GroupVersionResource(), cluster: req.cluster, namespace: req.namespace}
+
+	var err error
+	if sel := r.URL.Query().Get("labelSelector"); sel != "" {
+		if f.labels, err = labels.Parse(sel); err != nil {
+			return f, apierrors.NewBadRequest(err.Error())
+		}
+	}
+	if sel := r.URL.Query().Get("fieldSelector"); sel != "" {
+		if f.fields, err = fields.ParseSelector(sel); err != nil {
+			return f, apierrors.NewBadRequest(err.Error())
+		}
+	}
+	return f, nil
+}
+
+func (s *Server) get(w http.ResponseWriter, req request) {
+	obj, err := s.store.get(req.resource.GroupVersionResource(), s.key(req))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, obj)
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request, req request) {
+	f, err := s.filter(r, req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	items, rv := s.store.list(f)
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(req.resource.GroupVersionKind.GroupVersion().WithKind(req.resource.GroupVersionKind.Kind + "List"))
+	list.SetResourceVersion(rv)
+	for _, item := range items {
+		list.Items = append(list.Items, *item)
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) watch(w http.ResponseWriter, r *http.Request, req request) {
+	f, err := s.filter(r, req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if r.URL.Query().Get("sendInitialEvents") == "true" {
+		writeError(w, apierrors.NewBadRequest("sendInitialEvents is not supported"))
+		return
+	}
+
+	watcher, backlog, err := s.store.watch(f, r.URL.Query().Get("resourceVersion"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer s.store.stop(watcher)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, apierrors.NewInternalError(errors.New("streaming is not supported")))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Transfer-Encoding", "chunked")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	timeout := time.Hour
+	if ts := r.URL.Query().Get("timeoutSeconds"); ts != "" {
+		if d, err := time.ParseDuration(ts + "s"); err == nil {
+			timeout = d
+		}
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	enc := json.NewEncoder(w)
+	send := func(e event) bool {
+		raw, err := json.Marshal(e.object)
+		if err != nil {
+			return false
+		}
+		if err := enc.Encode(&metav1.WatchEvent{Type: string(e.typ), Object: runtime.RawExtension{Raw: raw}}); err != nil {
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+
+	for _, e := range backlog {
+		if !send(e) {
+			return
+		}
+	}
+	for {
+		select {
+		case e := <-watcher.ch:
+			if !send(e) {
+				return
+			}
+		case <-watcher.done:
+			// drain what was queued before the watcher was stopped.
+			for {
+				select {
+				case e := <-watcher.ch:
+					if !send(e) {
+						return
+					}
+				default:
+					return
+				}
+			}
+		case <-timer.C:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *Server) create(w http.ResponseWriter, r *http.Request, req request) {
+	if req.name != "" {
+		writeError(w, apierrors.NewMethodNotSupported(req.resource.GroupVersionResource().GroupResource(), r.Method))
+		return
+	}
+	obj, err := s.decode(r, req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	created, err := s.store.create(req.resource.GroupVersionResource(), obj)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (s *Server) update(w http.ResponseWriter, r *http.Request, req request) {
+	obj, err := s.decode(r, req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if obj.GetName() != req.name {
+		writeError(w, apierrors.NewBadRequest("the name of the object does not match the name in the URL"))
+		return
+	}
+
+	updated, err := s.store.update(req.resource.GroupVersionResource(), obj, req.subresource, req.resource.Status)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// patch applies JSON patches and JSON merge patches. Strategic merge patches
+// are applied as JSON merge patches, which is good enough for the maps and
+// scalars tests usually patch.
+func (s *Server) patch(w http.ResponseWriter, r *http.Request, req request) {
+	current, err := s.store.get(req.resource.GroupVersionResource(), s.key(req))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	original, err := json.Marshal(current)
+	if err != nil {
+		writeError(w, apierrors.NewInternalError(err))
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+
+	var patched []byte
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch types.PatchType(mediaType) {
+	case types.JSONPatchType:
+		var p jsonpatch.Patch
+		if p, err = jsonpatch.DecodePatch(body); err == nil {
+			patched, err = p.Apply(original)
+		}
+	case types.MergePatchType, types.StrategicMergePatchType:
+		patched, err = jsonpatch.MergePatch(original, body)
+	default:
+		writeError(w, apierrors.NewGenericServerResponse(http.StatusUnsupportedMediaType, "patch", req.resource.GroupVersionResource().GroupResource(), req.name, fmt.Sprintf("patch type %q is not supported", mediaType), 0, false))
+		return
+	}
+	if err != nil {
+		writeError(w, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(patched); err != nil {
+		writeError(w, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+	s.defaultMeta(obj, req)
+
+	updated, err := s.store.update(req.resource.GroupVersionResource(), obj, req.subresource, req.resource.Status)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func (s *Server) delete(w http.ResponseWriter, req request) {
+	obj, err := s.store.delete(req.resource.GroupVersionResource(), s.key(req))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, obj)
+}
+
+// decode reads the object of a create or update request. Typed objects may be
+// encoded in any format of the scheme, unknown ones must be JSON.
+func (s *Server) decode(r *http.Request, req request) (*unstructured.Unstructured, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+
+	obj := &unstructured.Unstructured{}
+	if typed, _, err := s.decoder.Decode(body, nil, nil); err == nil {
+		if u, ok := typed.(*unstructured.Unstructured); ok {
+			obj = u
+		} else {
+			if obj.Object, err = runtime.DefaultUnstructuredConverter.ToUnstructured(typed); err != nil {
+				return nil, apierrors.NewBadRequest(err.Error())
+			}
+		}
+	} else if err := obj.UnmarshalJSON(body); err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+
+	s.defaultMeta(obj, req)
+	return obj, nil
+}
+
+// defaultMeta sets what the URL decides about an object.
+func (s *Server) defaultMeta(obj *unstructured.Unstructured, req request) {
+	obj.SetGroupVersionKind(req.resource.GroupVersionKind)
+	obj.SetNamespace(req.namespace)
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[logicalcluster.AnnotationKey] = req.cluster.String()
+	obj.SetAnnotations(annotations)
+}
+
+func writeJSON(w http.ResponseWriter, code int, obj any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(obj)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	var status apierrors.APIStatus
+	if !errors.As(err, &status) {
+		status = apierrors.NewInternalError(err)
+	}
+	st := status.Status()
+	st.TypeMeta = metav1.TypeMeta{Kind: "Status", APIVersion: "v1"}
+	writeJSON(w, int(st.Code), &st)
+}
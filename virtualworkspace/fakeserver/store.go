@@ -0,0 +1,390 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fakeserver
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kcp-dev/logicalcluster/v3"
+
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// wildcardCluster is the cluster name of requests across all clusters.
+const wildcardCluster = logicalcluster.Name("*")
+
+type objectKey struct {
+	cluster   logicalcluster.Name
+	namespace string
+	name      string
+}
+
+type event struct {
+	typ      watch.EventType
+	resource schema.GroupVersionResource
+	object   *unstructured.Unstructured
+	rv       int64
+}
+
+// filter selects the objects of a list or watch request.
+type filter struct {
+	resource  schema.GroupVersionResource
+	cluster   logicalcluster.Name
+	namespace string
+	labels    labels.Selector
+	fields    fields.Selector
+}
+
+func (f *filter) matches(resource schema.GroupVersionResource, obj *unstructured.Unstructured) bool {
+	if resource != f.resource {
+		return false
+	}
+	if f.cluster != wildcardCluster && logicalcluster.From(obj) != f.cluster {
+		return false
+	}
+	if f.namespace != "" && obj.GetNamespace() != f.namespace {
+		return false
+	}
+	if f.labels != nil && !f.labels.Matches(labels.Set(obj.GetLabels())) {
+		return false
+	}
+	if f.fields != nil && !f.fields.Matches(fields.Set{
+		"metadata.name":      obj.GetName(),
+		"metadata.namespace": obj.GetNamespace(),
+	}) {
+		return false
+	}
+	return true
+}
+
+type watcher struct {
+	filter filter
+	ch     chan event
+	done   chan struct{}
+}
+
+// store holds the objects of all clusters. All changes get a resource version
+// from one counter, like with etcd, and are kept in a history so that watches
+// can resume from any resource version after the last compaction.
+type store struct {
+	lock        sync.Mutex
+	rv          int64
+	compactedRV int64
+	objects     map[schema.GroupVersionResource]map[objectKey]*unstructured.Unstructured
+	history     []event
+	watchers    map[*watcher]struct{}
+	closed      bool
+}
+
+func newStore() *store {
+	return &store{
+		objects:  map[schema.GroupVersionResource]map[objectKey]*unstructured.Unstructured{},
+		watchers: map[*watcher]struct{}{},
+	}
+}
+
+func keyOf(obj *unstructured.Unstructured) objectKey {
+	return objectKey{cluster: logicalcluster.From(obj), namespace: obj.GetNamespace(), name: obj.GetName()}
+}
+
+// recordLocked bumps the resource version of the object, stores it and
+// notifies all matching watchers.
+func (s *store) recordLocked(typ watch.EventType, resource schema.GroupVersionResource, obj *unstructured.Unstructured) {
+	s.rv++
+	obj.SetResourceVersion(strconv.FormatInt(s.rv, 10))
+
+	objects := s.objects[resource]
+	if objects == nil {
+		objects = map[objectKey]*unstructured.Unstructured{}
+		s.objects[resource] = objects
+	}
+	if typ == watch.Deleted {
+		delete(objects, keyOf(obj))
+	} else {
+		objects[keyOf(obj)] = obj
+	}
+
+	e := event{typ: typ, resource: resource, object: obj.DeepCopy(), rv: s.rv}
+	s.history = append(s.history, e)
+	for w := range s.watchers {
+		if !w.filter.matches(resource, e.object) {
+			continue
+		}
+		select {
+		case w.ch <- e:
+		default:
+			// the watcher is too slow, close it so that it relists.
+			s.stopLocked(w)
+		}
+	}
+}
+
+func (s *store) stopLocked(w *watcher) {
+	if _, ok := s.watchers[w]; ok {
+		delete(s.watchers, w)
+		close(w.done)
+	}
+}
+
+func (s *store) get(resource schema.GroupVersionResource, key objectKey) (*unstructured.Unstructured, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	obj, ok := s.objects[resource][key]
+	if !ok {
+		return nil, apierrors.NewNotFound(resource.GroupResource(), key.name)
+	}
+	return obj.DeepCopy(), nil
+}
+
+func (s *store) list(f filter) ([]*unstructured.Unstructured, string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var items []*unstructured.Unstructured
+	for _, obj := range s.objects[f.resource] {
+		if f.matches(f.resource, obj) {
+			items = append(items, obj.DeepCopy())
+		}
+	}
+	slices.SortFunc(items, func(a, b *unstructured.Unstructured) int {
+		return strings.Compare(keyString(keyOf(a)), keyString(keyOf(b)))
+	})
+	return items, strconv.FormatInt(s.rv, 10)
+}
+
+func keyString(k objectKey) string {
+	return k.cluster.String() + "|" + k.namespace + "/" + k.name
+}
+
+func (s *store) create(resource schema.GroupVersionResource, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if obj.GetName() == "" && obj.GetGenerateName() != "" {
+		obj.SetName(obj.GetGenerateName() + rand.String(5))
+	}
+	if obj.GetName() == "" {
+		return nil, apierrors.NewBadRequest("name or generateName is required")
+	}
+	if _, ok := s.objects[resource][keyOf(obj)]; ok {
+		return nil, apierrors.NewAlreadyExists(resource.GroupResource(), obj.GetName())
+	}
+
+	obj.SetUID(uuid.NewUUID())
+	obj.SetCreationTimestamp(metav1.NewTime(time.Now()))
+	obj.SetGeneration(1)
+	obj.SetDeletionTimestamp(nil)
+	s.recordLocked(watch.Added, resource, obj)
+
+	return obj.DeepCopy(), nil
+}
+
+// update replaces an existing object. With the status subresource, only the
+// status is taken from the new object. Otherwise, everything is taken but the
+// status of resources with a status subresource.
+func (s *store) update(resource schema.GroupVersionResource, obj *unstructured.Unstructured, subresource string, hasStatus bool) (*unstructured.Unstructured, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	current, ok := s.objects[resource][keyOf(obj)]
+	if !ok {
+		return nil, apierrors.NewNotFound(resource.GroupResource(), obj.GetName())
+	}
+	if rv := obj.GetResourceVersion(); rv != "" && rv != current.GetResourceVersion() {
+		return nil, apierrors.NewConflict(resource.GroupResource(), obj.GetName(), fmt.Errorf("the object has been modified; please apply your changes to the latest version and try again"))
+	}
+
+	updated := current.DeepCopy()
+	switch subresource {
+	case "":
+		updated.Object = obj.DeepCopy().Object
+		if hasStatus {
+			delete(updated.Object, "status")
+			if status, ok := current.Object["status"]; ok {
+				updated.Object["status"] = status
+			}
+		}
+		// metadata the client cannot change.
+		updated.SetUID(current.GetUID())
+		updated.SetCreationTimestamp(current.GetCreationTimestamp())
+		updated.SetDeletionTimestamp(current.GetDeletionTimestamp())
+		updated.SetGeneration(current.GetGeneration())
+		if !apiequality.Semantic.DeepEqual(specOf(current), specOf(updated)) {
+			updated.SetGeneration(current.GetGeneration() + 1)
+		}
+	case "status":
+		if status, ok := obj.Object["status"]; ok {
+			updated.Object["status"] = status
+		} else {
+			delete(updated.Object, "status")
+		}
+	default:
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("subresource %q is not supported", subresource))
+	}
+
+	if updated.GetDeletionTimestamp() != nil && len(updated.GetFinalizers()) == 0 {
+		s.recordLocked(watch.Deleted, resource, updated)
+		return updated.DeepCopy(), nil
+	}
+	if apiequality.Semantic.DeepEqual(current.Object, updated.Object) {
+		return updated, nil
+	}
+	s.recordLocked(watch.Modified, resource, updated)
+
+	return updated.DeepCopy(), nil
+}
+
+// specOf returns everything of an object that bumps its generation.
+func specOf(obj *unstructured.Unstructured) map[string]any {
+	spec := obj.DeepCopy().Object
+	delete(spec, "metadata")
+	delete(spec, "status")
+	return spec
+}
+
+// delete removes an object, or marks it as being deleted if it has
+// finalizers.
+func (s *store) delete(resource schema.GroupVersionResource, key objectKey) (*unstructured.Unstructured, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	current, ok := s.objects[resource][key]
+	if !ok {
+		return nil, apierrors.NewNotFound(resource.GroupResource(), key.name)
+	}
+
+	obj := current.DeepCopy()
+	if len(obj.GetFinalizers()) == 0 {
+		s.recordLocked(watch.Deleted, resource, obj)
+		return obj.DeepCopy(), nil
+	}
+	if obj.GetDeletionTimestamp() == nil {
+		now := metav1.NewTime(time.Now())
+		obj.SetDeletionTimestamp(&now)
+		s.recordLocked(watch.Modified, resource, obj)
+	}
+	return obj.DeepCopy(), nil
+}
+
+// deleteCluster removes all objects of a logical cluster, ignoring
+// finalizers.
+func (s *store) deleteCluster(clusterName logicalcluster.Name) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for resource, objects := range s.objects {
+		var gone []*unstructured.Unstructured
+		for key, obj := range objects {
+			if key.cluster == clusterName {
+				gone = append(gone, obj.DeepCopy())
+			}
+		}
+		slices.SortFunc(gone, func(a, b *unstructured.Unstructured) int {
+			return strings.Compare(keyString(keyOf(a)), keyString(keyOf(b)))
+		})
+		for _, obj := range gone {
+			s.recordLocked(watch.Deleted, resource, obj)
+		}
+	}
+}
+
+// watch registers a watcher for all changes after the given resource
+// version. The returned events happened already and must be sent first.
+func (s *store) watch(f filter, resourceVersion string) (*watcher, []event, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return nil, nil, apierrors.NewServiceUnavailable("server is shutting down")
+	}
+	w := &watcher{filter: f, ch: make(chan event, 1000), done: make(chan struct{})}
+
+	var backlog []event
+	switch resourceVersion {
+	case "", "0":
+		// start with the current state, like a watch without resource
+		// version does.
+		for _, obj := range s.objects[f.resource] {
+			if f.matches(f.resource, obj) {
+				rv, _ := strconv.ParseInt(obj.GetResourceVersion(), 10, 64)
+				backlog = append(backlog, event{typ: watch.Added, resource: f.resource, object: obj.DeepCopy(), rv: rv})
+			}
+		}
+		slices.SortFunc(backlog, func(a, b event) int { return int(a.rv - b.rv) })
+	default:
+		rv, err := strconv.ParseInt(resourceVersion, 10, 64)
+		if err != nil {
+			return nil, nil, apierrors.NewBadRequest(fmt.Sprintf("invalid resource version %q", resourceVersion))
+		}
+		if rv < s.compactedRV {
+			return nil, nil, apierrors.NewResourceExpired(fmt.Sprintf("too old resource version: %d (%d)", rv, s.compactedRV))
+		}
+		for _, e := range s.history {
+			if e.rv > rv && f.matches(e.resource, e.object) {
+				backlog = append(backlog, e)
+			}
+		}
+	}
+
+	s.watchers[w] = struct{}{}
+	return w, backlog, nil
+}
+
+func (s *store) stop(w *watcher) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.stopLocked(w)
+}
+
+// compact drops the history and closes all watchers. Watches from older
+// resource versions fail with 410 Gone afterwards.
+func (s *store) compact() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.compactedRV = s.rv
+	s.history = nil
+	for w := range s.watchers {
+		s.stopLocked(w)
+	}
+}
+
+// close stops all watchers and rejects new ones.
+func (s *store) close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.closed = true
+	for w := range s.watchers {
+		s.stopLocked(w)
+	}
+}
@@ -0,0 +1,502 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualworkspace
+
+import (
+	"context"
+	"testing"
+
+	kcpcache "github.com/kcp-dev/apimachinery/v2/pkg/cache"
+	"github.com/kcp-dev/logicalcluster/v3"
+	"github.com/stretchr/testify/require"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	configMapGVK = corev1.SchemeGroupVersion.WithKind("ConfigMap")
+	namespaceGVK = corev1.SchemeGroupVersion.WithKind("Namespace")
+)
+
+func newConfigMap(clusterName logicalcluster.Name, namespace, name string, labels, data map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   namespace,
+			Name:        name,
+			Labels:      labels,
+			Annotations: map[string]string{logicalcluster.AnnotationKey: clusterName.String()},
+		},
+		Data: data,
+	}
+}
+
+func newNamespace(clusterName logicalcluster.Name, name string) *corev1.Namespace {
+	return &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Annotations: map[string]string{logicalcluster.AnnotationKey: clusterName.String()},
+		},
+	}
+}
+
+// newClusterAwareIndexer returns an indexer set up like the wildcard cache
+// sets up its informers, with field indexes over data.key and data.other.
+func newClusterAwareIndexer(t *testing.T, objs ...runtime.Object) cache.Indexer {
+	t.Helper()
+
+	dataIndexer := func(key string) client.IndexerFunc {
+		return func(obj client.Object) []string {
+			switch obj := obj.(type) {
+			case *corev1.ConfigMap:
+				if v, ok := obj.Data[key]; ok {
+					return []string{v}
+				}
+			case *unstructured.Unstructured:
+				if v, ok, _ := unstructured.NestedString(obj.Object, "data", key); ok {
+					return []string{v}
+				}
+			}
+			return nil
+		}
+	}
+
+	indexer := cache.NewIndexer(kcpcache.MetaClusterNamespaceKeyFunc, cache.Indexers{
+		cache.NamespaceIndex:                  cache.MetaNamespaceIndexFunc,
+		kcpcache.ClusterIndexName:             ClusterIndexFunc,
+		kcpcache.ClusterAndNamespaceIndexName: ClusterAndNamespaceIndexFunc,
+		fieldIndexName("data.key"):            ClusterFieldIndexFunc(dataIndexer("key")),
+		fieldIndexName("data.other"):          ClusterFieldIndexFunc(dataIndexer("other")),
+	})
+	for _, obj := range objs {
+		require.NoError(t, indexer.Add(obj))
+	}
+	return indexer
+}
+
+func toUnstructured(t *testing.T, obj runtime.Object, gvk schema.GroupVersionKind) *unstructured.Unstructured {
+	t.Helper()
+
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	require.NoError(t, err)
+	ret := &unstructured.Unstructured{Object: u}
+	ret.SetGroupVersionKind(gvk)
+	return ret
+}
+
+func TestCacheReaderGet(t *testing.T) {
+	indexer := newClusterAwareIndexer(t,
+		newConfigMap("foo", "default", "a", nil, map[string]string{"cluster": "foo"}),
+		newConfigMap("bar", "default", "a", nil, map[string]string{"cluster": "bar"}),
+		newConfigMap("bar", "default", "b", nil, map[string]string{"cluster": "bar"}),
+	)
+	nsIndexer := newClusterAwareIndexer(t,
+		newNamespace("foo", "default"),
+		newNamespace("bar", "kube-system"),
+	)
+
+	tests := []struct {
+		name        string
+		indexer     cache.Indexer
+		gvk         schema.GroupVersionKind
+		scope       apimeta.RESTScopeName
+		clusterName logicalcluster.Name
+		key         client.ObjectKey
+		out         client.Object
+
+		wantNotFound bool
+		wantErr      bool
+		wantCluster  logicalcluster.Name
+	}{
+		{
+			name:        "namespaced object of the cluster",
+			indexer:     indexer,
+			gvk:         configMapGVK,
+			scope:       apimeta.RESTScopeNameNamespace,
+			clusterName: "foo",
+			key:         client.ObjectKey{Namespace: "default", Name: "a"},
+			out:         &corev1.ConfigMap{},
+			wantCluster: "foo",
+		},
+		{
+			name:         "namespaced object of another cluster",
+			indexer:      indexer,
+			gvk:          configMapGVK,
+			scope:        apimeta.RESTScopeNameNamespace,
+			clusterName:  "foo",
+			key:          client.ObjectKey{Namespace: "default", Name: "b"},
+			out:          &corev1.ConfigMap{},
+			wantNotFound: true,
+		},
+		{
+			name:         "namespaced object in another namespace",
+			indexer:      indexer,
+			gvk:          configMapGVK,
+			scope:        apimeta.RESTScopeNameNamespace,
+			clusterName:  "foo",
+			key:          client.ObjectKey{Namespace: "other", Name: "a"},
+			out:          &corev1.ConfigMap{},
+			wantNotFound: true,
+		},
+		{
+			name:        "cluster-scoped object ignores the namespace",
+			indexer:     nsIndexer,
+			gvk:         namespaceGVK,
+			scope:       apimeta.RESTScopeNameRoot,
+			clusterName: "foo",
+			key:         client.ObjectKey{Namespace: "ignored", Name: "default"},
+			out:         &corev1.Namespace{},
+			wantCluster: "foo",
+		},
+		{
+			name:         "cluster-scoped object of another cluster",
+			indexer:      nsIndexer,
+			gvk:          namespaceGVK,
+			scope:        apimeta.RESTScopeNameRoot,
+			clusterName:  "foo",
+			key:          client.ObjectKey{Name: "kube-system"},
+			out:          &corev1.Namespace{},
+			wantNotFound: true,
+		},
+		{
+			name:    "cluster-aware indexer without cluster",
+			indexer: indexer,
+			gvk:     configMapGVK,
+			scope:   apimeta.RESTScopeNameNamespace,
+			key:     client.ObjectKey{Namespace: "default", Name: "a"},
+			out:     &corev1.ConfigMap{},
+			wantErr: true,
+		},
+		{
+			name:        "wrong output type",
+			indexer:     indexer,
+			gvk:         configMapGVK,
+			scope:       apimeta.RESTScopeNameNamespace,
+			clusterName: "foo",
+			key:         client.ObjectKey{Namespace: "default", Name: "a"},
+			out:         &corev1.Secret{},
+			wantErr:     true,
+		},
+		{
+			name: "unstructured object",
+			indexer: newClusterAwareIndexer(t,
+				toUnstructured(t, newConfigMap("foo", "default", "a", nil, nil), configMapGVK),
+				toUnstructured(t, newConfigMap("bar", "default", "a", nil, nil), configMapGVK),
+			),
+			gvk:         configMapGVK,
+			scope:       apimeta.RESTScopeNameNamespace,
+			clusterName: "bar",
+			key:         client.ObjectKey{Namespace: "default", Name: "a"},
+			out:         &unstructured.Unstructured{},
+			wantCluster: "bar",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &cacheReader{
+				indexer:          tt.indexer,
+				groupVersionKind: tt.gvk,
+				scopeName:        tt.scope,
+				clusterName:      tt.clusterName,
+			}
+
+			err := cr.Get(context.Background(), tt.key, tt.out)
+			switch {
+			case tt.wantNotFound:
+				require.True(t, apierrors.IsNotFound(err), "expected NotFound, got %v", err)
+				return
+			case tt.wantErr:
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantCluster, logicalcluster.From(tt.out))
+			require.Equal(t, tt.key.Name, tt.out.GetName())
+			require.Equal(t, tt.gvk, tt.out.GetObjectKind().GroupVersionKind())
+		})
+	}
+}
+
+func TestCacheReaderList(t *testing.T) {
+	objs := []*corev1.ConfigMap{
+		newConfigMap("foo", "default", "a", map[string]string{"app": "x"}, map[string]string{"key": "1", "other": "1"}),
+		newConfigMap("foo", "default", "b", map[string]string{"app": "y"}, map[string]string{"key": "1", "other": "2"}),
+		newConfigMap("foo", "other", "c", map[string]string{"app": "x"}, map[string]string{"key": "1", "other": "1"}),
+		newConfigMap("foo", "other", "d", nil, map[string]string{"key": "2"}),
+		newConfigMap("bar", "default", "a", map[string]string{"app": "x"}, map[string]string{"key": "1", "other": "1"}),
+		newConfigMap("bar", "default", "e", map[string]string{"app": "x"}, map[string]string{"key": "1", "other": "1"}),
+	}
+	typed := make([]runtime.Object, 0, len(objs))
+	untyped := make([]runtime.Object, 0, len(objs))
+	for _, obj := range objs {
+		typed = append(typed, obj)
+		untyped = append(untyped, toUnstructured(t, obj, configMapGVK))
+	}
+	indexer := newClusterAwareIndexer(t, typed...)
+	unstructuredIndexer := newClusterAwareIndexer(t, untyped...)
+
+	nsIndexer := newClusterAwareIndexer(t,
+		newNamespace("foo", "default"),
+		newNamespace("foo", "other"),
+		newNamespace("bar", "default"),
+	)
+
+	tests := []struct {
+		name        string
+		indexer     cache.Indexer
+		gvk         schema.GroupVersionKind
+		scope       apimeta.RESTScopeName
+		clusterName logicalcluster.Name
+		list        client.ObjectList
+		opts        []client.ListOption
+
+		wantErr   bool
+		wantNames []string
+	}{
+		{
+			name:        "all objects of the cluster",
+			clusterName: "foo",
+			wantNames:   []string{"a", "b", "c", "d"},
+		},
+		{
+			name:        "all objects of the other cluster",
+			clusterName: "bar",
+			wantNames:   []string{"a", "e"},
+		},
+		{
+			name:        "namespace",
+			clusterName: "foo",
+			opts:        []client.ListOption{client.InNamespace("other")},
+			wantNames:   []string{"c", "d"},
+		},
+		{
+			name:        "label selector",
+			clusterName: "foo",
+			opts:        []client.ListOption{client.MatchingLabels{"app": "x"}},
+			wantNames:   []string{"a", "c"},
+		},
+		{
+			name:        "label selector and namespace",
+			clusterName: "foo",
+			opts:        []client.ListOption{client.MatchingLabels{"app": "x"}, client.InNamespace("default")},
+			wantNames:   []string{"a"},
+		},
+		{
+			name:        "field selector",
+			clusterName: "foo",
+			opts:        []client.ListOption{client.MatchingFields{"data.key": "1"}},
+			wantNames:   []string{"a", "b", "c"},
+		},
+		{
+			name:        "field selector does not cross clusters",
+			clusterName: "bar",
+			opts:        []client.ListOption{client.MatchingFields{"data.key": "1"}},
+			wantNames:   []string{"a", "e"},
+		},
+		{
+			name:        "field selector and namespace",
+			clusterName: "foo",
+			opts:        []client.ListOption{client.MatchingFields{"data.key": "1"}, client.InNamespace("other")},
+			wantNames:   []string{"c"},
+		},
+		{
+			name:        "multi-requirement field selector",
+			clusterName: "foo",
+			opts:        []client.ListOption{client.MatchingFields{"data.key": "1", "data.other": "1"}},
+			wantNames:   []string{"a", "c"},
+		},
+		{
+			name:        "multi-requirement field selector and namespace",
+			clusterName: "foo",
+			opts:        []client.ListOption{client.MatchingFields{"data.key": "1", "data.other": "2"}, client.InNamespace("default")},
+			wantNames:   []string{"b"},
+		},
+		{
+			name:        "multi-requirement field selector without matches",
+			clusterName: "foo",
+			opts:        []client.ListOption{client.MatchingFields{"data.key": "2", "data.other": "1"}},
+			wantNames:   []string{},
+		},
+		{
+			name:        "field selector and label selector",
+			clusterName: "foo",
+			opts:        []client.ListOption{client.MatchingFields{"data.key": "1"}, client.MatchingLabels{"app": "y"}},
+			wantNames:   []string{"b"},
+		},
+		{
+			name:        "non-exact field selector",
+			clusterName: "foo",
+			opts:        []client.ListOption{client.MatchingFieldsSelector{Selector: fields.OneTermNotEqualSelector("data.key", "1")}},
+			wantErr:     true,
+		},
+		{
+			name:        "field selector on unknown index",
+			clusterName: "foo",
+			opts:        []client.ListOption{client.MatchingFields{"data.unknown": "1"}},
+			wantErr:     true,
+		},
+		{
+			name:        "continue",
+			clusterName: "foo",
+			opts:        []client.ListOption{client.Continue("token")},
+			wantErr:     true,
+		},
+		{
+			name:        "unstructured objects",
+			indexer:     unstructuredIndexer,
+			clusterName: "foo",
+			list:        &unstructured.UnstructuredList{},
+			opts:        []client.ListOption{client.MatchingFields{"data.key": "1", "data.other": "1"}},
+			wantNames:   []string{"a", "c"},
+		},
+		{
+			name:        "cluster-scoped objects",
+			indexer:     nsIndexer,
+			gvk:         namespaceGVK,
+			scope:       apimeta.RESTScopeNameRoot,
+			clusterName: "foo",
+			list:        &corev1.NamespaceList{},
+			wantNames:   []string{"default", "other"},
+		},
+		{
+			name:      "all clusters without a cluster name",
+			wantNames: []string{"a", "a", "b", "c", "d", "e"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.indexer == nil {
+				tt.indexer = indexer
+			}
+			if tt.gvk.Empty() {
+				tt.gvk, tt.scope = configMapGVK, apimeta.RESTScopeNameNamespace
+			}
+			if tt.list == nil {
+				tt.list = &corev1.ConfigMapList{}
+			}
+			cr := &cacheReader{
+				indexer:          tt.indexer,
+				groupVersionKind: tt.gvk,
+				scopeName:        tt.scope,
+				clusterName:      tt.clusterName,
+			}
+
+			err := cr.List(context.Background(), tt.list, tt.opts...)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			items, err := apimeta.ExtractList(tt.list)
+			require.NoError(t, err)
+			names := []string{}
+			for _, item := range items {
+				obj := item.(client.Object)
+				names = append(names, obj.GetName())
+				if !tt.clusterName.Empty() {
+					require.Equal(t, tt.clusterName, logicalcluster.From(obj), "object of another cluster returned")
+				}
+				require.Equal(t, tt.gvk, item.GetObjectKind().GroupVersionKind())
+			}
+			require.ElementsMatch(t, tt.wantNames, names)
+		})
+	}
+}
+
+func TestCacheReaderListLimit(t *testing.T) {
+	indexer := newClusterAwareIndexer(t,
+		newConfigMap("foo", "default", "a", map[string]string{"app": "x"}, nil),
+		newConfigMap("foo", "default", "b", map[string]string{"app": "y"}, nil),
+		newConfigMap("foo", "default", "c", map[string]string{"app": "x"}, nil),
+		newConfigMap("foo", "default", "d", map[string]string{"app": "x"}, nil),
+		newConfigMap("bar", "default", "e", map[string]string{"app": "x"}, nil),
+	)
+	cr := &cacheReader{indexer: indexer, groupVersionKind: configMapGVK, scopeName: apimeta.RESTScopeNameNamespace, clusterName: "foo"}
+
+	list := &corev1.ConfigMapList{}
+	require.NoError(t, cr.List(context.Background(), list, client.Limit(2)))
+	require.Len(t, list.Items, 2)
+
+	// the limit applies after label filtering.
+	list = &corev1.ConfigMapList{}
+	require.NoError(t, cr.List(context.Background(), list, client.Limit(3), client.MatchingLabels{"app": "x"}))
+	require.Len(t, list.Items, 3)
+	for _, item := range list.Items {
+		require.Equal(t, "x", item.Labels["app"])
+	}
+}
+
+func TestCacheReaderDeepCopy(t *testing.T) {
+	cm := newConfigMap("foo", "default", "a", nil, map[string]string{"key": "value"})
+	indexer := newClusterAwareIndexer(t, cm)
+	key := client.ObjectKey{Namespace: "default", Name: "a"}
+
+	tests := []struct {
+		name            string
+		disableDeepCopy bool
+		listOpts        []client.ListOption
+		wantShared      bool
+	}{
+		{name: "deep copy"},
+		{name: "deep copy disabled on reader", disableDeepCopy: true, wantShared: true},
+		{name: "deep copy disabled on list", listOpts: []client.ListOption{client.UnsafeDisableDeepCopy}, wantShared: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &cacheReader{
+				indexer:          indexer,
+				groupVersionKind: configMapGVK,
+				scopeName:        apimeta.RESTScopeNameNamespace,
+				disableDeepCopy:  tt.disableDeepCopy,
+				clusterName:      "foo",
+			}
+
+			list := &corev1.ConfigMapList{}
+			require.NoError(t, cr.List(context.Background(), list, tt.listOpts...))
+			require.Len(t, list.Items, 1)
+			list.Items[0].Data["key"] = "mutated"
+
+			cached, exists, err := indexer.GetByKey("foo|default/a")
+			require.NoError(t, err)
+			require.True(t, exists)
+			if tt.wantShared {
+				require.Equal(t, "mutated", cached.(*corev1.ConfigMap).Data["key"])
+				cached.(*corev1.ConfigMap).Data["key"] = "value"
+				return
+			}
+			require.Equal(t, "value", cached.(*corev1.ConfigMap).Data["key"], "list must not return cached objects")
+
+			out := &corev1.ConfigMap{}
+			require.NoError(t, cr.Get(context.Background(), key, out))
+			out.Data["key"] = "mutated"
+			require.Equal(t, "value", cached.(*corev1.ConfigMap).Data["key"], "get must not return cached objects")
+			require.Empty(t, cm.GetObjectKind().GroupVersionKind(), "get must not set the kind on the cached object")
+		})
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualworkspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/kcp-dev/logicalcluster/v3"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CrossClusterWriteError is returned by scoped clients with the cross-cluster
+// write guard enabled when an object carrying the logical cluster annotation
+// of another cluster is written. This usually means that a reconciler mixed
+// up objects of different tenants.
+type CrossClusterWriteError struct {
+	// Cluster is the logical cluster of the client.
+	Cluster logicalcluster.Name
+	// ObjectCluster is the logical cluster the object is annotated with.
+	ObjectCluster logicalcluster.Name
+	// Verb is the rejected operation, e.g. "create" or "update".
+	Verb string
+	// Key is the namespace and name of the object.
+	Key client.ObjectKey
+}
+
+func (e *CrossClusterWriteError) Error() string {
+	return fmt.Sprintf("refusing to %s object %s of logical cluster %q with the client of logical cluster %q", e.Verb, e.Key, e.ObjectCluster, e.Cluster)
+}
+
+// IsCrossClusterWriteError returns true if the error, or any error it wraps,
+// is a CrossClusterWriteError.
+func IsCrossClusterWriteError(err error) bool {
+	var target *CrossClusterWriteError
+	return errors.As(err, &target)
+}
+
+var _ client.Client = &guardedClient{}
+
+// guardedClient rejects writes of objects that belong to another logical
+// cluster than the one the client is scoped to. Objects without logical
+// cluster annotation, e.g. newly constructed ones, are let through.
+type guardedClient struct {
+	client.Client
+	clusterName logicalcluster.Name
+}
+
+func newGuardedClient(cli client.Client, clusterName logicalcluster.Name) *guardedClient {
+	return &guardedClient{Client: cli, clusterName: clusterName}
+}
+
+func (c *guardedClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if err := checkObjectCluster(c.clusterName, "create", obj); err != nil {
+		return err
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *guardedClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if err := checkObjectCluster(c.clusterName, "update", obj); err != nil {
+		return err
+	}
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func (c *guardedClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if err := checkObjectCluster(c.clusterName, "patch", obj); err != nil {
+		return err
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func (c *guardedClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	if err := checkObjectCluster(c.clusterName, "delete", obj); err != nil {
+		return err
+	}
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func (c *guardedClient) Status() client.SubResourceWriter {
+	return c.SubResource("status")
+}
+
+func (c *guardedClient) SubResource(subResource string) client.SubResourceClient {
+	return &guardedSubResourceClient{SubResourceClient: c.Client.SubResource(subResource), clusterName: c.clusterName}
+}
+
+var _ client.SubResourceClient = &guardedSubResourceClient{}
+
+type guardedSubResourceClient struct {
+	client.SubResourceClient
+	clusterName logicalcluster.Name
+}
+
+func (c *guardedSubResourceClient) Create(ctx context.Context, obj client.Object, subResource client.Object, opts ...client.SubResourceCreateOption) error {
+	if err := checkObjectCluster(c.clusterName, "create", obj); err != nil {
+		return err
+	}
+	return c.SubResourceClient.Create(ctx, obj, subResource, opts...)
+}
+
+func (c *guardedSubResourceClient) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+	if err := checkObjectCluster(c.clusterName, "update", obj); err != nil {
+		return err
+	}
+	return c.SubResourceClient.Update(ctx, obj, opts...)
+}
+
+func (c *guardedSubResourceClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+	if err := checkObjectCluster(c.clusterName, "patch", obj); err != nil {
+		return err
+	}
+	return c.SubResourceClient.Patch(ctx, obj, patch, opts...)
+}
+
+// checkObjectCluster returns a CrossClusterWriteError and counts the rejected
+// write if the object is annotated with another logical cluster.
+func checkObjectCluster(clusterName logicalcluster.Name, verb string, obj client.Object) error {
+	objCluster := logicalcluster.From(obj)
+	if objCluster.Empty() || objCluster == clusterName {
+		return nil
+	}
+
+	clientCrossClusterWrites.WithLabelValues(clusterName.String(), verb).Inc()
+	return &CrossClusterWriteError{
+		Cluster:       clusterName,
+		ObjectCluster: objCluster,
+		Verb:          verb,
+		Key:           client.ObjectKeyFromObject(obj),
+	}
+}
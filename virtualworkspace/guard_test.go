@@ -0,0 +1,95 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualworkspace
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/kcp-dev/logicalcluster/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestGuardedClient(t *testing.T) {
+	ctx := context.Background()
+	clusterName := logicalcluster.Name("guarded")
+	defer forgetClusterMetrics(clusterName)
+
+	configMap := func(objCluster string) *corev1.ConfigMap {
+		cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "a"}}
+		if objCluster != "" {
+			cm.Annotations = map[string]string{logicalcluster.AnnotationKey: objCluster}
+		}
+		return cm
+	}
+	patch := client.RawPatch(types.MergePatchType, []byte(`{"data":{"key":"value"}}`))
+
+	writes := map[string]func(cli client.Client, obj client.Object) error{
+		"create": func(cli client.Client, obj client.Object) error { return cli.Create(ctx, obj) },
+		"update": func(cli client.Client, obj client.Object) error { return cli.Update(ctx, obj) },
+		"patch":  func(cli client.Client, obj client.Object) error { return cli.Patch(ctx, obj, patch) },
+		"delete": func(cli client.Client, obj client.Object) error { return cli.Delete(ctx, obj) },
+		"status update": func(cli client.Client, obj client.Object) error {
+			return cli.Status().Update(ctx, obj)
+		},
+		"status patch": func(cli client.Client, obj client.Object) error {
+			return cli.Status().Patch(ctx, obj, patch)
+		},
+		"subresource update": func(cli client.Client, obj client.Object) error {
+			return cli.SubResource("status").Update(ctx, obj)
+		},
+	}
+
+	for name, write := range writes {
+		t.Run(name, func(t *testing.T) {
+			for _, objCluster := range []string{"", clusterName.String(), "other"} {
+				t.Run(fmt.Sprintf("object cluster %q", objCluster), func(t *testing.T) {
+					existing := configMap(clusterName.String())
+					if name == "create" {
+						existing.Name = "existing"
+					}
+					cli := newGuardedClient(fake.NewClientBuilder().
+						WithScheme(scheme.Scheme).
+						WithObjects(existing).
+						WithStatusSubresource(&corev1.ConfigMap{}).
+						Build(), clusterName)
+
+					before := testutil.ToFloat64(clientCrossClusterWrites.WithLabelValues(clusterName.String(), "update"))
+					err := write(cli, configMap(objCluster))
+					if objCluster != "other" {
+						require.False(t, IsCrossClusterWriteError(err), "write of own object rejected: %v", err)
+						return
+					}
+					require.True(t, IsCrossClusterWriteError(err), "expected CrossClusterWriteError, got %v", err)
+					require.ErrorContains(t, err, `logical cluster "other"`)
+					if name == "status update" || name == "update" || name == "subresource update" {
+						require.Equal(t, before+1, testutil.ToFloat64(clientCrossClusterWrites.WithLabelValues(clusterName.String(), "update")))
+					}
+				})
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualworkspace
+
+import (
+	"errors"
+
+	mcreconcile "github.com/multicluster-runtime/multicluster-runtime/pkg/reconcile"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// HostClusterName is the reserved name under which the provider returns the
+// host cluster configured in Options.HostCluster. It is not a valid logical
+// cluster name, so it never clashes with a tenant cluster.
+const HostClusterName = "@host"
+
+// HostSource returns a source for objects of the host cluster, to be passed to
+// WatchesRawSource of the multicluster builder. The map function decides which
+// requests of tenant clusters an event of a host object enqueues, e.g. the
+// owner of a deployment created on behalf of a tenant.
+//
+// The host cluster is not engaged with the manager, so that controllers only
+// watch it through such sources and do not expect their tenant types on it.
+func (p *Provider) HostSource(obj client.Object, fn handler.TypedMapFunc[client.Object, mcreconcile.Request], predicates ...predicate.TypedPredicate[client.Object]) (source.TypedSource[mcreconcile.Request], error) {
+	if p.host == nil {
+		return nil, errors.New("no host cluster configured")
+	}
+	return source.TypedKind(p.host.GetCache(), obj, handler.TypedEnqueueRequestsFromMapFunc(fn), predicates...), nil
+}
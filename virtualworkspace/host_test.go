@@ -0,0 +1,95 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualworkspace
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kcp-dev/multicluster-provider/virtualworkspace/fakeserver"
+
+	mcreconcile "github.com/multicluster-runtime/multicluster-runtime/pkg/reconcile"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestProviderHostCluster(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := fakeserver.New(nil)
+	defer srv.Close()
+	createConfigMap(t, srv, "foo", "a")
+
+	// the host cluster is played by another cluster of the fake server.
+	host, err := cluster.New(srv.ClusterConfig("host"))
+	require.NoError(t, err)
+
+	p, err := New(srv.Config(), &corev1.ConfigMap{}, Options{HostCluster: host})
+	require.NoError(t, err)
+	defer p.Stop()
+	mgr := newEngagementRecorder()
+	go func() {
+		_ = p.Run(ctx, mgr)
+	}()
+	require.Eventually(t, func() bool {
+		return slices.Equal(mgr.active(), []string{"foo"})
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "tenant cluster must be engaged")
+
+	cl, err := p.Get(ctx, HostClusterName)
+	require.NoError(t, err)
+	require.Same(t, host, cl, "host cluster must be returned under its reserved name")
+
+	src, err := p.HostSource(&corev1.ConfigMap{}, func(_ context.Context, obj client.Object) []mcreconcile.Request {
+		return []mcreconcile.Request{{
+			ClusterName: obj.(*corev1.ConfigMap).Data["cluster"],
+			Request:     reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "tenant", Name: obj.GetName()}},
+		}}
+	})
+	require.NoError(t, err)
+	queue := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[mcreconcile.Request]())
+	defer queue.ShutDown()
+	require.NoError(t, src.Start(ctx, queue))
+
+	hostCli, err := client.New(srv.ClusterConfig("host"), client.Options{})
+	require.NoError(t, err)
+	require.NoError(t, hostCli.Create(ctx, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "b"},
+		Data:       map[string]string{"cluster": "foo"},
+	}))
+
+	require.Eventually(t, func() bool {
+		return queue.Len() == 1
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "host events must enqueue tenant requests")
+	req, _ := queue.Get()
+	require.Equal(t, mcreconcile.Request{
+		ClusterName: "foo",
+		Request:     reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "tenant", Name: "b"}},
+	}, req)
+	require.NotContains(t, mgr.active(), HostClusterName, "host cluster must not be engaged")
+}
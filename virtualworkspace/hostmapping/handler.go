@@ -0,0 +1,62 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostmapping
+
+import (
+	"context"
+
+	mchandler "github.com/multicluster-runtime/multicluster-runtime/pkg/handler"
+	mcreconcile "github.com/multicluster-runtime/multicluster-runtime/pkg/reconcile"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// OwnerRequests maps a host object to the request of the tenant object it was
+// created for, as recorded by Mapper.SetOwner. Host objects without owner map
+// to no request. Use it with virtualworkspace.Provider.HostSource.
+func OwnerRequests(_ context.Context, obj client.Object) []mcreconcile.Request {
+	clusterName, ok := obj.GetLabels()[ClusterLabel]
+	if !ok {
+		return nil
+	}
+	name, ok := obj.GetAnnotations()[OwnerNameAnnotation]
+	if !ok {
+		return nil
+	}
+	return []mcreconcile.Request{{
+		ClusterName: clusterName,
+		Request: reconcile.Request{NamespacedName: types.NamespacedName{
+			Namespace: obj.GetAnnotations()[OwnerNamespaceAnnotation],
+			Name:      name,
+		}},
+	}}
+}
+
+// EnqueueRequestForOwner returns a multicluster event handler that enqueues
+// the tenant object a host object was created for, for host clusters engaged
+// with the manager. Unlike the handlers of multicluster-runtime, it enqueues
+// the request for the logical cluster of the tenant object, not for the
+// cluster the event happened in.
+func EnqueueRequestForOwner() mchandler.TypedEventHandlerFunc[client.Object, mcreconcile.Request] {
+	return func(string, cluster.Cluster) handler.TypedEventHandler[client.Object, mcreconcile.Request] {
+		return handler.TypedEnqueueRequestsFromMapFunc(OwnerRequests)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostmapping
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kcp-dev/logicalcluster/v3"
+	"github.com/stretchr/testify/require"
+
+	mcreconcile "github.com/multicluster-runtime/multicluster-runtime/pkg/reconcile"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestEnqueueRequestForOwner(t *testing.T) {
+	m := New(fake.NewClientBuilder().Build(), Options{})
+	tenant := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   "default",
+		Name:        "app",
+		Annotations: map[string]string{logicalcluster.AnnotationKey: "foo"},
+	}}
+
+	tests := map[string]struct {
+		obj  client.Object
+		want []mcreconcile.Request
+	}{
+		"owned": {
+			obj: func() client.Object {
+				obj := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: m.HostNamespace("foo", "default"), Name: "app"}}
+				m.SetOwner(obj, tenant)
+				return obj
+			}(),
+			want: []mcreconcile.Request{{
+				ClusterName: "foo",
+				Request:     reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "app"}},
+			}},
+		},
+		"unowned": {
+			obj: &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"}},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			queue := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[mcreconcile.Request]())
+			defer queue.ShutDown()
+
+			// the cluster of the event must not matter.
+			h := EnqueueRequestForOwner()("@host", nil)
+			h.Create(context.Background(), event.TypedCreateEvent[client.Object]{Object: tt.obj}, queue)
+
+			var got []mcreconcile.Request
+			for queue.Len() > 0 {
+				req, _ := queue.Get()
+				got = append(got, req)
+				queue.Done(req)
+			}
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,402 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package hostmapping maps the namespaces of logical clusters to namespaces of
+// a host cluster, for controllers that run workloads on a host cluster on
+// behalf of their tenants in kcp.
+//
+// Every (logical cluster, namespace) pair gets its own host namespace with a
+// deterministic name, labelled with its origin. Host objects created for a
+// tenant object are labelled with their owner, so that they can be found and
+// deleted when the tenant object goes away, and all host namespaces of a
+// logical cluster can be deleted once it is gone.
+package hostmapping
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kcp-dev/logicalcluster/v3"
+
+	mcmanager "github.com/multicluster-runtime/multicluster-runtime/pkg/manager"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/sdk/apis/apis/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// ClusterLabel is the label on host namespaces and host objects holding
+	// the logical cluster they belong to.
+	ClusterLabel = "multicluster.kcp.io/cluster"
+	// NamespaceLabel is the label on host namespaces holding the namespace in
+	// the logical cluster they are mapped from.
+	NamespaceLabel = "multicluster.kcp.io/namespace"
+	// OwnerLabel is the label on host objects holding a hash of the tenant
+	// object they were created for. It can be computed from the name alone,
+	// so that host objects can be found after the tenant object is gone.
+	OwnerLabel = "multicluster.kcp.io/owner"
+	// OwnerNamespaceAnnotation is the annotation on host objects holding the
+	// namespace of the tenant object they were created for.
+	OwnerNamespaceAnnotation = "multicluster.kcp.io/owner-namespace"
+	// OwnerNameAnnotation is the annotation on host objects holding the name
+	// of the tenant object they were created for.
+	OwnerNameAnnotation = "multicluster.kcp.io/owner-name"
+	// ManagedByLabel is the well-known label naming the controller managing
+	// host namespaces.
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+
+	defaultPrefix             = "kcp"
+	defaultManagedBy          = "kcp-multicluster-provider"
+	defaultCleanupGracePeriod = time.Minute
+	hashLength                = 8
+)
+
+// Options are the options of a Mapper.
+type Options struct {
+	// Prefix starts the names of all host namespaces. It defaults to "kcp".
+	Prefix string
+
+	// ManagedBy is the value of the ManagedByLabel on host namespaces. It
+	// defaults to "kcp-multicluster-provider". Mappers with different values
+	// do not touch each other's namespaces.
+	ManagedBy string
+
+	// ClusterGone reports whether a disengaged logical cluster is gone for
+	// good, e.g. because its APIBinding or LogicalCluster does not exist
+	// anymore. The mapper deletes all host namespaces of a logical cluster
+	// that stayed disengaged for CleanupGracePeriod once ClusterGone confirms
+	// it is gone. Disengagement alone is no proof: clusters are disengaged
+	// temporarily as well, e.g. when they move to another replica with
+	// sharding.
+	//
+	// By default, a logical cluster is gone once the cache of the disengaged
+	// cluster holds no APIBinding anymore, i.e. once the APIExport is not
+	// bound in it anymore. This requires APIBinding in the scheme of the
+	// clusters, and the APIExport virtual workspace to serve APIBindings.
+	ClusterGone func(ctx context.Context, clusterName logicalcluster.Name) (bool, error)
+
+	// CleanupGracePeriod is the time a logical cluster has to stay
+	// disengaged before ClusterGone is asked. It defaults to one minute.
+	CleanupGracePeriod time.Duration
+}
+
+var _ mcmanager.Runnable = &Mapper{}
+
+// Mapper maps namespaces of logical clusters to namespaces of a host cluster.
+// Add it to the multicluster manager to clean up host namespaces of logical
+// clusters that are gone, see Options.ClusterGone.
+type Mapper struct {
+	client client.Client
+	opts   Options
+
+	// ctx is the context of Start, used to tell disengagement from shutdown.
+	ctx atomic.Pointer[context.Context]
+
+	// engagements tracks the engagements by logical cluster until the
+	// cleanup after the last one is decided.
+	lock        sync.Mutex
+	engagements map[string]*engagements
+}
+
+// engagements are the engagements of a logical cluster.
+type engagements struct {
+	// running is the number of running engagements.
+	running int
+	// ended is incremented whenever an engagement ends, so that only the
+	// last one triggers the cleanup.
+	ended int
+}
+
+// New returns a Mapper creating host namespaces with the given client of the
+// host cluster.
+func New(hostClient client.Client, opts Options) *Mapper {
+	if opts.Prefix == "" {
+		opts.Prefix = defaultPrefix
+	}
+	if opts.ManagedBy == "" {
+		opts.ManagedBy = defaultManagedBy
+	}
+	if opts.CleanupGracePeriod <= 0 {
+		opts.CleanupGracePeriod = defaultCleanupGracePeriod
+	}
+	return &Mapper{client: hostClient, opts: opts, engagements: map[string]*engagements{}}
+}
+
+// HostNamespace returns the name of the host namespace of the namespace in
+// the logical cluster. It is readable where possible, and unique by a hash
+// of the pair.
+func (m *Mapper) HostNamespace(clusterName logicalcluster.Name, namespace string) string {
+	readable := fmt.Sprintf("%s-%s-%s", m.opts.Prefix, clusterName, namespace)
+	maxReadable := validation.DNS1123LabelMaxLength - hashLength - 1
+	if len(readable) > maxReadable {
+		readable = strings.TrimRight(readable[:maxReadable], "-")
+	}
+	return readable + "-" + hash(hashLength, clusterName.String(), namespace)
+}
+
+// EnsureHostNamespace creates the host namespace of the namespace in the
+// logical cluster unless it exists, and returns its name. It fails if a
+// namespace of that name exists which is not mapped from the same pair.
+func (m *Mapper) EnsureHostNamespace(ctx context.Context, clusterName logicalcluster.Name, namespace string) (string, error) {
+	name := m.HostNamespace(clusterName, namespace)
+	labels := m.namespaceLabels(clusterName, namespace)
+
+	ns := &corev1.Namespace{}
+	err := m.client.Get(ctx, client.ObjectKey{Name: name}, ns)
+	switch {
+	case apierrors.IsNotFound(err):
+		ns = &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+		if err := m.client.Create(ctx, ns); err != nil && !apierrors.IsAlreadyExists(err) {
+			return "", fmt.Errorf("failed to create host namespace %q: %w", name, err)
+		}
+		return name, nil
+	case err != nil:
+		return "", fmt.Errorf("failed to get host namespace %q: %w", name, err)
+	}
+
+	for key, value := range labels {
+		if ns.Labels[key] != value {
+			return "", fmt.Errorf("host namespace %q is not mapped from namespace %q of logical cluster %q", name, namespace, clusterName)
+		}
+	}
+	if ns.DeletionTimestamp != nil {
+		return "", fmt.Errorf("host namespace %q is being deleted", name)
+	}
+	return name, nil
+}
+
+// DeleteHostNamespace deletes the host namespace of the namespace in the
+// logical cluster, and with it all host objects in it.
+func (m *Mapper) DeleteHostNamespace(ctx context.Context, clusterName logicalcluster.Name, namespace string) error {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: m.HostNamespace(clusterName, namespace)}}
+	if err := m.client.Delete(ctx, ns); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete host namespace %q: %w", ns.Name, err)
+	}
+	return nil
+}
+
+// DeleteHostNamespaces deletes all host namespaces of the logical cluster,
+// and with them all host objects in them.
+func (m *Mapper) DeleteHostNamespaces(ctx context.Context, clusterName logicalcluster.Name) error {
+	namespaces := &corev1.NamespaceList{}
+	if err := m.client.List(ctx, namespaces, client.MatchingLabels{
+		ClusterLabel:   clusterName.String(),
+		ManagedByLabel: m.opts.ManagedBy,
+	}); err != nil {
+		return fmt.Errorf("failed to list host namespaces: %w", err)
+	}
+	for i := range namespaces.Items {
+		ns := &namespaces.Items[i]
+		if ns.DeletionTimestamp != nil {
+			continue
+		}
+		if err := m.client.Delete(ctx, ns); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete host namespace %q: %w", ns.Name, err)
+		}
+	}
+	return nil
+}
+
+// SetOwner labels and annotates the host object as created for the tenant
+// object, which must carry its logical cluster.
+func (m *Mapper) SetOwner(host, tenant client.Object) {
+	clusterName := logicalcluster.From(tenant)
+
+	labels := host.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[ClusterLabel] = clusterName.String()
+	labels[OwnerLabel] = ownerHash(clusterName, client.ObjectKeyFromObject(tenant))
+	host.SetLabels(labels)
+
+	annotations := host.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[OwnerNamespaceAnnotation] = tenant.GetNamespace()
+	annotations[OwnerNameAnnotation] = tenant.GetName()
+	host.SetAnnotations(annotations)
+}
+
+// DeleteOwned deletes the host objects of the given list types created for
+// the tenant object with the key in the logical cluster. It returns true once
+// none are left.
+func (m *Mapper) DeleteOwned(ctx context.Context, clusterName logicalcluster.Name, key types.NamespacedName, lists ...client.ObjectList) (bool, error) {
+	opts := []client.ListOption{client.MatchingLabels{
+		ClusterLabel: clusterName.String(),
+		OwnerLabel:   ownerHash(clusterName, key),
+	}}
+	if key.Namespace != "" {
+		opts = append(opts, client.InNamespace(m.HostNamespace(clusterName, key.Namespace)))
+	}
+
+	done := true
+	for _, list := range lists {
+		if err := m.client.List(ctx, list, opts...); err != nil {
+			return false, fmt.Errorf("failed to list host objects: %w", err)
+		}
+		items, err := apimeta.ExtractList(list)
+		if err != nil {
+			return false, err
+		}
+		for _, item := range items {
+			done = false
+			obj, ok := item.(client.Object)
+			if !ok || obj.GetDeletionTimestamp() != nil {
+				continue
+			}
+			if err := m.client.Delete(ctx, obj); err != nil && !apierrors.IsNotFound(err) {
+				return false, fmt.Errorf("failed to delete host object %s: %w", client.ObjectKeyFromObject(obj), err)
+			}
+		}
+	}
+	return done, nil
+}
+
+// Start records the lifetime of the mapper and blocks until the context is
+// done.
+func (m *Mapper) Start(ctx context.Context) error {
+	m.ctx.Store(&ctx)
+	<-ctx.Done()
+	return nil
+}
+
+// Engage deletes the host namespaces of the logical cluster if it stays
+// disengaged for Options.CleanupGracePeriod and Options.ClusterGone confirms
+// it is gone. Nothing is deleted when the mapper stops in the meantime, e.g.
+// because the manager shuts down, or has not been started.
+func (m *Mapper) Engage(clusterCtx context.Context, name string, cl cluster.Cluster) error {
+	m.lock.Lock()
+	e, ok := m.engagements[name]
+	if !ok {
+		e = &engagements{}
+		m.engagements[name] = e
+	}
+	e.running++
+	m.lock.Unlock()
+
+	go func() {
+		<-clusterCtx.Done()
+		m.lock.Lock()
+		e.running--
+		e.ended++
+		ended := e.ended
+		m.lock.Unlock()
+
+		ctx := m.ctx.Load()
+		if ctx == nil {
+			m.forget(name, e, ended)
+			log.FromContext(clusterCtx).Error(errors.New("mapper has not been started"), "not cleaning up host namespaces of disengaged cluster", "cluster", name)
+			return
+		}
+		select {
+		case <-(*ctx).Done():
+			m.forget(name, e, ended)
+			return
+		case <-time.After(m.opts.CleanupGracePeriod):
+		}
+		if !m.forget(name, e, ended) {
+			return
+		}
+		if err := m.cleanup(*ctx, logicalcluster.Name(name), cl); err != nil {
+			log.FromContext(*ctx).Error(err, "failed to clean up host namespaces of disengaged cluster", "cluster", name)
+		}
+	}()
+	return nil
+}
+
+// forget removes the engagements of the logical cluster unless it has been
+// engaged again since the given engagement ended. It returns true if it did,
+// i.e. if the cleanup is up to the caller.
+func (m *Mapper) forget(name string, e *engagements, ended int) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.engagements[name] != e || e.running > 0 || e.ended != ended {
+		return false
+	}
+	delete(m.engagements, name)
+	return true
+}
+
+// cleanup deletes the host namespaces of the disengaged logical cluster if it
+// is gone.
+func (m *Mapper) cleanup(ctx context.Context, clusterName logicalcluster.Name, cl cluster.Cluster) error {
+	var (
+		gone bool
+		err  error
+	)
+	if m.opts.ClusterGone != nil {
+		gone, err = m.opts.ClusterGone(ctx, clusterName)
+	} else {
+		gone, err = bindingsGone(ctx, cl)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check whether the cluster is gone: %w", err)
+	}
+	if !gone {
+		return nil
+	}
+	return m.DeleteHostNamespaces(ctx, clusterName)
+}
+
+// bindingsGone returns true if the cache of the cluster holds no APIBinding.
+func bindingsGone(ctx context.Context, cl cluster.Cluster) (bool, error) {
+	if cl == nil {
+		return false, errors.New("no cluster to check for APIBindings")
+	}
+	bindings := &apisv1alpha1.APIBindingList{}
+	if err := cl.GetCache().List(ctx, bindings); err != nil {
+		return false, fmt.Errorf("failed to list APIBindings: %w", err)
+	}
+	return len(bindings.Items) == 0, nil
+}
+
+func (m *Mapper) namespaceLabels(clusterName logicalcluster.Name, namespace string) map[string]string {
+	return map[string]string{
+		ClusterLabel:   clusterName.String(),
+		NamespaceLabel: namespace,
+		ManagedByLabel: m.opts.ManagedBy,
+	}
+}
+
+func ownerHash(clusterName logicalcluster.Name, key types.NamespacedName) string {
+	return hash(2*hashLength, clusterName.String(), key.Namespace, key.Name)
+}
+
+// hash returns a hex hash of the given parts of the given length, safe as a
+// label value.
+func hash(length int, parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "/")))
+	return hex.EncodeToString(sum[:])[:length]
+}
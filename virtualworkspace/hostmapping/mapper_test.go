@@ -0,0 +1,262 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostmapping
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kcp-dev/logicalcluster/v3"
+	"github.com/stretchr/testify/require"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/sdk/apis/apis/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+)
+
+func TestHostNamespace(t *testing.T) {
+	m := New(fake.NewClientBuilder().Build(), Options{})
+
+	tests := map[string]struct {
+		clusterName logicalcluster.Name
+		namespace   string
+		prefix      string
+	}{
+		"short":        {clusterName: "1bqa7kjslh2p7x5r", namespace: "default", prefix: "kcp-1bqa7kjslh2p7x5r-default-"},
+		"long cluster": {clusterName: logicalcluster.Name(strings.Repeat("a", 60)), namespace: "default", prefix: "kcp-aaaa"},
+		"long both":    {clusterName: "1bqa7kjslh2p7x5r", namespace: strings.Repeat("b", 63), prefix: "kcp-1bqa7kjslh2p7x5r-bbbb"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ns := m.HostNamespace(tt.clusterName, tt.namespace)
+			require.Empty(t, validation.IsDNS1123Label(ns), "host namespace %q must be a valid namespace name", ns)
+			require.True(t, strings.HasPrefix(ns, tt.prefix), "host namespace %q must start with %q", ns, tt.prefix)
+			require.Equal(t, ns, m.HostNamespace(tt.clusterName, tt.namespace), "host namespace must be deterministic")
+		})
+	}
+
+	require.NotEqual(t, m.HostNamespace("a-b", "c"), m.HostNamespace("a", "b-c"), "ambiguous pairs must map to different namespaces")
+}
+
+func TestEnsureHostNamespace(t *testing.T) {
+	ctx := context.Background()
+	cli := fake.NewClientBuilder().Build()
+	m := New(cli, Options{})
+
+	name, err := m.EnsureHostNamespace(ctx, "foo", "default")
+	require.NoError(t, err)
+	ns := &corev1.Namespace{}
+	require.NoError(t, cli.Get(ctx, client.ObjectKey{Name: name}, ns))
+	require.Equal(t, map[string]string{
+		ClusterLabel:   "foo",
+		NamespaceLabel: "default",
+		ManagedByLabel: defaultManagedBy,
+	}, ns.Labels)
+
+	again, err := m.EnsureHostNamespace(ctx, "foo", "default")
+	require.NoError(t, err)
+	require.Equal(t, name, again, "existing host namespace must be reused")
+
+	other := New(cli, Options{ManagedBy: "other"})
+	_, err = other.EnsureHostNamespace(ctx, "foo", "default")
+	require.Error(t, err, "host namespace of another mapper must not be adopted")
+}
+
+func TestDeleteOwned(t *testing.T) {
+	ctx := context.Background()
+	cli := fake.NewClientBuilder().Build()
+	m := New(cli, Options{})
+
+	tenant := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   "default",
+		Name:        "app",
+		Annotations: map[string]string{logicalcluster.AnnotationKey: "foo"},
+	}}
+	ns, err := m.EnsureHostNamespace(ctx, "foo", "default")
+	require.NoError(t, err)
+
+	owned := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: "owned"}}
+	m.SetOwner(owned, tenant)
+	require.Equal(t, "default", owned.Annotations[OwnerNamespaceAnnotation])
+	require.Equal(t, "app", owned.Annotations[OwnerNameAnnotation])
+	require.NoError(t, cli.Create(ctx, owned))
+	require.NoError(t, cli.Create(ctx, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: "unowned"}}))
+
+	done, err := m.DeleteOwned(ctx, "foo", types.NamespacedName{Namespace: "default", Name: "app"}, &corev1.SecretList{})
+	require.NoError(t, err)
+	require.False(t, done, "deletion must not be done while owned objects existed")
+	done, err = m.DeleteOwned(ctx, "foo", types.NamespacedName{Namespace: "default", Name: "app"}, &corev1.SecretList{})
+	require.NoError(t, err)
+	require.True(t, done, "deletion must be done once owned objects are gone")
+
+	require.True(t, apierrors.IsNotFound(cli.Get(ctx, client.ObjectKeyFromObject(owned), &corev1.Secret{})))
+	require.NoError(t, cli.Get(ctx, client.ObjectKey{Namespace: ns, Name: "unowned"}, &corev1.Secret{}), "unowned objects must be kept")
+}
+
+func TestCleanupOfGoneClusters(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// foo and baz are gone, bar only moved to another replica.
+	var lock sync.Mutex
+	gone := map[logicalcluster.Name]bool{"foo": true, "baz": true}
+	cli := fake.NewClientBuilder().Build()
+	m := New(cli, Options{
+		ClusterGone: func(_ context.Context, clusterName logicalcluster.Name) (bool, error) {
+			lock.Lock()
+			defer lock.Unlock()
+			return gone[clusterName], nil
+		},
+		CleanupGracePeriod: 100 * time.Millisecond,
+	})
+	go func() {
+		_ = m.Start(ctx)
+	}()
+	require.Eventually(t, func() bool {
+		return m.ctx.Load() != nil
+	}, wait.ForeverTestTimeout, 10*time.Millisecond)
+
+	namespaces := map[logicalcluster.Name]string{}
+	disengage := map[logicalcluster.Name]context.CancelFunc{}
+	for _, clusterName := range []logicalcluster.Name{"foo", "bar", "baz", "qux"} {
+		ns, err := m.EnsureHostNamespace(ctx, clusterName, "default")
+		require.NoError(t, err)
+		namespaces[clusterName] = ns
+		clusterCtx, cancel := context.WithCancel(ctx)
+		disengage[clusterName] = cancel
+		require.NoError(t, m.Engage(clusterCtx, clusterName.String(), nil))
+	}
+	exists := func(clusterName logicalcluster.Name) bool {
+		return !apierrors.IsNotFound(cli.Get(context.Background(), client.ObjectKey{Name: namespaces[clusterName]}, &corev1.Namespace{}))
+	}
+
+	// baz is engaged again within the grace period.
+	disengage["foo"]()
+	disengage["bar"]()
+	disengage["baz"]()
+	require.NoError(t, m.Engage(ctx, "baz", nil))
+	require.True(t, exists("foo"), "host namespaces must be kept during the grace period")
+
+	require.Eventually(t, func() bool {
+		return !exists("foo")
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "host namespaces of gone clusters must be deleted")
+	require.Never(t, func() bool {
+		return !exists("bar") || !exists("baz") || !exists("qux")
+	}, 300*time.Millisecond, 10*time.Millisecond, "host namespaces of engaged clusters or clusters that are not gone must be kept")
+
+	lock.Lock()
+	gone["qux"] = true
+	lock.Unlock()
+	cancel()
+	disengage["qux"]()
+	require.Never(t, func() bool {
+		return !exists("qux")
+	}, 300*time.Millisecond, 10*time.Millisecond, "host namespaces must be kept on shutdown")
+}
+
+func TestCleanupOfClustersWithoutAPIBinding(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sch := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(sch))
+	require.NoError(t, apisv1alpha1.AddToScheme(sch))
+	cli := fake.NewClientBuilder().WithScheme(sch).Build()
+	m := New(cli, Options{CleanupGracePeriod: 10 * time.Millisecond})
+	go func() {
+		_ = m.Start(ctx)
+	}()
+	require.Eventually(t, func() bool {
+		return m.ctx.Load() != nil
+	}, wait.ForeverTestTimeout, 10*time.Millisecond)
+
+	// foo is still bound, e.g. it only moved to another replica, bar is not.
+	bound := fake.NewClientBuilder().WithScheme(sch).WithObjects(&apisv1alpha1.APIBinding{ObjectMeta: metav1.ObjectMeta{Name: "binding"}}).Build()
+	unbound := fake.NewClientBuilder().WithScheme(sch).Build()
+	clusters := map[logicalcluster.Name]cluster.Cluster{
+		"foo": &readerCluster{cache: readerCache{reader: bound}},
+		"bar": &readerCluster{cache: readerCache{reader: unbound}},
+	}
+
+	namespaces := map[logicalcluster.Name]string{}
+	for clusterName, cl := range clusters {
+		ns, err := m.EnsureHostNamespace(ctx, clusterName, "default")
+		require.NoError(t, err)
+		namespaces[clusterName] = ns
+		clusterCtx, disengage := context.WithCancel(ctx)
+		require.NoError(t, m.Engage(clusterCtx, clusterName.String(), cl))
+		disengage()
+	}
+	exists := func(clusterName logicalcluster.Name) bool {
+		return !apierrors.IsNotFound(cli.Get(ctx, client.ObjectKey{Name: namespaces[clusterName]}, &corev1.Namespace{}))
+	}
+
+	require.Eventually(t, func() bool {
+		return !exists("bar")
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "host namespaces of clusters without APIBinding must be deleted")
+	require.True(t, exists("foo"), "host namespaces of clusters with APIBinding must be kept")
+	require.Eventually(t, func() bool {
+		m.lock.Lock()
+		defer m.lock.Unlock()
+		return len(m.engagements) == 0
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "engagements must be forgotten once the cleanup is decided")
+}
+
+func TestCleanupWithoutStart(t *testing.T) {
+	m := New(fake.NewClientBuilder().Build(), Options{CleanupGracePeriod: 10 * time.Millisecond})
+
+	clusterCtx, disengage := context.WithCancel(context.Background())
+	require.NoError(t, m.Engage(clusterCtx, "foo", nil))
+	disengage()
+	require.Eventually(t, func() bool {
+		m.lock.Lock()
+		defer m.lock.Unlock()
+		return len(m.engagements) == 0
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "engagements must be forgotten when the mapper was not started")
+}
+
+// readerCluster is a cluster whose cache reads through a client.
+type readerCluster struct {
+	cluster.Cluster
+	cache readerCache
+}
+
+func (c *readerCluster) GetCache() cache.Cache {
+	return c.cache
+}
+
+type readerCache struct {
+	cache.Cache
+	reader client.Reader
+}
+
+func (c readerCache) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	return c.reader.List(ctx, list, opts...)
+}
@@ -22,6 +22,8 @@ import (
 	"github.com/kcp-dev/logicalcluster/v3"
 
 	"k8s.io/apimachinery/pkg/api/meta"
+	k8scache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 // ClusterIndexFunc indexes by cluster name.
@@ -51,3 +53,34 @@ func ClusterAndNamespaceIndexFunc(obj any) ([]string, error) {
 func ClusterAndNamespaceIndexKey(clusterName logicalcluster.Name, namespace string) string {
 	return clusterName.String() + "/" + namespace
 }
+
+// FieldIndexName returns the name of the index IndexField adds over the given
+// field.
+func FieldIndexName(field string) string {
+	return fieldIndexName(field)
+}
+
+// ClusterFieldIndexFunc turns a field indexer into an index function over the
+// objects of all logical clusters. The values are prefixed with the logical
+// cluster and namespace of the object, in the format the scoped cache readers
+// look them up. They are also indexed with the namespace only, like the
+// controller-runtime cache does, so that field selectors keep working on the
+// wildcard cache itself, across all logical clusters.
+func ClusterFieldIndexFunc(extractValue client.IndexerFunc) k8scache.IndexFunc {
+	return func(obj any) ([]string, error) {
+		cobj, ok := obj.(client.Object)
+		if !ok {
+			return nil, fmt.Errorf("object of type %T is not a client.Object", obj)
+		}
+		clusterName := logicalcluster.From(cobj).String()
+		values := extractValue(cobj)
+		keys := make([]string, 0, len(values)*4)
+		for _, value := range values {
+			keys = append(keys, keyToClusteredKey(clusterName, "", value), keyToNamespacedKey("", value))
+			if ns := cobj.GetNamespace(); ns != "" {
+				keys = append(keys, keyToClusteredKey(clusterName, ns, value), keyToNamespacedKey(ns, value))
+			}
+		}
+		return keys, nil
+	}
+}
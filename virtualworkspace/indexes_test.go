@@ -22,7 +22,9 @@ import (
 	"github.com/kcp-dev/logicalcluster/v3"
 	"github.com/stretchr/testify/require"
 
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 func TestClusterIndexFunc(t *testing.T) {
@@ -104,3 +106,43 @@ func TestClusterAndNamespaceIndexFunc(t *testing.T) {
 		})
 	}
 }
+
+func TestClusterFieldIndexFunc(t *testing.T) {
+	tests := map[string]struct {
+		obj     *corev1.ConfigMap
+		desired []string
+	}{
+		"namespaced": {
+			obj: &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "default",
+				Name:        "name",
+				Annotations: map[string]string{logicalcluster.AnnotationKey: "test"},
+			}},
+			desired: []string{
+				"test|__all_namespaces/name",
+				"__all_namespaces/name",
+				"test|default/name",
+				"default/name",
+			},
+		},
+		"cluster-scoped": {
+			obj: &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+				Name:        "name",
+				Annotations: map[string]string{logicalcluster.AnnotationKey: "test"},
+			}},
+			desired: []string{
+				"test|__all_namespaces/name",
+				"__all_namespaces/name",
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			result, err := ClusterFieldIndexFunc(func(obj client.Object) []string {
+				return []string{obj.GetName()}
+			})(tt.obj)
+			require.NoError(t, err)
+			require.Equal(t, tt.desired, result)
+		})
+	}
+}
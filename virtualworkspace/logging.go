@@ -0,0 +1,63 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualworkspace
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/kcp-dev/logicalcluster/v3"
+)
+
+// requestLogVerbosity is the verbosity at which scoped clients log requests,
+// matching the verbosity of the request logs of client-go.
+const requestLogVerbosity = 6
+
+// clusterLogger returns the logger for everything happening on behalf of a
+// logical cluster, with the cluster name and, if known, the workspace path as
+// values.
+func clusterLogger(base logr.Logger, clusterName logicalcluster.Name, path logicalcluster.Path) logr.Logger {
+	logger := base.WithValues("cluster", clusterName.String())
+	if !path.Empty() {
+		logger = logger.WithValues("workspace", path.String())
+	}
+	return logger
+}
+
+// loggingRoundTripper logs every request with the logger of the logical
+// cluster it is sent for.
+type loggingRoundTripper struct {
+	delegate http.RoundTripper
+	log      logr.Logger
+}
+
+func (t *loggingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	logger := t.log.V(requestLogVerbosity)
+	if !logger.Enabled() {
+		return t.delegate.RoundTrip(req)
+	}
+
+	start := time.Now()
+	resp, err := t.delegate.RoundTrip(req)
+	if err != nil {
+		logger.Info("Request failed", "verb", req.Method, "url", req.URL.String(), "latency", time.Since(start), "error", err.Error())
+		return nil, err
+	}
+	logger.Info("Request", "verb", req.Method, "url", req.URL.String(), "status", resp.StatusCode, "latency", time.Since(start))
+	return resp, nil
+}
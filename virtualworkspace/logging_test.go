@@ -0,0 +1,106 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualworkspace
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/funcr"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kcp-dev/multicluster-provider/virtualworkspace/fakeserver"
+
+	kcpcore "github.com/kcp-dev/kcp/sdk/apis/core"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// logRecorder collects the lines logged by a funcr logger.
+type logRecorder struct {
+	lock  sync.Mutex
+	lines []string
+}
+
+func (r *logRecorder) record(prefix, args string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.lines = append(r.lines, args)
+}
+
+// find returns whether a line containing all substrings was logged.
+func (r *logRecorder) find(substrings ...string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return slices.ContainsFunc(r.lines, func(line string) bool {
+		for _, s := range substrings {
+			if !strings.Contains(line, s) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func TestProviderClusterLogger(t *testing.T) {
+	rec := &logRecorder{}
+	ctx, cancel := context.WithCancel(log.IntoContext(context.Background(), funcr.New(rec.record, funcr.Options{Verbosity: requestLogVerbosity})))
+	defer cancel()
+
+	srv := fakeserver.New(nil)
+	defer srv.Close()
+	cli, err := client.New(srv.ClusterConfig("foo"), client.Options{})
+	require.NoError(t, err)
+	require.NoError(t, cli.Create(ctx, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   "default",
+		Name:        "a",
+		Annotations: map[string]string{kcpcore.LogicalClusterPathAnnotationKey: "root:org:foo"},
+	}}))
+
+	p, err := New(srv.Config(), &corev1.ConfigMap{}, Options{})
+	require.NoError(t, err)
+	defer p.Stop()
+
+	mgr := newEngagementRecorder()
+	go func() {
+		_ = p.Run(ctx, mgr)
+	}()
+	require.Eventually(t, func() bool {
+		return slices.Equal(mgr.active(), []string{"foo"})
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "existing cluster must be engaged")
+
+	mgr.lock.Lock()
+	engagedCtx := mgr.engaged["foo"]
+	mgr.lock.Unlock()
+	log.FromContext(engagedCtx).Info("hello from the cluster")
+	require.True(t, rec.find(`"hello from the cluster"`, `"cluster"="foo"`, `"workspace"="root:org:foo"`),
+		"logger of the engaged context must carry the cluster")
+
+	cl, err := p.Get(ctx, "foo")
+	require.NoError(t, err)
+	require.NoError(t, cl.GetClient().Get(ctx, client.ObjectKey{Namespace: "default", Name: "a"}, &corev1.ConfigMap{}))
+	require.True(t, rec.find(`"Request"`, `"verb"="GET"`, `"cluster"="foo"`, `"status"=200`),
+		"requests of the scoped client must be logged with the cluster")
+}
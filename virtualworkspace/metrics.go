@@ -0,0 +1,64 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualworkspace
+
+import (
+	"github.com/kcp-dev/logicalcluster/v3"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const metricsSubsystem = "kcp_virtualworkspace_provider"
+
+var (
+	clientThrottledRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: metricsSubsystem,
+		Name:      "client_throttled_requests_total",
+		Help:      "Number of scoped client requests that had to wait for a rate limiter token, by logical cluster and limiter (cluster or global).",
+	}, []string{"cluster", "limiter"})
+
+	clientRateLimiterDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Subsystem: metricsSubsystem,
+		Name:      "client_rate_limiter_duration_seconds",
+		Help:      "Time scoped client requests spent waiting for the rate limiters, by logical cluster.",
+		Buckets:   []float64{0.005, 0.025, 0.1, 0.25, 0.5, 1.0, 2.0, 4.0, 8.0, 15.0, 30.0, 60.0},
+	}, []string{"cluster"})
+
+	clientCrossClusterWrites = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: metricsSubsystem,
+		Name:      "client_cross_cluster_writes_rejected_total",
+		Help:      "Number of writes of objects of another logical cluster rejected by the scoped clients, by logical cluster of the client and verb.",
+	}, []string{"cluster", "verb"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		clientThrottledRequests,
+		clientRateLimiterDuration,
+		clientCrossClusterWrites,
+	)
+}
+
+// forgetClusterMetrics drops all series of a disengaged cluster so that the
+// label cardinality does not grow with every cluster ever seen.
+func forgetClusterMetrics(clusterName logicalcluster.Name) {
+	labels := prometheus.Labels{"cluster": clusterName.String()}
+	clientThrottledRequests.DeletePartialMatch(labels)
+	clientRateLimiterDuration.DeletePartialMatch(labels)
+	clientCrossClusterWrites.DeletePartialMatch(labels)
+}
@@ -18,44 +18,109 @@ package virtualworkspace
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-logr/logr"
-	kcpcache "github.com/kcp-dev/apimachinery/v2/pkg/cache"
 	"github.com/kcp-dev/logicalcluster/v3"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
 
 	mcmanager "github.com/multicluster-runtime/multicluster-runtime/pkg/manager"
 	"github.com/multicluster-runtime/multicluster-runtime/pkg/multicluster"
 
+	apisv1alpha1 "github.com/kcp-dev/kcp/sdk/apis/apis/v1alpha1"
+
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/cluster"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 )
 
 var _ multicluster.Provider = &Provider{}
 
+const defaultEngagementParallelism = 10
+
 // Provider is a cluster provider that represents each logical cluster in the
 // kcp sense as a cluster in the multicluster-runtime sense.
 type Provider struct {
 	config *rest.Config
 	scheme *runtime.Scheme
 	cache  WildcardCache
-	object client.Object
 
-	log logr.Logger
+	objects     []client.Object
+	policy      EngagementPolicy
+	filter      func(client.Object) bool
+	gracePeriod time.Duration
+
+	rateLimit     *RateLimitOptions
+	globalLimiter *rate.Limiter
+
+	parallelism int
+	sharder     *sharder
+	warmStandby bool
+	guardWrites bool
+	impersonate ImpersonationFunc
+	trackClaims bool
+
+	// host is the non-kcp cluster returned as HostClusterName, if any.
+	host cluster.Cluster
+
+	// bindings is the indexer of the APIBinding informer while tracking
+	// permission claims. It is set by engageClusters before workers start.
+	bindings toolscache.Indexer
+
+	log    logr.Logger
+	tracer trace.Tracer
+	tp     trace.TracerProvider
+	prop   propagation.TextMapPropagator
+
+	// running is set while clusters are engaged by Run or SetupWithManager.
+	running atomic.Bool
+
+	// cacheDone is closed when the wildcard cache started by the provider
+	// stopped, with the error in cacheErr. It is nil as long as the cache has
+	// not been started. stopCache stops a cache started by Run.
+	cacheLock sync.Mutex
+	cacheDone chan struct{}
+	cacheErr  error
+	stopCache context.CancelFunc
 
 	lock      sync.RWMutex
 	clusters  map[logicalcluster.Name]cluster.Cluster
 	cancelFns map[logicalcluster.Name]context.CancelFunc
+	// ineligibleSince records when engaged clusters stopped being eligible for
+	// engagement, while they wait for the disengage grace period.
+	ineligibleSince map[logicalcluster.Name]time.Time
+	// engagedSince records when clusters were engaged, for DebugHandler.
+	engagedSince map[logicalcluster.Name]time.Time
+	// failures records the last failed reconciliation of clusters until one
+	// succeeds, for DebugHandler.
+	failures map[logicalcluster.Name]engagementFailure
+}
+
+// engagementFailure is a failed reconciliation of a logical cluster.
+type engagementFailure struct {
+	at  time.Time
+	err error
 }
 
 // Options are the options for creating a new kcp virtual workspace provider.
@@ -67,99 +132,422 @@ type Options struct {
 	// WildcardCache is the wildcard cache to use for the provider. If this is
 	// nil, a new wildcard cache will be created for the given rest.Config.
 	WildcardCache WildcardCache
+
+	// RateLimit configures a global and a per-cluster request budget for the
+	// scoped clients. If this is nil, every scoped client gets its own rate
+	// limiter based on the QPS and Burst of the given rest.Config.
+	RateLimit *RateLimitOptions
+
+	// EngagementObjects are further object types, next to the one passed to
+	// New, whose objects decide whether a logical cluster is engaged.
+	EngagementObjects []client.Object
+
+	// EngagementPolicy decides whether a logical cluster with objects of
+	// only some of the engagement types is engaged. It defaults to
+	// EngageOnAny.
+	EngagementPolicy EngagementPolicy
+
+	// EngagementFilter restricts which objects of the engagement types make
+	// a logical cluster eligible for engagement. Objects it rejects are
+	// treated as if they did not exist. Use LogicalClusterReady or
+	// APIBindingBound with LogicalCluster or APIBinding as engagement type to
+	// drive engagement from the lifecycle of the logical cluster or its
+	// binding instead of from the presence of arbitrary objects. The filter
+	// is called for the objects of all engagement types; the built-in
+	// filters accept objects of other kinds.
+	EngagementFilter func(obj client.Object) bool
+
+	// DisengageGracePeriod is the time a logical cluster stays engaged after
+	// it stopped being eligible, e.g. because its last engagement object was
+	// deleted. If it becomes eligible again within this time, its controllers
+	// keep running without restart. By default, clusters are disengaged
+	// immediately. Clusters moving to another shard are always disengaged
+	// immediately.
+	DisengageGracePeriod time.Duration
+
+	// EngagementParallelism is the number of workers engaging and disengaging
+	// logical clusters concurrently. It defaults to 10.
+	EngagementParallelism int
+
+	// Sharding splits the logical clusters across all replicas running the
+	// provider with the same shard group. If this is nil, every replica
+	// engages every logical cluster.
+	Sharding *ShardingOptions
+
+	// WarmStandby starts the wildcard cache on all replicas of a manager with
+	// leader election, not only on the leader, so that a newly elected leader
+	// can engage clusters without waiting for the initial list. It only has an
+	// effect with SetupWithManager.
+	WarmStandby bool
+
+	// GuardCrossClusterWrites makes the scoped clients reject writes of
+	// objects annotated with another logical cluster than the one of the
+	// client, returning a CrossClusterWriteError. It is a safety net against
+	// reconcilers leaking data of one tenant into another.
+	GuardCrossClusterWrites bool
+
+	// Impersonate returns the identity the scoped client of a logical cluster
+	// acts as, e.g. a service account dedicated to the tenant, so that
+	// requests are authorized and audited as such. If it returns nil, or if
+	// Impersonate is nil, the identity of the rest.Config is used. If it
+	// fails, the engagement of the cluster is retried.
+	Impersonate ImpersonationFunc
+
+	// TrackPermissionClaims watches the APIBindings of all logical clusters
+	// and exposes the permission claims accepted in a cluster via
+	// AcceptedPermissionClaims. Scoped clients then fail requests to claimed
+	// resources whose claim has not been accepted with a
+	// ClaimNotAcceptedError, without sending them to kcp. APIBinding must be
+	// registered in the scheme.
+	TrackPermissionClaims bool
+
+	// DeferredClaims are resources claimed by the APIExport whose wildcard
+	// informers only run while the APIBinding of any engaged logical cluster
+	// accepts the claim. They must not be engagement objects, as clusters
+	// would never be engaged for their claims to count. It only applies to
+	// the wildcard cache created by the provider. See WildcardCacheOptions.
+	DeferredClaims []schema.GroupResource
+
+	// CacheSnapshot persists the wildcard cache created by the provider on
+	// disk, so that it starts from the snapshot after a restart. See
+	// WildcardCacheOptions.
+	CacheSnapshot *SnapshotOptions
+
+	// HostCluster is a non-kcp cluster, e.g. the one the controller runs in,
+	// that the provider returns under HostClusterName next to the logical
+	// clusters. Its cache runs with the wildcard cache. It is not engaged, so
+	// controllers watch it with sources from Provider.HostSource, and fields
+	// are indexed with its own field indexer.
+	HostCluster cluster.Cluster
+
+	// TracerProvider records spans for the engagement of logical clusters and
+	// for all requests of the scoped clients and of the wildcard cache created
+	// by the provider. A WildcardCache passed in the options is not
+	// instrumented. It defaults to a no-op provider.
+	TracerProvider trace.TracerProvider
+
+	// TextMapPropagator propagates the span context of the traced requests
+	// to the server. It defaults to W3C Trace Context.
+	TextMapPropagator propagation.TextMapPropagator
 }
 
+// ImpersonationFunc returns the identity to impersonate in the logical cluster,
+// or nil to not impersonate.
+type ImpersonationFunc func(ctx context.Context, clusterName logicalcluster.Name) (*rest.ImpersonationConfig, error)
+
 // New creates a new kcp virtual workspace provider. The provided rest.Config
 // must point to a virtual workspace apiserver base path, i.e. up to but without
-// the "/clusters/*" suffix.
+// the "/clusters/*" suffix. Logical clusters are engaged as long as they have
+// objects of the type of obj, or of the further Options.EngagementObjects as
+// required by Options.EngagementPolicy.
 func New(cfg *rest.Config, obj client.Object, options Options) (*Provider, error) {
 	// Do the defaulting controller-runtime would do for those fields we need.
 	if options.Scheme == nil {
 		options.Scheme = scheme.Scheme
 	}
+	if options.EngagementPolicy == "" {
+		options.EngagementPolicy = EngageOnAny
+	}
+	if options.EngagementPolicy != EngageOnAny && options.EngagementPolicy != EngageOnAll {
+		return nil, fmt.Errorf("invalid engagement policy %q", options.EngagementPolicy)
+	}
+	if options.EngagementParallelism <= 0 {
+		options.EngagementParallelism = defaultEngagementParallelism
+	}
+	if options.TracerProvider == nil {
+		options.TracerProvider = noop.NewTracerProvider()
+	}
+	if options.TextMapPropagator == nil {
+		options.TextMapPropagator = propagation.TraceContext{}
+	}
 	if options.WildcardCache == nil {
 		var err error
-		options.WildcardCache, err = NewWildcardCache(cfg, cache.Options{
+		options.WildcardCache, err = NewWildcardCacheWithOptions(withTracing(cfg, options.TracerProvider, options.TextMapPropagator, LogicalClusterAttribute.String("*")), cache.Options{
 			Scheme: options.Scheme,
+		}, WildcardCacheOptions{
+			DeferredClaims: options.DeferredClaims,
+			Snapshot:       options.CacheSnapshot,
 		})
 		if err != nil {
 			return nil, fmt.Errorf("failed to create wildcard cache: %w", err)
 		}
 	}
 
+	logger := log.Log.WithName("kcp-virtualworkspace-cluster-provider")
+
+	var shards *sharder
+	if options.Sharding != nil {
+		var err error
+		shards, err = newSharder(options.Sharding, logger.WithName("sharder"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up sharding: %w", err)
+		}
+	}
+
 	return &Provider{
 		config: cfg,
 		scheme: options.Scheme,
 		cache:  options.WildcardCache,
-		object: obj,
 
-		log: log.Log.WithName("kcp-virtualworkspace-cluster-provider"),
-
-		clusters:  map[logicalcluster.Name]cluster.Cluster{},
-		cancelFns: map[logicalcluster.Name]context.CancelFunc{},
+		objects:     append([]client.Object{obj}, options.EngagementObjects...),
+		policy:      options.EngagementPolicy,
+		filter:      options.EngagementFilter,
+		gracePeriod: options.DisengageGracePeriod,
+
+		rateLimit:     options.RateLimit,
+		globalLimiter: options.RateLimit.newGlobalRateLimiter(),
+
+		parallelism: options.EngagementParallelism,
+		sharder:     shards,
+		warmStandby: options.WarmStandby,
+		guardWrites: options.GuardCrossClusterWrites,
+		impersonate: options.Impersonate,
+		trackClaims: options.TrackPermissionClaims,
+		host:        options.HostCluster,
+
+		log:    logger,
+		tracer: options.TracerProvider.Tracer(tracerName),
+		tp:     options.TracerProvider,
+		prop:   options.TextMapPropagator,
+
+		clusters:        map[logicalcluster.Name]cluster.Cluster{},
+		cancelFns:       map[logicalcluster.Name]context.CancelFunc{},
+		ineligibleSince: map[logicalcluster.Name]time.Time{},
+		engagedSince:    map[logicalcluster.Name]time.Time{},
+		failures:        map[logicalcluster.Name]engagementFailure{},
 	}, nil
 }
 
-// Run starts the provider and blocks.
+// Run starts the wildcard cache unless it is running already, engages logical
+// clusters with the given manager and blocks until the context is done or the
+// cache stops. When Run returns, all clusters have been disengaged and Run can
+// be called again, as long as the wildcard cache has not been stopped in the
+// meantime. A cache started by Run stops with the context of that call, and
+// Run waits for it before returning. Use SetupWithManager instead to tie the
+// provider to the lifecycle and leader election of the manager.
 func (p *Provider) Run(ctx context.Context, mgr mcmanager.Manager) error {
+	cacheDone, started, err := p.ensureCache(ctx)
+	if err != nil {
+		return err
+	}
+	if started {
+		defer func() {
+			if ctx.Err() != nil {
+				<-cacheDone
+			}
+		}()
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() error { return p.engageClusters(gctx, mgr) })
+	g.Go(func() error {
+		select {
+		case <-gctx.Done():
+			return nil
+		case <-cacheDone:
+			p.cacheLock.Lock()
+			defer p.cacheLock.Unlock()
+			if p.cacheErr != nil {
+				return p.cacheErr
+			}
+			return errors.New("wildcard cache stopped")
+		}
+	})
+	return g.Wait()
+}
+
+// ensureCache starts the wildcard cache in the background unless it has been
+// started already, and returns the channel closed when it stops. The cache
+// stops with the given context, or earlier on Stop. started is true if this
+// call started the cache.
+func (p *Provider) ensureCache(ctx context.Context) (done <-chan struct{}, started bool, err error) {
+	p.cacheLock.Lock()
+	defer p.cacheLock.Unlock()
+
+	switch {
+	case p.cacheDone == nil:
+		done := make(chan struct{})
+		p.cacheDone = done
+		ctx, cancel := context.WithCancel(ctx)
+		p.stopCache = cancel
+		go func() {
+			defer cancel()
+			if err := p.runCache(ctx, done); err != nil {
+				p.log.Error(err, "wildcard cache stopped")
+			}
+		}()
+		return done, true, nil
+	case isClosed(p.cacheDone):
+		return nil, false, errors.New("wildcard cache has been stopped and cannot be restarted")
+	default:
+		return p.cacheDone, false, nil
+	}
+}
+
+// Stop stops the wildcard cache started by Run before the context of that
+// call is done, and waits until it stopped. Run cannot be called anymore
+// afterwards. A cache started by SetupWithManager stops with the manager
+// instead.
+func (p *Provider) Stop() {
+	p.cacheLock.Lock()
+	stop, done := p.stopCache, p.cacheDone
+	p.cacheLock.Unlock()
+
+	if stop == nil {
+		return
+	}
+	stop()
+	<-done
+}
+
+// SetupWithManager adds the provider to the manager. The wildcard cache is
+// started with the manager, on all replicas if WarmStandby is set and only on
+// the elected leader otherwise. Logical clusters are engaged once the manager
+// won the leader election and disengaged when it stops.
+func (p *Provider) SetupWithManager(mgr mcmanager.Manager) error {
+	if err := mgr.GetLocalManager().Add(&cacheRunnable{provider: p}); err != nil {
+		return fmt.Errorf("failed to add wildcard cache to manager: %w", err)
+	}
+	if err := mgr.GetLocalManager().Add(manager.RunnableFunc(func(ctx context.Context) error {
+		return p.engageClusters(ctx, mgr)
+	})); err != nil {
+		return fmt.Errorf("failed to add provider to manager: %w", err)
+	}
+	return nil
+}
+
+// startCache starts the wildcard cache and, if configured, the host cluster,
+// and blocks until the context is done. The cache can only be started once.
+func (p *Provider) startCache(ctx context.Context) error {
+	p.cacheLock.Lock()
+	if p.cacheDone != nil {
+		p.cacheLock.Unlock()
+		return errors.New("wildcard cache has already been started")
+	}
+	done := make(chan struct{})
+	p.cacheDone = done
+	p.cacheLock.Unlock()
+
+	return p.runCache(ctx, done)
+}
+
+// runCache runs the wildcard cache and, if configured, the host cluster until
+// the context is done. It records the error and closes done on return.
+func (p *Provider) runCache(ctx context.Context, done chan struct{}) (err error) {
+	defer func() {
+		p.cacheLock.Lock()
+		p.cacheErr = err
+		p.cacheLock.Unlock()
+		close(done)
+	}()
+
+	if p.host == nil {
+		return p.cache.Start(ctx)
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error { return p.cache.Start(ctx) })
+	g.Go(func() error {
+		if err := p.host.Start(ctx); err != nil {
+			return fmt.Errorf("failed to start host cluster: %w", err)
+		}
+		return nil
+	})
+	return g.Wait()
+}
+
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+var _ manager.LeaderElectionRunnable = &cacheRunnable{}
+
+// cacheRunnable runs the wildcard cache of a provider as part of a manager.
+type cacheRunnable struct {
+	provider *Provider
+}
+
+// Start implements manager.Runnable.
+func (r *cacheRunnable) Start(ctx context.Context) error {
+	return r.provider.startCache(ctx)
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable.
+func (r *cacheRunnable) NeedLeaderElection() bool {
+	return !r.provider.warmStandby
+}
+
+// engageClusters watches the engagement object types and engages logical
+// clusters with the manager until the context is done. The wildcard cache
+// must be started separately.
+//
+// On return, it shuts down in this order: the queue is closed and in-flight
+// engagements are awaited, the event handlers are removed, and then all
+// clusters are disengaged. Afterwards, engageClusters can be called again.
+func (p *Provider) engageClusters(ctx context.Context, mgr mcmanager.Manager) error {
+	if !p.running.CompareAndSwap(false, true) {
+		return errors.New("provider is already running")
+	}
+	defer p.running.Store(false)
+	defer p.disengageAll()
+
 	g, ctx := errgroup.WithContext(ctx)
 
 	// Watch logical clusters and engage them as clusters in multicluster-runtime.
-	inf, err := p.cache.GetInformer(ctx, p.object, cache.BlockUntilSynced(false))
+	sources, err := getEngagementSources(ctx, p.cache, p.objects)
 	if err != nil {
-		return fmt.Errorf("failed to get logical cluster informer: %w", err)
+		return fmt.Errorf("failed to get logical cluster informers: %w", err)
 	}
-	shInf, _, _, _, err := p.cache.getSharedInformer(p.object)
-	if err != nil {
-		return fmt.Errorf("failed to get shared informer: %w", err)
+	if p.trackClaims {
+		bindings, err := getEngagementSources(ctx, p.cache, []client.Object{&apisv1alpha1.APIBinding{}})
+		if err != nil {
+			return fmt.Errorf("failed to get APIBinding informer: %w", err)
+		}
+		p.bindings = bindings[0].indexer
 	}
-	if _, err := inf.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+
+	// The informer handlers only enqueue the logical cluster. Whether it has to
+	// be engaged or disengaged is decided by the workers, so that slow
+	// engagements do not stall event delivery.
+	queue := workqueue.NewTypedRateLimitingQueueWithConfig(
+		workqueue.DefaultTypedControllerRateLimiter[logicalcluster.Name](),
+		workqueue.TypedRateLimitingQueueConfig[logicalcluster.Name]{
+			Name: "kcp-virtualworkspace-cluster-provider",
+		},
+	)
+	defer queue.ShutDown()
+
+	handler := toolscache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj any) {
 			cobj, ok := obj.(client.Object)
 			if !ok {
 				klog.Errorf("unexpected object type %T", obj)
 				return
 			}
-			clusterName := logicalcluster.From(cobj)
-
-			// fast path: cluster exists already, there is nothing to do.
-			p.lock.RLock()
-			if _, ok := p.clusters[clusterName]; ok {
-				p.lock.RUnlock()
+			queue.Add(logicalcluster.From(cobj))
+		},
+		UpdateFunc: func(oldObj, newObj any) {
+			// only the filter can change the eligibility on updates.
+			if p.filter == nil {
 				return
 			}
-			p.lock.RUnlock()
-
-			// slow path: take write lock to add a new cluster (unless it appeared in the meantime).
-			p.lock.Lock()
-			if _, ok := p.clusters[clusterName]; ok {
-				p.lock.Unlock()
+			oldCobj, ok := oldObj.(client.Object)
+			if !ok {
+				klog.Errorf("unexpected object type %T", oldObj)
 				return
 			}
-
-			// create new scoped cluster.
-			clusterCtx, cancel := context.WithCancel(ctx)
-			cl, err := newScopedCluster(p.config, clusterName, p.cache, p.scheme)
-			if err != nil {
-				p.log.Error(err, "failed to create cluster", "cluster", clusterName)
-				cancel()
-				p.lock.Unlock()
+			newCobj, ok := newObj.(client.Object)
+			if !ok {
+				klog.Errorf("unexpected object type %T", newObj)
 				return
 			}
-			p.clusters[clusterName] = cl
-			p.cancelFns[clusterName] = cancel
-			p.lock.Unlock()
-
-			p.log.Info("engaging cluster", "cluster", clusterName)
-			if err := mgr.Engage(clusterCtx, clusterName.String(), cl); err != nil {
-				p.log.Error(err, "failed to engage cluster", "cluster", clusterName)
-				p.lock.Lock()
-				cancel()
-				if p.clusters[clusterName] == cl {
-					delete(p.clusters, clusterName)
-					delete(p.cancelFns, clusterName)
-				}
-				p.lock.Unlock()
+			if p.filter(oldCobj) != p.filter(newCobj) {
+				queue.Add(logicalcluster.From(newCobj))
 			}
 		},
 		DeleteFunc: func(obj any) {
@@ -176,32 +564,20 @@ func (p *Provider) Run(ctx context.Context, mgr mcmanager.Manager) error {
 					return
 				}
 			}
-
-			clusterName := logicalcluster.From(cobj)
-
-			// check if there is no object left in the index.
-			keys, err := shInf.GetIndexer().IndexKeys(kcpcache.ClusterIndexName, clusterName.String())
-			if err != nil {
-				p.log.Error(err, "failed to get index keys", "cluster", clusterName)
-				return
-			}
-			if len(keys) == 0 {
-				p.lock.Lock()
-				cancel, ok := p.cancelFns[clusterName]
-				if ok {
-					p.log.Info("disengaging cluster", "cluster", clusterName)
-					cancel()
-					delete(p.cancelFns, clusterName)
-					delete(p.clusters, clusterName)
-				}
-				p.lock.Unlock()
-			}
+			queue.Add(logicalcluster.From(cobj))
 		},
-	}); err != nil {
-		return fmt.Errorf("failed to add EventHandler: %w", err)
 	}
-
-	g.Go(func() error { return p.cache.Start(ctx) })
+	for _, source := range sources {
+		reg, err := source.informer.AddEventHandler(handler)
+		if err != nil {
+			return fmt.Errorf("failed to add EventHandler for %T: %w", source.object, err)
+		}
+		defer func() {
+			if err := source.informer.RemoveEventHandler(reg); err != nil {
+				p.log.Error(err, "failed to remove EventHandler")
+			}
+		}()
+	}
 
 	syncCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
@@ -209,11 +585,259 @@ func (p *Provider) Run(ctx context.Context, mgr mcmanager.Manager) error {
 		return fmt.Errorf("failed to sync wildcard cache")
 	}
 
+	if p.sharder != nil {
+		g.Go(func() error {
+			return p.sharder.run(ctx, func() {
+				// rebalance: every cluster might have moved to or away from us.
+				for _, clusterName := range p.knownClusters(sources) {
+					queue.Add(clusterName)
+				}
+			})
+		})
+	}
+
+	for range p.parallelism {
+		g.Go(func() error {
+			for p.processNextCluster(ctx, queue, mgr, sources) {
+			}
+			return nil
+		})
+	}
+	g.Go(func() error {
+		<-ctx.Done()
+		queue.ShutDown()
+		return nil
+	})
+
+	// wait for the workers, i.e. for in-flight engagements, before the
+	// deferred shutdown steps run.
 	return g.Wait()
 }
 
-// Get returns a cluster by name.
+func (p *Provider) processNextCluster(ctx context.Context, queue workqueue.TypedRateLimitingInterface[logicalcluster.Name], mgr mcmanager.Manager, sources engagementSources) bool {
+	clusterName, shutdown := queue.Get()
+	if shutdown {
+		return false
+	}
+	defer queue.Done(clusterName)
+
+	requeueAfter, err := p.reconcileCluster(ctx, mgr, sources, clusterName)
+	if err != nil {
+		p.log.Error(err, "failed to reconcile cluster, requeuing", "cluster", clusterName)
+		p.lock.Lock()
+		p.failures[clusterName] = engagementFailure{at: time.Now(), err: err}
+		p.lock.Unlock()
+		queue.AddRateLimited(clusterName)
+		return true
+	}
+	p.lock.Lock()
+	delete(p.failures, clusterName)
+	p.lock.Unlock()
+	queue.Forget(clusterName)
+	if requeueAfter > 0 {
+		queue.AddAfter(clusterName, requeueAfter)
+	}
+
+	return true
+}
+
+// reconcileCluster engages the logical cluster if there are objects of the
+// engagement types in it, as required by the engagement policy and filter,
+// and, if sharding is enabled, this replica owns it. It disengages the cluster
+// otherwise, after the grace period if one is configured. In that case, it
+// returns the time after which the cluster has to be reconciled again. The
+// queue guarantees that a cluster is never reconciled by two workers at the
+// same time.
+func (p *Provider) reconcileCluster(ctx context.Context, mgr mcmanager.Manager, sources engagementSources, clusterName logicalcluster.Name) (requeueAfter time.Duration, err error) {
+	path := sources.workspacePath(clusterName)
+
+	// The span is not passed on to the engaged cluster, whose context lives
+	// longer than the span.
+	_, span := p.tracer.Start(ctx, "ReconcileCluster", trace.WithAttributes(clusterAttributes(clusterName, path)...))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	if p.sharder != nil && !p.sharder.owns(clusterName) {
+		span.SetAttributes(engagementActionAttribute.String("disengage"))
+		p.disengage(clusterName)
+		return 0, nil
+	}
+
+	engage, err := sources.wantsEngagement(p.policy, p.filter, clusterName)
+	if err != nil {
+		return 0, err
+	}
+	if engage {
+		span.SetAttributes(engagementActionAttribute.String("engage"))
+		p.lock.Lock()
+		delete(p.ineligibleSince, clusterName)
+		p.lock.Unlock()
+		return 0, p.engage(ctx, mgr, clusterName, path)
+	}
+
+	if remaining := p.remainingGracePeriod(clusterName); remaining > 0 {
+		span.SetAttributes(engagementActionAttribute.String("wait"))
+		return remaining, nil
+	}
+	span.SetAttributes(engagementActionAttribute.String("disengage"))
+	p.disengage(clusterName)
+	return 0, nil
+}
+
+// remainingGracePeriod returns how much longer the engaged cluster stays
+// engaged although it is not eligible anymore, starting the grace period if
+// it is not running yet.
+func (p *Provider) remainingGracePeriod(clusterName logicalcluster.Name) time.Duration {
+	if p.gracePeriod <= 0 {
+		return 0
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if _, ok := p.clusters[clusterName]; !ok {
+		return 0
+	}
+	since, ok := p.ineligibleSince[clusterName]
+	if !ok {
+		since = time.Now()
+		p.ineligibleSince[clusterName] = since
+		p.log.Info("cluster not eligible for engagement anymore, disengaging after grace period", "cluster", clusterName, "gracePeriod", p.gracePeriod)
+	}
+	return p.gracePeriod - time.Since(since)
+}
+
+// knownClusters returns the logical clusters with objects of any engagement
+// type and those currently engaged.
+func (p *Provider) knownClusters(sources engagementSources) []logicalcluster.Name {
+	seen := sources.clusters()
+
+	p.lock.RLock()
+	for clusterName := range p.clusters {
+		seen.Insert(clusterName)
+	}
+	p.lock.RUnlock()
+
+	return sets.List(seen)
+}
+
+func (p *Provider) engage(ctx context.Context, mgr mcmanager.Manager, clusterName logicalcluster.Name, path logicalcluster.Path) error {
+	// fast path: cluster exists already, there is nothing to do.
+	p.lock.RLock()
+	_, ok := p.clusters[clusterName]
+	p.lock.RUnlock()
+	if ok {
+		return nil
+	}
+
+	logger := clusterLogger(log.FromContext(ctx), clusterName, path)
+
+	var impersonate *rest.ImpersonationConfig
+	if p.impersonate != nil {
+		var err error
+		impersonate, err = p.impersonate(ctx, clusterName)
+		if err != nil {
+			return fmt.Errorf("failed to get impersonation config: %w", err)
+		}
+	}
+
+	var claims *permissionClaims
+	if p.trackClaims {
+		claims = &permissionClaims{bindings: p.bindings, clusterName: clusterName}
+	}
+
+	// create new scoped cluster. This does discovery, so it happens without
+	// holding the lock.
+	cl, err := newScopedCluster(p.config, clusterName, p.cache, p.scheme, scopedClusterOptions{
+		rateLimiter:    p.rateLimit.newClusterRateLimiter(clusterName, p.globalLimiter),
+		guardWrites:    p.guardWrites,
+		tracerProvider: p.tp,
+		propagator:     p.prop,
+		workspacePath:  path,
+		logger:         &logger,
+		impersonate:    impersonate,
+		claims:         claims,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create cluster: %w", err)
+	}
+
+	// everything running for the engaged cluster logs with its logger.
+	clusterCtx, cancel := context.WithCancel(log.IntoContext(ctx, logger))
+	p.lock.Lock()
+	p.clusters[clusterName] = cl
+	p.cancelFns[clusterName] = cancel
+	p.engagedSince[clusterName] = time.Now()
+	p.lock.Unlock()
+
+	if tracker, ok := p.cache.(engagementTracker); ok {
+		tracker.trackEngagement(clusterCtx, clusterName)
+	}
+
+	p.log.Info("engaging cluster", "cluster", clusterName)
+	if err := mgr.Engage(clusterCtx, clusterName.String(), cl); err != nil {
+		p.lock.Lock()
+		cancel()
+		if p.clusters[clusterName] == cl {
+			delete(p.clusters, clusterName)
+			delete(p.cancelFns, clusterName)
+			delete(p.engagedSince, clusterName)
+			forgetClusterMetrics(clusterName)
+		}
+		p.lock.Unlock()
+		return fmt.Errorf("failed to engage cluster: %w", err)
+	}
+
+	return nil
+}
+
+// disengageAll disengages all logical clusters in the order of their names,
+// leaving the provider without any clusters.
+func (p *Provider) disengageAll() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, clusterName := range slices.Sorted(maps.Keys(p.cancelFns)) {
+		p.log.Info("disengaging cluster", "cluster", clusterName)
+		p.cancelFns[clusterName]()
+		forgetClusterMetrics(clusterName)
+	}
+	clear(p.cancelFns)
+	clear(p.clusters)
+	clear(p.ineligibleSince)
+	clear(p.engagedSince)
+	clear(p.failures)
+}
+
+func (p *Provider) disengage(clusterName logicalcluster.Name) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	cancel, ok := p.cancelFns[clusterName]
+	if !ok {
+		return
+	}
+
+	p.log.Info("disengaging cluster", "cluster", clusterName)
+	cancel()
+	delete(p.cancelFns, clusterName)
+	delete(p.clusters, clusterName)
+	delete(p.ineligibleSince, clusterName)
+	delete(p.engagedSince, clusterName)
+	forgetClusterMetrics(clusterName)
+}
+
+// Get returns a cluster by name, or the host cluster for HostClusterName.
 func (p *Provider) Get(_ context.Context, name string) (cluster.Cluster, error) {
+	if name == HostClusterName && p.host != nil {
+		return p.host, nil
+	}
+
 	p.lock.RLock()
 	defer p.lock.RUnlock()
 	if cl, ok := p.clusters[logicalcluster.Name(name)]; ok {
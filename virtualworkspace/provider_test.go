@@ -0,0 +1,848 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualworkspace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	kcpcache "github.com/kcp-dev/apimachinery/v2/pkg/cache"
+	"github.com/kcp-dev/logicalcluster/v3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kcp-dev/multicluster-provider/virtualworkspace/fakeserver"
+
+	mcmanager "github.com/multicluster-runtime/multicluster-runtime/pkg/manager"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/sdk/apis/apis/v1alpha1"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+)
+
+// engagementRecorder is a manager that only records engagements.
+type engagementRecorder struct {
+	mcmanager.Manager
+
+	lock    sync.Mutex
+	engaged map[string]context.Context
+}
+
+func newEngagementRecorder() *engagementRecorder {
+	return &engagementRecorder{engaged: map[string]context.Context{}}
+}
+
+func (r *engagementRecorder) Engage(ctx context.Context, name string, _ cluster.Cluster) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.engaged[name] = ctx
+	return nil
+}
+
+// active returns the names of all engaged clusters whose context is not done.
+func (r *engagementRecorder) active() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var names []string
+	for name, ctx := range r.engaged {
+		if ctx.Err() == nil {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+func createConfigMap(t *testing.T, srv *fakeserver.Server, clusterName logicalcluster.Name, name string) {
+	t.Helper()
+
+	cli, err := client.New(srv.ClusterConfig(clusterName), client.Options{})
+	require.NoError(t, err)
+	require.NoError(t, cli.Create(context.Background(), &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Data:       map[string]string{"cluster": clusterName.String()},
+	}))
+}
+
+func TestWildcardCache(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := fakeserver.New(nil)
+	defer srv.Close()
+	createConfigMap(t, srv, "foo", "a")
+	createConfigMap(t, srv, "bar", "a")
+
+	wc, err := NewWildcardCache(srv.Config(), cache.Options{})
+	require.NoError(t, err)
+	go func() {
+		_ = wc.Start(ctx)
+	}()
+
+	_, err = wc.GetInformer(ctx, &corev1.ConfigMap{})
+	require.NoError(t, err)
+	require.True(t, wc.WaitForCacheSync(ctx))
+	inf, _, scope, found, err := wc.getSharedInformer(&corev1.ConfigMapList{})
+	require.NoError(t, err)
+	require.True(t, found, "informer must be found by list type")
+	require.Equal(t, "namespace", string(scope))
+
+	require.Len(t, inf.GetIndexer().List(), 2)
+	objs, err := inf.GetIndexer().ByIndex(kcpcache.ClusterIndexName, "foo")
+	require.NoError(t, err)
+	require.Len(t, objs, 1)
+	require.Equal(t, "foo", objs[0].(*corev1.ConfigMap).Data["cluster"])
+
+	createConfigMap(t, srv, "baz", "a")
+	require.Eventually(t, func() bool {
+		objs, err := inf.GetIndexer().ByIndex(kcpcache.ClusterAndNamespaceIndexName, kcpcache.ClusterAndNamespaceIndexKey("baz", "default"))
+		return err == nil && len(objs) == 1
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "watch events of new clusters must reach the informer")
+}
+
+func TestProviderEngagement(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := fakeserver.New(nil)
+	defer srv.Close()
+	createConfigMap(t, srv, "foo", "a")
+
+	p, err := New(srv.Config(), &corev1.ConfigMap{}, Options{})
+	require.NoError(t, err)
+	defer p.Stop()
+
+	mgr := newEngagementRecorder()
+	done := make(chan error)
+	go func() {
+		done <- p.Run(ctx, mgr)
+	}()
+
+	require.Eventually(t, func() bool {
+		return slices.Equal(mgr.active(), []string{"foo"})
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "existing cluster must be engaged")
+
+	createConfigMap(t, srv, "bar", "a")
+	require.Eventually(t, func() bool {
+		return slices.Equal(mgr.active(), []string{"bar", "foo"})
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "new cluster must be engaged")
+
+	cl, err := p.Get(ctx, "bar")
+	require.NoError(t, err)
+	require.NotNil(t, cl)
+
+	srv.DeleteCluster("foo")
+	require.Eventually(t, func() bool {
+		return slices.Equal(mgr.active(), []string{"bar"})
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "deleted cluster must be disengaged")
+	_, err = p.Get(ctx, "foo")
+	require.Error(t, err)
+
+	cancel()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatal("provider did not stop")
+	}
+	require.Empty(t, mgr.active(), "all clusters must be disengaged on shutdown")
+}
+
+func TestProviderRunStopsCache(t *testing.T) {
+	srv := fakeserver.New(nil)
+	defer srv.Close()
+	createConfigMap(t, srv, "foo", "a")
+
+	p, err := New(srv.Config(), &corev1.ConfigMap{}, Options{})
+	require.NoError(t, err)
+
+	mgr := newEngagementRecorder()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- p.Run(ctx, mgr)
+	}()
+
+	require.Eventually(t, func() bool {
+		return slices.Equal(mgr.active(), []string{"foo"})
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "existing cluster must be engaged")
+
+	// a second Run while the first one is active must not start anything.
+	require.Error(t, p.Run(context.Background(), mgr), "Run must fail while the provider is running")
+
+	cancel()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatal("provider did not stop")
+	}
+	require.Empty(t, mgr.active(), "all clusters must be disengaged when Run returns")
+
+	p.cacheLock.Lock()
+	cacheDone := p.cacheDone
+	p.cacheLock.Unlock()
+	require.True(t, isClosed(cacheDone), "the cache must stop with the context of Run")
+	require.Error(t, p.Run(context.Background(), mgr), "Run must fail once the cache stopped")
+
+	// Stop is a no-op once the cache stopped.
+	p.Stop()
+}
+
+func TestProviderStop(t *testing.T) {
+	srv := fakeserver.New(nil)
+	defer srv.Close()
+	createConfigMap(t, srv, "foo", "a")
+
+	p, err := New(srv.Config(), &corev1.ConfigMap{}, Options{})
+	require.NoError(t, err)
+
+	mgr := newEngagementRecorder()
+	done := make(chan error, 1)
+	go func() {
+		done <- p.Run(context.Background(), mgr)
+	}()
+	require.Eventually(t, func() bool {
+		return slices.Equal(mgr.active(), []string{"foo"})
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "existing cluster must be engaged")
+
+	// Stop shuts the cache down before the context of Run is done, which
+	// ends Run.
+	p.Stop()
+	select {
+	case err := <-done:
+		require.Error(t, err)
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatal("provider did not stop")
+	}
+	require.Empty(t, mgr.active(), "all clusters must be disengaged when Run returns")
+}
+
+// failingEngager fails the first engagements of every cluster.
+type failingEngager struct {
+	*engagementRecorder
+
+	failures int
+	lock     sync.Mutex
+	calls    map[string]int
+}
+
+func (e *failingEngager) Engage(ctx context.Context, name string, cl cluster.Cluster) error {
+	e.lock.Lock()
+	e.calls[name]++
+	calls := e.calls[name]
+	e.lock.Unlock()
+
+	if calls <= e.failures {
+		return errors.New("engagement failed")
+	}
+	return e.engagementRecorder.Engage(ctx, name, cl)
+}
+
+func TestProviderRequeuesFailedEngagement(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := fakeserver.New(nil)
+	defer srv.Close()
+	createConfigMap(t, srv, "foo", "a")
+
+	p, err := New(srv.Config(), &corev1.ConfigMap{}, Options{})
+	require.NoError(t, err)
+	defer p.Stop()
+
+	mgr := &failingEngager{engagementRecorder: newEngagementRecorder(), failures: 2, calls: map[string]int{}}
+	go func() {
+		_ = p.Run(ctx, mgr)
+	}()
+
+	require.Eventually(t, func() bool {
+		return slices.Equal(mgr.active(), []string{"foo"})
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "cluster must be engaged after failed engagements")
+	mgr.lock.Lock()
+	require.Equal(t, 3, mgr.calls["foo"])
+	mgr.lock.Unlock()
+
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	require.Empty(t, p.failures, "failures must be forgotten after a successful engagement")
+	require.Contains(t, p.clusters, logicalcluster.Name("foo"))
+}
+
+func TestProviderReconcilesClusterSerially(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := fakeserver.New(nil)
+	defer srv.Close()
+
+	// the filter runs for every object of the cluster on every reconcile.
+	var lock sync.Mutex
+	inFlight := map[logicalcluster.Name]int{}
+	maxInFlight := 0
+	filter := func(obj client.Object) bool {
+		clusterName := logicalcluster.From(obj)
+		lock.Lock()
+		inFlight[clusterName]++
+		maxInFlight = max(maxInFlight, inFlight[clusterName])
+		lock.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		lock.Lock()
+		inFlight[clusterName]--
+		lock.Unlock()
+		return true
+	}
+
+	p, err := New(srv.Config(), &corev1.ConfigMap{}, Options{
+		EngagementFilter:      filter,
+		EngagementParallelism: 8,
+	})
+	require.NoError(t, err)
+	defer p.Stop()
+
+	mgr := newEngagementRecorder()
+	go func() {
+		_ = p.Run(ctx, mgr)
+	}()
+
+	for i := range 20 {
+		createConfigMap(t, srv, "foo", fmt.Sprintf("foo-%d", i))
+		createConfigMap(t, srv, "bar", fmt.Sprintf("bar-%d", i))
+	}
+	require.Eventually(t, func() bool {
+		return slices.Equal(mgr.active(), []string{"bar", "foo"})
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "clusters must be engaged")
+
+	lock.Lock()
+	defer lock.Unlock()
+	require.Equal(t, 1, maxInFlight, "a cluster must never be reconciled by two workers at once")
+}
+
+func TestScopedCluster(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := fakeserver.New(nil)
+	defer srv.Close()
+	createConfigMap(t, srv, "foo", "a")
+	createConfigMap(t, srv, "foo", "b")
+	createConfigMap(t, srv, "bar", "a")
+
+	wc, err := NewWildcardCache(srv.Config(), cache.Options{})
+	require.NoError(t, err)
+	go func() {
+		_ = wc.Start(ctx)
+	}()
+
+	require.NoError(t, wc.IndexField(ctx, &corev1.ConfigMap{}, "metadata.name", func(obj client.Object) []string {
+		return []string{obj.GetName()}
+	}))
+
+	cl, err := newScopedCluster(srv.Config(), "foo", wc, scheme.Scheme, scopedClusterOptions{})
+	require.NoError(t, err)
+
+	t.Run("client", func(t *testing.T) {
+		cm := &corev1.ConfigMap{}
+		require.NoError(t, cl.GetClient().Get(ctx, client.ObjectKey{Namespace: "default", Name: "a"}, cm))
+		require.Equal(t, "foo", cm.Data["cluster"])
+		require.Equal(t, "foo", cm.Annotations[logicalcluster.AnnotationKey])
+
+		cms := &corev1.ConfigMapList{}
+		require.NoError(t, cl.GetClient().List(ctx, cms))
+		require.Len(t, cms.Items, 2)
+	})
+
+	t.Run("cache", func(t *testing.T) {
+		cm := &corev1.ConfigMap{}
+		require.NoError(t, cl.GetCache().Get(ctx, client.ObjectKey{Namespace: "default", Name: "a"}, cm), "reading must start the informer")
+		require.Equal(t, "foo", cm.Data["cluster"])
+
+		err := cl.GetCache().Get(ctx, client.ObjectKey{Namespace: "default", Name: "c"}, cm)
+		require.True(t, apierrors.IsNotFound(err), "expected NotFound, got %v", err)
+
+		cms := &corev1.ConfigMapList{}
+		require.NoError(t, cl.GetCache().List(ctx, cms))
+		require.Len(t, cms.Items, 2)
+		for _, item := range cms.Items {
+			require.Equal(t, "foo", item.Data["cluster"], "cache must not return objects of other clusters")
+		}
+
+		cms = &corev1.ConfigMapList{}
+		require.NoError(t, cl.GetCache().List(ctx, cms, client.MatchingFields{"metadata.name": "a"}))
+		require.Len(t, cms.Items, 1, "field index must be scoped to the cluster")
+		require.Equal(t, "foo", cms.Items[0].Data["cluster"])
+
+		cms = &corev1.ConfigMapList{}
+		require.NoError(t, cl.GetCache().List(ctx, cms, client.MatchingFields{"metadata.name": "b"}, client.InNamespace("default")))
+		require.Len(t, cms.Items, 1)
+	})
+
+	t.Run("wildcard cache", func(t *testing.T) {
+		cms := &corev1.ConfigMapList{}
+		require.NoError(t, wc.List(ctx, cms, client.MatchingFields{"metadata.name": "a"}))
+		require.Len(t, cms.Items, 2, "field index must span all clusters")
+
+		cms = &corev1.ConfigMapList{}
+		require.NoError(t, wc.List(ctx, cms, client.MatchingFields{"metadata.name": "b"}, client.InNamespace("default")))
+		require.Len(t, cms.Items, 1)
+		require.Equal(t, "foo", cms.Items[0].Data["cluster"])
+	})
+}
+
+func TestProviderEngagementPolicy(t *testing.T) {
+	secret := func(name string) *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}}
+	}
+	configMap := func(name string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}}
+	}
+
+	type step struct {
+		cluster    logicalcluster.Name
+		create     client.Object
+		delete     client.Object
+		wantActive []string
+	}
+
+	tests := []struct {
+		name    string
+		policy  EngagementPolicy
+		initial map[logicalcluster.Name][]client.Object
+		steps   []step
+	}{
+		{
+			name:   "any",
+			policy: EngageOnAny,
+			initial: map[logicalcluster.Name][]client.Object{
+				"foo": {configMap("a")},
+				"bar": {secret("a")},
+			},
+			steps: []step{
+				{wantActive: []string{"bar", "foo"}},
+				{cluster: "bar", create: configMap("a"), wantActive: []string{"bar", "foo"}},
+				{cluster: "bar", delete: secret("a"), wantActive: []string{"bar", "foo"}},
+				{cluster: "bar", delete: configMap("a"), wantActive: []string{"foo"}},
+				{cluster: "baz", create: secret("a"), wantActive: []string{"baz", "foo"}},
+			},
+		},
+		{
+			name:   "all",
+			policy: EngageOnAll,
+			initial: map[logicalcluster.Name][]client.Object{
+				"foo": {configMap("a")},
+				"bar": {configMap("a"), secret("a")},
+			},
+			steps: []step{
+				{wantActive: []string{"bar"}},
+				{cluster: "foo", create: secret("a"), wantActive: []string{"bar", "foo"}},
+				{cluster: "bar", delete: configMap("a"), wantActive: []string{"foo"}},
+				{cluster: "baz", create: secret("a"), wantActive: []string{"foo"}},
+				{cluster: "baz", create: configMap("a"), wantActive: []string{"baz", "foo"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			srv := fakeserver.New(nil)
+			defer srv.Close()
+			clusterClient := func(clusterName logicalcluster.Name) client.Client {
+				cli, err := client.New(srv.ClusterConfig(clusterName), client.Options{})
+				require.NoError(t, err)
+				return cli
+			}
+			for clusterName, objs := range tt.initial {
+				for _, obj := range objs {
+					require.NoError(t, clusterClient(clusterName).Create(ctx, obj.DeepCopyObject().(client.Object)))
+				}
+			}
+
+			p, err := New(srv.Config(), &corev1.ConfigMap{}, Options{
+				EngagementObjects: []client.Object{&corev1.Secret{}},
+				EngagementPolicy:  tt.policy,
+			})
+			require.NoError(t, err)
+			defer p.Stop()
+
+			mgr := newEngagementRecorder()
+			go func() {
+				_ = p.Run(ctx, mgr)
+			}()
+
+			for i, s := range tt.steps {
+				switch {
+				case s.create != nil:
+					require.NoError(t, clusterClient(s.cluster).Create(ctx, s.create))
+				case s.delete != nil:
+					require.NoError(t, clusterClient(s.cluster).Delete(ctx, s.delete))
+				}
+				require.Eventually(t, func() bool {
+					return slices.Equal(mgr.active(), s.wantActive)
+				}, wait.ForeverTestTimeout, 10*time.Millisecond, "step %d: expected %v engaged, got %v", i, s.wantActive, mgr.active())
+			}
+		})
+	}
+
+	_, err := New(&rest.Config{}, &corev1.ConfigMap{}, Options{EngagementPolicy: "Some"})
+	require.Error(t, err, "unknown engagement policy must be rejected")
+}
+
+func TestProviderEngagementDecisions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := fakeserver.New(nil)
+	defer srv.Close()
+	createConfigMap(t, srv, "foo", "a")
+	createConfigMap(t, srv, "foo", "b")
+	createConfigMap(t, srv, "bar", "a")
+	cli, err := client.New(srv.ClusterConfig("foo"), client.Options{})
+	require.NoError(t, err)
+	require.NoError(t, cli.Create(ctx, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "a"}}))
+
+	wc, err := NewWildcardCache(srv.Config(), cache.Options{})
+	require.NoError(t, err)
+	go func() {
+		_ = wc.Start(ctx)
+	}()
+
+	p, err := New(srv.Config(), &corev1.ConfigMap{}, Options{
+		WildcardCache:     wc,
+		EngagementObjects: []client.Object{&corev1.Secret{}},
+		EngagementPolicy:  EngageOnAll,
+	})
+	require.NoError(t, err)
+
+	decisions, err := p.EngagementDecisions(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []EngagementDecision{
+		{Cluster: "bar", Engage: false, Objects: map[string]int{"ConfigMap": 1, "Secret": 0}},
+		{Cluster: "foo", Engage: true, Objects: map[string]int{"ConfigMap": 2, "Secret": 1}},
+	}, decisions)
+}
+
+func TestProviderEngagementFilter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sch := runtime.NewScheme()
+	require.NoError(t, scheme.AddToScheme(sch))
+	require.NoError(t, apisv1alpha1.AddToScheme(sch))
+
+	srv := fakeserver.New(sch, fakeserver.Resource{
+		GroupVersionKind: apisv1alpha1.SchemeGroupVersion.WithKind("APIBinding"),
+		Resource:         "apibindings",
+		Status:           true,
+	})
+	defer srv.Close()
+
+	cli, err := client.New(srv.ClusterConfig("foo"), client.Options{Scheme: sch})
+	require.NoError(t, err)
+	binding := &apisv1alpha1.APIBinding{ObjectMeta: metav1.ObjectMeta{Name: "binding"}}
+	require.NoError(t, cli.Create(ctx, binding))
+
+	p, err := New(srv.Config(), &apisv1alpha1.APIBinding{}, Options{
+		Scheme:           sch,
+		EngagementFilter: APIBindingBound,
+	})
+	require.NoError(t, err)
+	defer p.Stop()
+
+	mgr := newEngagementRecorder()
+	go func() {
+		_ = p.Run(ctx, mgr)
+	}()
+
+	require.Never(t, func() bool {
+		return len(mgr.active()) > 0
+	}, 200*time.Millisecond, 10*time.Millisecond, "cluster with unbound APIBinding must not be engaged")
+
+	binding.Status.Phase = apisv1alpha1.APIBindingPhaseBound
+	require.NoError(t, cli.Status().Update(ctx, binding))
+	require.Eventually(t, func() bool {
+		return slices.Equal(mgr.active(), []string{"foo"})
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "cluster must be engaged once bound")
+
+	binding.Status.Phase = apisv1alpha1.APIBindingPhaseBinding
+	require.NoError(t, cli.Status().Update(ctx, binding))
+	require.Eventually(t, func() bool {
+		return len(mgr.active()) == 0
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "cluster must be disengaged when not bound anymore")
+}
+
+func TestProviderDisengageGracePeriod(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := fakeserver.New(nil)
+	defer srv.Close()
+	createConfigMap(t, srv, "foo", "a")
+	cli, err := client.New(srv.ClusterConfig("foo"), client.Options{})
+	require.NoError(t, err)
+
+	gracePeriod := time.Second
+	p, err := New(srv.Config(), &corev1.ConfigMap{}, Options{DisengageGracePeriod: gracePeriod})
+	require.NoError(t, err)
+	defer p.Stop()
+
+	mgr := newEngagementRecorder()
+	go func() {
+		_ = p.Run(ctx, mgr)
+	}()
+
+	require.Eventually(t, func() bool {
+		return slices.Equal(mgr.active(), []string{"foo"})
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "existing cluster must be engaged")
+	mgr.lock.Lock()
+	engagedCtx := mgr.engaged["foo"]
+	mgr.lock.Unlock()
+
+	// an empty cluster that gets objects again within the grace period stays
+	// engaged without restart.
+	require.NoError(t, cli.Delete(ctx, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "a"}}))
+	require.Never(t, func() bool {
+		return engagedCtx.Err() != nil
+	}, gracePeriod/2, 10*time.Millisecond, "cluster must stay engaged during the grace period")
+	createConfigMap(t, srv, "foo", "b")
+	require.Never(t, func() bool {
+		return engagedCtx.Err() != nil
+	}, gracePeriod, 10*time.Millisecond, "cluster must not be disengaged after it got objects again")
+
+	// otherwise, it is disengaged after the grace period.
+	start := time.Now()
+	require.NoError(t, cli.Delete(ctx, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "b"}}))
+	require.Eventually(t, func() bool {
+		return engagedCtx.Err() != nil
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "cluster must be disengaged after the grace period")
+	require.GreaterOrEqual(t, time.Since(start), gracePeriod)
+}
+
+func TestProviderImpersonation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := fakeserver.New(nil)
+	defer srv.Close()
+	createConfigMap(t, srv, "foo", "a")
+	createConfigMap(t, srv, "bar", "a")
+
+	// record the impersonated user of every request by cluster.
+	var lock sync.Mutex
+	users := map[string]string{}
+	cfg := srv.Config()
+	cfg.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if user := req.Header.Get("Impersonate-User"); user != "" {
+				lock.Lock()
+				users[strings.Split(req.URL.Path, "/")[2]] = user
+				lock.Unlock()
+			}
+			return rt.RoundTrip(req)
+		})
+	})
+
+	p, err := New(cfg, &corev1.ConfigMap{}, Options{
+		Impersonate: func(_ context.Context, clusterName logicalcluster.Name) (*rest.ImpersonationConfig, error) {
+			if clusterName == "bar" {
+				return nil, nil
+			}
+			return &rest.ImpersonationConfig{
+				UserName: "system:serviceaccount:default:" + clusterName.String(),
+				Groups:   []string{"system:authenticated"},
+			}, nil
+		},
+	})
+	require.NoError(t, err)
+	defer p.Stop()
+
+	mgr := newEngagementRecorder()
+	go func() {
+		_ = p.Run(ctx, mgr)
+	}()
+	require.Eventually(t, func() bool {
+		return slices.Equal(mgr.active(), []string{"bar", "foo"})
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "existing clusters must be engaged")
+
+	for _, clusterName := range []string{"foo", "bar"} {
+		cl, err := p.Get(ctx, clusterName)
+		require.NoError(t, err)
+		require.NoError(t, cl.GetClient().Update(ctx, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "a"}}))
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	require.Equal(t, map[string]string{"foo": "system:serviceaccount:default:foo"}, users,
+		"only requests of the scoped client of foo must be impersonated")
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// testLock is a leader election lock held by another replica until it is
+// released.
+type testLock struct {
+	lock     sync.Mutex
+	released bool
+	record   *resourcelock.LeaderElectionRecord
+}
+
+var _ resourcelock.Interface = &testLock{}
+
+func (l *testLock) release() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.released = true
+}
+
+func (l *testLock) Get(context.Context) (*resourcelock.LeaderElectionRecord, []byte, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	record := l.record
+	switch {
+	case !l.released:
+		record = &resourcelock.LeaderElectionRecord{
+			HolderIdentity:       "other",
+			LeaseDurationSeconds: 3600,
+			AcquireTime:          metav1.Now(),
+			RenewTime:            metav1.Now(),
+		}
+	case record == nil:
+		return nil, nil, apierrors.NewNotFound(coordinationv1.Resource("leases"), "test")
+	}
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return nil, nil, err
+	}
+	return record, raw, nil
+}
+
+func (l *testLock) Create(_ context.Context, ler resourcelock.LeaderElectionRecord) error {
+	return l.Update(context.Background(), ler)
+}
+
+func (l *testLock) Update(_ context.Context, ler resourcelock.LeaderElectionRecord) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.record = &ler
+	return nil
+}
+
+func (l *testLock) RecordEvent(string) {}
+
+func (l *testLock) Identity() string { return "self" }
+
+func (l *testLock) Describe() string { return "test" }
+
+func TestProviderSetupWithManager(t *testing.T) {
+	tests := map[string]struct {
+		leaderElection bool
+		warmStandby    bool
+	}{
+		"without leader election":            {},
+		"with leader election":               {leaderElection: true},
+		"with leader election, warm standby": {leaderElection: true, warmStandby: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := fakeserver.New(nil)
+			defer srv.Close()
+			createConfigMap(t, srv, "foo", "a")
+
+			p, err := New(srv.Config(), &corev1.ConfigMap{}, Options{WarmStandby: tt.warmStandby})
+			require.NoError(t, err)
+
+			lock := &testLock{}
+			mgr, err := mcmanager.New(srv.ClusterConfig("host"), p, manager.Options{
+				Metrics:                             metricsserver.Options{BindAddress: "0"},
+				LeaderElection:                      tt.leaderElection,
+				LeaderElectionID:                    "test",
+				LeaderElectionNamespace:             "default",
+				LeaderElectionResourceLockInterface: lock,
+				LeaseDuration:                       ptr.To(2 * time.Second),
+				RenewDeadline:                       ptr.To(time.Second),
+				RetryPeriod:                         ptr.To(50 * time.Millisecond),
+			})
+			require.NoError(t, err)
+			require.NoError(t, p.SetupWithManager(mgr))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				_ = mgr.Start(ctx)
+			}()
+			defer func() {
+				cancel()
+				<-done
+			}()
+
+			cacheStarted := func() bool {
+				p.cacheLock.Lock()
+				defer p.cacheLock.Unlock()
+				return p.cacheDone != nil
+			}
+			engaged := func() bool {
+				_, err := p.Get(ctx, "foo")
+				return err == nil
+			}
+
+			if tt.leaderElection {
+				if tt.warmStandby {
+					require.Eventually(t, cacheStarted, wait.ForeverTestTimeout, 10*time.Millisecond, "cache must start on a standby replica")
+				} else {
+					require.Never(t, cacheStarted, 300*time.Millisecond, 10*time.Millisecond, "cache must not start before the leader election is won")
+				}
+				require.Never(t, engaged, 300*time.Millisecond, 10*time.Millisecond, "clusters must not be engaged before the leader election is won")
+				lock.release()
+			}
+
+			require.Eventually(t, cacheStarted, wait.ForeverTestTimeout, 10*time.Millisecond, "cache must start")
+			require.Eventually(t, engaged, wait.ForeverTestTimeout, 10*time.Millisecond, "cluster must be engaged")
+		})
+	}
+}
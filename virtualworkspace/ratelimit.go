@@ -0,0 +1,202 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualworkspace
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kcp-dev/logicalcluster/v3"
+	"golang.org/x/time/rate"
+
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// RateLimitOptions configure client-side rate limiting for the scoped clients
+// the provider hands out for each logical cluster. All requests of a scoped
+// client first take a token from the cluster's own bucket and then one from
+// the global bucket shared by all clusters. A noisy cluster hence exhausts its
+// own budget before it can starve the others.
+type RateLimitOptions struct {
+	// QPS is the maximum number of requests per second across all scoped
+	// clients. Zero disables the global limit.
+	QPS float32
+	// Burst is the maximum burst of requests across all scoped clients. It
+	// defaults to QPS, but at least 1.
+	Burst int
+
+	// PerClusterQPS is the maximum number of requests per second of a single
+	// logical cluster. Zero disables the per-cluster limit.
+	PerClusterQPS float32
+	// PerClusterBurst is the maximum burst of requests of a single logical
+	// cluster. It defaults to PerClusterQPS, but at least 1.
+	PerClusterBurst int
+}
+
+// newGlobalRateLimiter returns the limiter shared by all scoped clients, or nil
+// if there is no global budget.
+func (o *RateLimitOptions) newGlobalRateLimiter() *rate.Limiter {
+	if o == nil || o.QPS <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(o.QPS), defaultBurst(o.QPS, o.Burst))
+}
+
+// newClusterRateLimiter returns the limiter for the scoped client of the given
+// cluster, or nil if no rate limiting is configured at all. In the latter case
+// the scoped client falls back to the QPS and Burst of its rest.Config.
+func (o *RateLimitOptions) newClusterRateLimiter(clusterName logicalcluster.Name, global *rate.Limiter) flowcontrol.RateLimiter {
+	if o == nil {
+		return nil
+	}
+
+	var perCluster *rate.Limiter
+	if o.PerClusterQPS > 0 {
+		perCluster = rate.NewLimiter(rate.Limit(o.PerClusterQPS), defaultBurst(o.PerClusterQPS, o.PerClusterBurst))
+	}
+	if perCluster == nil && global == nil {
+		return nil
+	}
+
+	return &clusterRateLimiter{
+		clusterName: clusterName,
+		cluster:     perCluster,
+		global:      global,
+	}
+}
+
+func defaultBurst(qps float32, burst int) int {
+	if burst > 0 {
+		return burst
+	}
+	return max(1, int(qps))
+}
+
+var _ flowcontrol.RateLimiter = &clusterRateLimiter{}
+
+// clusterRateLimiter chains the per-cluster and the global token bucket and
+// records throttling metrics for its cluster. Either bucket may be nil.
+type clusterRateLimiter struct {
+	clusterName logicalcluster.Name
+
+	cluster *rate.Limiter
+	global  *rate.Limiter
+}
+
+// TryAccept returns true if a token is taken immediately from both buckets.
+// If either bucket has no token, neither is consumed.
+func (l *clusterRateLimiter) TryAccept() bool {
+	return l.tryAcceptAt(time.Now())
+}
+
+func (l *clusterRateLimiter) tryAcceptAt(now time.Time) bool {
+	var reserved []*rate.Reservation
+	for _, limiter := range []*rate.Limiter{l.cluster, l.global} {
+		if limiter == nil {
+			continue
+		}
+		r := limiter.ReserveN(now, 1)
+		if !r.OK() || r.DelayFrom(now) > 0 {
+			// hand back all tokens, including those of the other bucket.
+			r.CancelAt(now)
+			for _, r := range reserved {
+				r.CancelAt(now)
+			}
+			return false
+		}
+		reserved = append(reserved, r)
+	}
+	return true
+}
+
+// Accept returns once a token becomes available in both buckets.
+func (l *clusterRateLimiter) Accept() {
+	_ = l.Wait(context.Background())
+}
+
+// Wait returns nil if a token is taken from both buckets before the context
+// is done. Both tokens are reserved up front and handed back if the wait
+// fails, so a cancelled wait spends the budget of neither bucket.
+func (l *clusterRateLimiter) Wait(ctx context.Context) error {
+	start := time.Now()
+	defer func() {
+		clientRateLimiterDuration.WithLabelValues(l.clusterName.String()).Observe(time.Since(start).Seconds())
+	}()
+
+	var reserved []*rate.Reservation
+	// cancel as of start, reservations without delay are already due by now.
+	cancel := func() {
+		for _, r := range reserved {
+			r.CancelAt(start)
+		}
+	}
+
+	var delay time.Duration
+	for _, b := range []struct {
+		name    string
+		limiter *rate.Limiter
+	}{{"cluster", l.cluster}, {"global", l.global}} {
+		if b.limiter == nil {
+			continue
+		}
+		r := b.limiter.ReserveN(start, 1)
+		if !r.OK() {
+			cancel()
+			return fmt.Errorf("rate: wait exceeds the burst of the %s limiter", b.name)
+		}
+		reserved = append(reserved, r)
+		if d := r.DelayFrom(start); d > 0 {
+			clientThrottledRequests.WithLabelValues(l.clusterName.String(), b.name).Inc()
+			delay = max(delay, d)
+		}
+	}
+	if delay == 0 {
+		return nil
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(start.Add(delay)) {
+		cancel()
+		return fmt.Errorf("rate: wait of %s would exceed context deadline", delay)
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		cancel()
+		return ctx.Err()
+	}
+}
+
+// Stop implements flowcontrol.RateLimiter. The token buckets hold no
+// resources to release.
+func (l *clusterRateLimiter) Stop() {}
+
+// QPS returns the effective QPS, i.e. the lower of both buckets.
+func (l *clusterRateLimiter) QPS() float32 {
+	switch {
+	case l.cluster == nil:
+		return float32(l.global.Limit())
+	case l.global == nil:
+		return float32(l.cluster.Limit())
+	default:
+		return float32(min(l.cluster.Limit(), l.global.Limit()))
+	}
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualworkspace
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kcp-dev/logicalcluster/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClusterRateLimiterTryAccept(t *testing.T) {
+	type try struct {
+		cluster logicalcluster.Name
+		after   time.Duration
+		want    bool
+	}
+	tests := map[string]struct {
+		opts  RateLimitOptions
+		tries []try
+	}{
+		"global only": {
+			opts: RateLimitOptions{QPS: 1, Burst: 2},
+			tries: []try{
+				{cluster: "a", want: true},
+				{cluster: "b", want: true},
+				{cluster: "a", want: false},
+				{cluster: "b", after: time.Second, want: true},
+			},
+		},
+		"per cluster only": {
+			opts: RateLimitOptions{PerClusterQPS: 1, PerClusterBurst: 1},
+			tries: []try{
+				{cluster: "a", want: true},
+				{cluster: "a", want: false},
+				{cluster: "b", want: true},
+				{cluster: "a", after: time.Second, want: true},
+			},
+		},
+		"global budget caps all clusters": {
+			opts: RateLimitOptions{QPS: 10, Burst: 3, PerClusterQPS: 1, PerClusterBurst: 1},
+			tries: []try{
+				{cluster: "a", want: true},
+				{cluster: "a", want: false},
+				{cluster: "b", want: true},
+				{cluster: "c", want: true},
+				{cluster: "d", want: false},
+			},
+		},
+		"global rejections keep the cluster budget": {
+			opts: RateLimitOptions{QPS: 1, Burst: 1, PerClusterQPS: 0.001, PerClusterBurst: 2},
+			tries: []try{
+				{cluster: "a", want: true},
+				{cluster: "b", want: false},
+				{cluster: "b", want: false},
+				{cluster: "b", want: false},
+				{cluster: "b", after: time.Second, want: true},
+				{cluster: "b", after: 2 * time.Second, want: true},
+				{cluster: "b", after: 3 * time.Second, want: false},
+			},
+		},
+		"cluster rejections keep the global budget": {
+			opts: RateLimitOptions{QPS: 0.001, Burst: 2, PerClusterQPS: 0.001, PerClusterBurst: 1},
+			tries: []try{
+				{cluster: "a", want: true},
+				{cluster: "a", want: false},
+				{cluster: "a", want: false},
+				{cluster: "b", want: true},
+				{cluster: "c", want: false},
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			global := tt.opts.newGlobalRateLimiter()
+			limiters := map[logicalcluster.Name]*clusterRateLimiter{}
+			start := time.Now()
+			for i, try := range tt.tries {
+				l, ok := limiters[try.cluster]
+				if !ok {
+					l = tt.opts.newClusterRateLimiter(try.cluster, global).(*clusterRateLimiter)
+					limiters[try.cluster] = l
+				}
+				require.Equal(t, try.want, l.tryAcceptAt(start.Add(try.after)), "try %d of cluster %s", i, try.cluster)
+			}
+		})
+	}
+}
+
+func TestClusterRateLimiterWaitCancelled(t *testing.T) {
+	opts := &RateLimitOptions{QPS: 0.001, Burst: 1, PerClusterQPS: 0.001, PerClusterBurst: 1}
+	global := opts.newGlobalRateLimiter()
+	a := opts.newClusterRateLimiter("a", global).(*clusterRateLimiter)
+	b := opts.newClusterRateLimiter("b", global).(*clusterRateLimiter)
+
+	// a drains the global bucket, b has to wait for it.
+	require.NoError(t, a.Wait(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- b.Wait(ctx) }()
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+	require.InDelta(t, 1.0, b.cluster.Tokens(), 0.01, "a cancelled wait must hand back the cluster token")
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.Error(t, b.Wait(ctx), "a wait beyond the deadline must fail right away")
+	require.InDelta(t, 1.0, b.cluster.Tokens(), 0.01, "a failed wait must hand back the cluster token")
+}
+
+func TestClusterRateLimiterQPS(t *testing.T) {
+	tests := map[string]struct {
+		opts RateLimitOptions
+		want float32
+	}{
+		"global only":      {opts: RateLimitOptions{QPS: 5}, want: 5},
+		"per cluster only": {opts: RateLimitOptions{PerClusterQPS: 2}, want: 2},
+		"lower of both":    {opts: RateLimitOptions{QPS: 5, PerClusterQPS: 7}, want: 5},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			l := tt.opts.newClusterRateLimiter("a", tt.opts.newGlobalRateLimiter())
+			require.Equal(t, tt.want, l.QPS())
+		})
+	}
+
+	require.Nil(t, (&RateLimitOptions{}).newClusterRateLimiter("a", nil), "no limits must fall back to the rest.Config")
+}
+
+func TestClusterRateLimiterMetrics(t *testing.T) {
+	forgetClusterMetrics("metrics-a")
+	forgetClusterMetrics("metrics-b")
+	defer forgetClusterMetrics("metrics-b")
+
+	opts := &RateLimitOptions{QPS: 10, Burst: 1}
+	global := opts.newGlobalRateLimiter()
+	a := opts.newClusterRateLimiter("metrics-a", global)
+	b := opts.newClusterRateLimiter("metrics-b", global)
+
+	// the second request has to wait for the global bucket.
+	require.NoError(t, a.Wait(context.Background()))
+	require.NoError(t, a.Wait(context.Background()))
+	require.NoError(t, b.Wait(context.Background()))
+	require.Equal(t, 1.0, testutil.ToFloat64(clientThrottledRequests.WithLabelValues("metrics-a", "global")))
+	require.Equal(t, 1.0, testutil.ToFloat64(clientThrottledRequests.WithLabelValues("metrics-b", "global")))
+	clientCrossClusterWrites.WithLabelValues("metrics-a", "create").Inc()
+
+	throttled := testutil.CollectAndCount(clientThrottledRequests)
+	durations := testutil.CollectAndCount(clientRateLimiterDuration)
+	writes := testutil.CollectAndCount(clientCrossClusterWrites)
+
+	forgetClusterMetrics("metrics-a")
+	require.Equal(t, throttled-1, testutil.CollectAndCount(clientThrottledRequests))
+	require.Equal(t, durations-1, testutil.CollectAndCount(clientRateLimiterDuration))
+	require.Equal(t, writes-1, testutil.CollectAndCount(clientCrossClusterWrites))
+	require.Equal(t, 1.0, testutil.ToFloat64(clientThrottledRequests.WithLabelValues("metrics-b", "global")), "series of other clusters must be kept")
+}
@@ -0,0 +1,392 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualworkspace
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/kcp-dev/logicalcluster/v3"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ShardGroupLabel is set on the Leases of all replicas sharing the logical
+// clusters of a provider. Its value is ShardingOptions.Group.
+const ShardGroupLabel = "multicluster-provider.kcp.io/shard-group"
+
+const (
+	defaultShardLeaseDuration = 30 * time.Second
+	defaultShardRenewDeadline = 20 * time.Second
+	defaultShardRenewInterval = 5 * time.Second
+)
+
+// ShardingOptions configure splitting the logical clusters of a provider
+// across multiple controller replicas. Every replica maintains a Lease in the
+// given namespace and considers all replicas with a current Lease as members.
+// Each logical cluster is engaged by exactly one member, chosen by rendezvous
+// hashing, so that membership changes only move the clusters of the replicas
+// joining or leaving.
+//
+// Clusters a replica gains through a membership change are only engaged one
+// and a half renew intervals after it saw the change, so that the previous
+// owner had time to notice the change and disengage them. A replica without
+// live peers engages its clusters at once, as there is no owner to wait for.
+// A replica stops owning clusters once it failed to renew its Lease for the
+// renew deadline, before its peers consider the Lease expired. Expired Leases
+// of replicas that went away without releasing them are deleted.
+//
+// The Leases live in a regular Kubernetes API server, not in the virtual
+// workspace. The identity used by Config needs to be able to get, list,
+// create, update and delete coordination.k8s.io Leases in Namespace.
+type ShardingOptions struct {
+	// Config points to the API server holding the Leases.
+	Config *rest.Config
+	// Namespace is the namespace of the Leases.
+	Namespace string
+	// Group identifies the replicas sharing the logical clusters. All replicas
+	// of one controller must use the same group.
+	Group string
+	// Identity is the unique identity of this replica. It must be a valid
+	// DNS subdomain part and defaults to the hostname plus a random suffix.
+	Identity string
+
+	// LeaseDuration is the time after which a replica that failed to renew
+	// its Lease is no longer considered a member. It defaults to 30s.
+	LeaseDuration time.Duration
+	// RenewDeadline is the time after which a replica that failed to renew
+	// its Lease gives up its clusters. It must be shorter than the Lease
+	// duration and defaults to 20s.
+	RenewDeadline time.Duration
+	// RenewInterval is the interval in which the Lease is renewed and the
+	// membership is refreshed. It must be shorter than the renew deadline and
+	// defaults to 5s.
+	RenewInterval time.Duration
+}
+
+// sharder maintains the Lease of this replica and decides which logical
+// clusters it owns.
+type sharder struct {
+	client    client.Client
+	namespace string
+	group     string
+	identity  string
+
+	leaseDuration time.Duration
+	renewDeadline time.Duration
+	renewInterval time.Duration
+
+	log logr.Logger
+
+	lock    sync.RWMutex
+	members []string
+	// previous are the members before the last change at changedAt.
+	previous  []string
+	changedAt time.Time
+	lastRenew time.Time
+}
+
+func newSharder(opts *ShardingOptions, log logr.Logger) (*sharder, error) {
+	if opts.Config == nil {
+		return nil, fmt.Errorf("sharding requires a rest.Config for the Leases")
+	}
+	if opts.Namespace == "" || opts.Group == "" {
+		return nil, fmt.Errorf("sharding requires a namespace and a group")
+	}
+
+	cli, err := client.New(opts.Config, client.Options{Scheme: scheme.Scheme})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Lease client: %w", err)
+	}
+
+	identity := opts.Identity
+	if identity == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine hostname: %w", err)
+		}
+		identity = hostname + "-" + rand.String(5)
+	}
+
+	s := &sharder{
+		client:        cli,
+		namespace:     opts.Namespace,
+		group:         opts.Group,
+		identity:      identity,
+		leaseDuration: opts.LeaseDuration,
+		renewDeadline: opts.RenewDeadline,
+		renewInterval: opts.RenewInterval,
+		log:           log.WithValues("identity", identity),
+	}
+	if s.leaseDuration <= 0 {
+		s.leaseDuration = defaultShardLeaseDuration
+	}
+	if s.renewDeadline <= 0 {
+		s.renewDeadline = defaultShardRenewDeadline
+	}
+	if s.renewInterval <= 0 {
+		s.renewInterval = defaultShardRenewInterval
+	}
+	if s.renewDeadline >= s.leaseDuration {
+		return nil, fmt.Errorf("shard renew deadline %s must be shorter than the lease duration %s", s.renewDeadline, s.leaseDuration)
+	}
+	if s.renewInterval >= s.renewDeadline {
+		return nil, fmt.Errorf("shard renew interval %s must be shorter than the renew deadline %s", s.renewInterval, s.renewDeadline)
+	}
+
+	return s, nil
+}
+
+// owns returns true if this replica is responsible for the given logical
+// cluster. Until the own Lease has been renewed successfully, or if renewing
+// failed for longer than the renew deadline, it owns nothing. A cluster gained
+// by the last membership change is only owned after the handoff delay, unless
+// this replica is the only member.
+func (s *sharder) owns(clusterName logicalcluster.Name) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if len(s.members) == 0 || time.Since(s.lastRenew) > s.renewDeadline {
+		return false
+	}
+	if shardOwner(s.members, clusterName) != s.identity {
+		return false
+	}
+	return !s.hasPeers() || shardOwner(s.previous, clusterName) == s.identity || time.Since(s.changedAt) >= s.handoffDelay()
+}
+
+// handoffDelay is the time after a membership change until which all peers
+// have refreshed their membership, i.e. have disengaged the clusters they
+// lost.
+func (s *sharder) handoffDelay() time.Duration {
+	return s.renewInterval * 3 / 2
+}
+
+// hasPeers returns true if other replicas than this one are members. The
+// caller must hold the lock.
+func (s *sharder) hasPeers() bool {
+	return slices.ContainsFunc(s.members, func(member string) bool { return member != s.identity })
+}
+
+// run renews the Lease and refreshes the membership until the context is
+// done. onChange is called whenever the set of members changed and, if there
+// are peers, again after the handoff delay, i.e. when clusters have to be
+// rebalanced. The Lease is deleted on return so that peers can take over.
+func (s *sharder) run(ctx context.Context, onChange func()) error {
+	defer s.release()
+
+	ticker := time.NewTicker(s.renewInterval)
+	defer ticker.Stop()
+
+	var handoff <-chan time.Time
+	for {
+		if s.sync(ctx) {
+			onChange()
+			handoff = nil
+			s.lock.RLock()
+			if s.hasPeers() {
+				handoff = time.After(s.handoffDelay())
+			}
+			s.lock.RUnlock()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-handoff:
+			handoff = nil
+			onChange()
+		case <-ticker.C:
+		}
+	}
+}
+
+// sync renews the Lease and refreshes the membership. It returns true if the
+// set of members changed.
+func (s *sharder) sync(ctx context.Context) bool {
+	renewed := true
+	if err := s.renew(ctx); err != nil {
+		s.log.Error(err, "failed to renew shard Lease")
+		renewed = false
+	}
+
+	members, err := s.listMembers(ctx)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err != nil {
+		// keep the last known members, a transient error must not move
+		// clusters.
+		s.log.Error(err, "failed to list shard members")
+		members = s.members
+	}
+	if renewed {
+		s.lastRenew = time.Now()
+	}
+	if time.Since(s.lastRenew) > s.renewDeadline {
+		// peers consider us gone soon, so give up all clusters.
+		members = nil
+	}
+	changed := !slices.Equal(s.members, members)
+	if changed {
+		s.log.Info("shard membership changed", "members", members)
+		s.previous, s.members, s.changedAt = s.members, members, time.Now()
+	}
+
+	return changed
+}
+
+func (s *sharder) leaseName() string {
+	return s.group + "-" + s.identity
+}
+
+func (s *sharder) renew(ctx context.Context) error {
+	now := metav1.NewMicroTime(time.Now())
+
+	lease := &coordinationv1.Lease{}
+	err := s.client.Get(ctx, client.ObjectKey{Namespace: s.namespace, Name: s.leaseName()}, lease)
+	switch {
+	case apierrors.IsNotFound(err):
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: s.namespace,
+				Name:      s.leaseName(),
+				Labels:    map[string]string{ShardGroupLabel: s.group},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       ptr.To(s.identity),
+				LeaseDurationSeconds: ptr.To(int32(s.leaseDuration.Seconds())),
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		return s.client.Create(ctx, lease)
+	case err != nil:
+		return err
+	}
+
+	lease.Spec.HolderIdentity = ptr.To(s.identity)
+	lease.Spec.LeaseDurationSeconds = ptr.To(int32(s.leaseDuration.Seconds()))
+	lease.Spec.RenewTime = &now
+	return s.client.Update(ctx, lease)
+}
+
+// listMembers returns the sorted identities of all replicas with a current
+// Lease. Expired Leases of other replicas are deleted.
+func (s *sharder) listMembers(ctx context.Context) ([]string, error) {
+	leases := &coordinationv1.LeaseList{}
+	if err := s.client.List(ctx, leases, client.InNamespace(s.namespace), client.MatchingLabels{ShardGroupLabel: s.group}); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var members []string
+	for i := range leases.Items {
+		lease := &leases.Items[i]
+		if lease.DeletionTimestamp != nil || lease.Spec.HolderIdentity == nil || lease.Spec.RenewTime == nil {
+			continue
+		}
+		duration := s.leaseDuration
+		if lease.Spec.LeaseDurationSeconds != nil {
+			duration = time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second
+		}
+		if lease.Spec.RenewTime.Add(duration).Before(now) {
+			if *lease.Spec.HolderIdentity != s.identity {
+				s.deleteExpired(ctx, lease)
+			}
+			continue
+		}
+		members = append(members, *lease.Spec.HolderIdentity)
+	}
+	slices.Sort(members)
+
+	return slices.Compact(members), nil
+}
+
+// deleteExpired deletes the expired Lease of a replica that went away without
+// releasing it, e.g. because it crashed. The precondition keeps a Lease that
+// was renewed in the meantime.
+func (s *sharder) deleteExpired(ctx context.Context, lease *coordinationv1.Lease) {
+	err := s.client.Delete(ctx, lease, client.Preconditions{ResourceVersion: ptr.To(lease.ResourceVersion)})
+	if err != nil && !apierrors.IsNotFound(err) && !apierrors.IsConflict(err) {
+		s.log.Error(err, "failed to delete expired shard Lease", "lease", lease.Name)
+		return
+	}
+	if err == nil {
+		s.log.Info("deleted expired shard Lease", "lease", lease.Name, "holder", *lease.Spec.HolderIdentity)
+	}
+}
+
+func (s *sharder) release() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	lease := &coordinationv1.Lease{ObjectMeta: metav1.ObjectMeta{Namespace: s.namespace, Name: s.leaseName()}}
+	if err := s.client.Delete(ctx, lease); err != nil && !apierrors.IsNotFound(err) {
+		s.log.Error(err, "failed to release shard Lease")
+	}
+
+	s.lock.Lock()
+	s.previous, s.members, s.changedAt = s.members, nil, time.Now()
+	s.lock.Unlock()
+}
+
+// shardOwner picks the member responsible for the given logical cluster by
+// rendezvous hashing: every member gets a score for the cluster and the
+// highest score wins. Adding or removing a member only moves the clusters
+// won or lost by that member.
+func shardOwner(members []string, clusterName logicalcluster.Name) string {
+	var (
+		owner string
+		best  uint64
+	)
+	for _, member := range members {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(member))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(clusterName.String()))
+		if score := mix64(h.Sum64()); owner == "" || score > best {
+			owner, best = member, score
+		}
+	}
+	return owner
+}
+
+// mix64 is the murmur3 finalizer. FNV alone distributes inputs sharing a
+// suffix poorly, which would skew the rendezvous scores.
+func mix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
@@ -0,0 +1,296 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualworkspace
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/kcp-dev/logicalcluster/v3"
+	"github.com/stretchr/testify/require"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestShardOwner(t *testing.T) {
+	clusters := make([]logicalcluster.Name, 1000)
+	for i := range clusters {
+		clusters[i] = logicalcluster.Name(fmt.Sprintf("cluster-%d", i))
+	}
+
+	members := []string{"replica-a", "replica-b", "replica-c"}
+	owners := map[logicalcluster.Name]string{}
+	perMember := map[string]int{}
+	for _, clusterName := range clusters {
+		owner := shardOwner(members, clusterName)
+		require.Contains(t, members, owner)
+		require.Equal(t, owner, shardOwner(members, clusterName), "owner is not stable")
+		owners[clusterName] = owner
+		perMember[owner]++
+	}
+	for _, member := range members {
+		require.Greater(t, perMember[member], 200, "clusters are not spread across members: %v", perMember)
+	}
+
+	// removing a member must only move the clusters of that member.
+	remaining := []string{"replica-a", "replica-c"}
+	for _, clusterName := range clusters {
+		if owners[clusterName] != "replica-b" {
+			require.Equal(t, owners[clusterName], shardOwner(remaining, clusterName), "cluster %s moved although its owner stayed", clusterName)
+		}
+	}
+
+	require.Empty(t, shardOwner(nil, "cluster-0"))
+}
+
+func TestSharderMembership(t *testing.T) {
+	ctx := context.Background()
+	stale := metav1.NewMicroTime(time.Now().Add(-time.Hour))
+	cli := fake.NewClientBuilder().WithObjects(
+		&coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "group-peer",
+				Labels:    map[string]string{ShardGroupLabel: "group"},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       ptr.To("peer"),
+				LeaseDurationSeconds: ptr.To[int32](3600 * 24),
+				RenewTime:            &stale,
+			},
+		},
+		&coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "group-dead",
+				Labels:    map[string]string{ShardGroupLabel: "group"},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       ptr.To("dead"),
+				LeaseDurationSeconds: ptr.To[int32](30),
+				RenewTime:            &stale,
+			},
+		},
+		&coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "other-group-peer",
+				Labels:    map[string]string{ShardGroupLabel: "other-group"},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity: ptr.To("other"),
+				RenewTime:      ptr.To(metav1.NewMicroTime(time.Now())),
+			},
+		},
+	).Build()
+
+	s := newTestSharder(cli)
+
+	require.False(t, s.owns("cluster-0"), "sharder must not own anything before it joined")
+
+	require.True(t, s.sync(ctx), "first sync must change membership")
+	require.Equal(t, []string{"peer", "self"}, s.members)
+	require.False(t, s.sync(ctx), "membership must be stable")
+	require.Error(t, cli.Get(ctx, client.ObjectKey{Namespace: "default", Name: "group-dead"}, &coordinationv1.Lease{}), "expired Lease of a peer must be deleted")
+	require.NoError(t, cli.Get(ctx, client.ObjectKey{Namespace: "default", Name: "group-peer"}, &coordinationv1.Lease{}), "current Lease of a peer must be kept")
+
+	for i := range 100 {
+		require.False(t, s.owns(logicalcluster.Name(fmt.Sprintf("cluster-%d", i))), "gained clusters must not be owned before the handoff delay")
+	}
+	passHandoffDelay(s)
+	for i := range 100 {
+		clusterName := logicalcluster.Name(fmt.Sprintf("cluster-%d", i))
+		require.Equal(t, shardOwner([]string{"peer", "self"}, clusterName) == "self", s.owns(clusterName))
+	}
+
+	s.release()
+	require.False(t, s.owns("cluster-0"), "sharder must not own anything after it left")
+	lease := &coordinationv1.Lease{}
+	require.Error(t, cli.Get(ctx, client.ObjectKey{Namespace: "default", Name: s.leaseName()}, lease), "Lease must be deleted on release")
+}
+
+func newTestSharder(cli client.Client) *sharder {
+	return &sharder{
+		client:        cli,
+		namespace:     "default",
+		group:         "group",
+		identity:      "self",
+		leaseDuration: 30 * time.Second,
+		renewDeadline: 20 * time.Second,
+		renewInterval: time.Second,
+		log:           logr.Discard(),
+	}
+}
+
+// passHandoffDelay pretends the last membership change is long ago.
+func passHandoffDelay(s *sharder) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.changedAt = time.Now().Add(-time.Hour)
+}
+
+func peerLease(identity string) *coordinationv1.Lease {
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "group-" + identity,
+			Labels:    map[string]string{ShardGroupLabel: "group"},
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       ptr.To(identity),
+			LeaseDurationSeconds: ptr.To[int32](30),
+			RenewTime:            ptr.To(metav1.NewMicroTime(time.Now())),
+		},
+	}
+}
+
+func TestSharderHandoff(t *testing.T) {
+	ctx := context.Background()
+	cli := fake.NewClientBuilder().WithObjects(peerLease("peer")).Build()
+	s := newTestSharder(cli)
+
+	require.True(t, s.sync(ctx))
+	passHandoffDelay(s)
+
+	clusters := make([]logicalcluster.Name, 100)
+	for i := range clusters {
+		clusters[i] = logicalcluster.Name(fmt.Sprintf("cluster-%d", i))
+	}
+
+	// a new member joins: clusters staying with us remain owned, clusters
+	// moving to it are given up at once.
+	require.NoError(t, cli.Create(ctx, peerLease("newbie")))
+	require.True(t, s.sync(ctx))
+	for _, clusterName := range clusters {
+		before := shardOwner([]string{"peer", "self"}, clusterName)
+		after := shardOwner([]string{"newbie", "peer", "self"}, clusterName)
+		require.Equal(t, before == "self" && after == "self", s.owns(clusterName), "cluster %s", clusterName)
+	}
+
+	// a member leaves: its clusters are only taken over after the handoff.
+	require.NoError(t, cli.Delete(ctx, peerLease("peer")))
+	require.True(t, s.sync(ctx))
+	gained := 0
+	for _, clusterName := range clusters {
+		before := shardOwner([]string{"newbie", "peer", "self"}, clusterName)
+		after := shardOwner([]string{"newbie", "self"}, clusterName)
+		if before != "self" && after == "self" {
+			gained++
+			require.False(t, s.owns(clusterName), "cluster %s gained before the handoff delay", clusterName)
+		}
+	}
+	require.NotZero(t, gained)
+	passHandoffDelay(s)
+	for _, clusterName := range clusters {
+		require.Equal(t, shardOwner([]string{"newbie", "self"}, clusterName) == "self", s.owns(clusterName), "cluster %s", clusterName)
+	}
+}
+
+func TestSharderSingleMember(t *testing.T) {
+	ctx := context.Background()
+	stale := peerLease("gone")
+	stale.Spec.RenewTime = ptr.To(metav1.NewMicroTime(time.Now().Add(-time.Hour)))
+	cli := fake.NewClientBuilder().WithObjects(stale).Build()
+	s := newTestSharder(cli)
+
+	// without live peers, nobody else can hold a cluster, so all clusters
+	// are owned right after the first sync.
+	require.True(t, s.sync(ctx))
+	require.Equal(t, []string{"self"}, s.members)
+	for i := range 100 {
+		require.True(t, s.owns(logicalcluster.Name(fmt.Sprintf("cluster-%d", i))), "a single member must not wait for the handoff delay")
+	}
+
+	// when the only peer leaves again, its clusters are taken over at once.
+	require.NoError(t, cli.Create(ctx, peerLease("peer")))
+	require.True(t, s.sync(ctx))
+	require.NoError(t, cli.Delete(ctx, peerLease("peer")))
+	require.True(t, s.sync(ctx))
+	for i := range 100 {
+		require.True(t, s.owns(logicalcluster.Name(fmt.Sprintf("cluster-%d", i))), "a member left alone must own all clusters")
+	}
+}
+
+func TestSharderListError(t *testing.T) {
+	ctx := context.Background()
+	failList := false
+	cli := fake.NewClientBuilder().WithObjects(peerLease("peer")).WithInterceptorFuncs(interceptor.Funcs{
+		List: func(ctx context.Context, cli client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+			if failList {
+				return apierrors.NewServiceUnavailable("unavailable")
+			}
+			return cli.List(ctx, list, opts...)
+		},
+	}).Build()
+	s := newTestSharder(cli)
+
+	require.True(t, s.sync(ctx))
+	passHandoffDelay(s)
+
+	failList = true
+	require.False(t, s.sync(ctx), "a failed list must not change the membership")
+	require.Equal(t, []string{"peer", "self"}, s.members)
+
+	// without renewing for longer than the renew deadline, all clusters are
+	// given up.
+	s.lock.Lock()
+	s.lastRenew = time.Now().Add(-s.renewDeadline - time.Second)
+	s.lock.Unlock()
+	for i := range 100 {
+		require.False(t, s.owns(logicalcluster.Name(fmt.Sprintf("cluster-%d", i))), "clusters must be given up after the renew deadline")
+	}
+}
+
+func TestNewSharderValidation(t *testing.T) {
+	tests := map[string]struct {
+		opts    ShardingOptions
+		wantErr bool
+	}{
+		"defaults": {},
+		"renew deadline not below lease duration": {
+			opts:    ShardingOptions{LeaseDuration: 10 * time.Second, RenewDeadline: 10 * time.Second},
+			wantErr: true,
+		},
+		"renew interval not below renew deadline": {
+			opts:    ShardingOptions{RenewDeadline: 5 * time.Second, RenewInterval: 5 * time.Second},
+			wantErr: true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tt.opts.Config = &rest.Config{Host: "https://127.0.0.1:6443"}
+			tt.opts.Namespace = "default"
+			tt.opts.Group = "group"
+			_, err := newSharder(&tt.opts, logr.Discard())
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
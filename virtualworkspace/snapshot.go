@@ -0,0 +1,453 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualworkspace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	kcpcache "github.com/kcp-dev/apimachinery/v2/pkg/cache"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/watch"
+	k8scache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+const defaultSnapshotInterval = time.Minute
+
+// SnapshotOptions configure the on-disk snapshots of a wildcard cache.
+type SnapshotOptions struct {
+	// Dir is the directory of the snapshots, with one file per informer. It
+	// is created if it does not exist. Snapshots taken for another server
+	// or with other selectors or namespaces are discarded.
+	Dir string
+	// Interval is the time between two snapshots while the cache runs. A
+	// last snapshot is taken when the cache stops. Defaults to one minute.
+	Interval time.Duration
+}
+
+// snapshots persists the objects of the informers of a wildcard cache with
+// their resource version, and serves them as the initial list of the
+// informers after a restart.
+type snapshots struct {
+	dir      string
+	interval time.Duration
+	// server is the URL of the /clusters/* endpoint of the cache.
+	server string
+
+	lock     sync.Mutex
+	mirrors  map[string]*mirror
+	restored sets.Set[string]
+
+	// saveLock serializes the writing of snapshots.
+	saveLock sync.Mutex
+}
+
+// snapshotHeader identifies what the informer of a snapshot listed. A
+// snapshot is only restored by an informer with the same header, so that
+// snapshots of another server or with other selectors are discarded.
+type snapshotHeader struct {
+	Server        string   `json:"server"`
+	LabelSelector string   `json:"labelSelector,omitempty"`
+	FieldSelector string   `json:"fieldSelector,omitempty"`
+	Namespaces    []string `json:"namespaces,omitempty"`
+}
+
+func (h snapshotHeader) equal(other snapshotHeader) bool {
+	return h.Server == other.Server &&
+		h.LabelSelector == other.LabelSelector &&
+		h.FieldSelector == other.FieldSelector &&
+		slices.Equal(h.Namespaces, other.Namespaces)
+}
+
+// snapshotFile is the content of a snapshot file.
+type snapshotFile struct {
+	snapshotHeader
+	List json.RawMessage `json:"list"`
+}
+
+func newSnapshots(opts SnapshotOptions, server string) (*snapshots, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("snapshot directory must be set")
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = defaultSnapshotInterval
+	}
+	if err := os.MkdirAll(opts.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	return &snapshots{
+		dir:      opts.Dir,
+		interval: opts.Interval,
+		server:   server,
+		mirrors:  map[string]*mirror{},
+		restored: sets.New[string](),
+	}, nil
+}
+
+// header returns the header of the snapshots of the informer for the given
+// type, with the selectors and namespaces the cache lists it with.
+func (s *snapshots) header(gvk schema.GroupVersionKind, opts cache.Options) snapshotHeader {
+	labelSel, fieldSel, namespaces := opts.DefaultLabelSelector, opts.DefaultFieldSelector, opts.DefaultNamespaces
+	for obj, byObject := range opts.ByObject {
+		if objGVK, err := apiutil.GVKForObject(obj, opts.Scheme); err != nil || objGVK != gvk {
+			continue
+		}
+		if byObject.Label != nil {
+			labelSel = byObject.Label
+		}
+		if byObject.Field != nil {
+			fieldSel = byObject.Field
+		}
+		if byObject.Namespaces != nil {
+			namespaces = byObject.Namespaces
+		}
+	}
+
+	h := snapshotHeader{Server: s.server}
+	if labelSel != nil {
+		h.LabelSelector = labelSel.String()
+	}
+	if fieldSel != nil {
+		h.FieldSelector = fieldSel.String()
+	}
+	for ns := range namespaces {
+		h.Namespaces = append(h.Namespaces, ns)
+	}
+	slices.Sort(h.Namespaces)
+	return h
+}
+
+// listerWatcher wraps the ListerWatcher of the informer for objects like obj.
+// The first initial list is served from the snapshot, if there is one with
+// the given header, and the informer then watches from its resource version.
+// If that is too old, the informer relists from the server.
+func (s *snapshots) listerWatcher(lw k8scache.ListerWatcher, obj runtime.Object, gvk schema.GroupVersionKind, scheme *runtime.Scheme, header snapshotHeader) k8scache.ListerWatcher {
+	name := fmt.Sprintf("%s_%s_%s_%s.json", informerFlavour(obj), gvk.Group, gvk.Version, gvk.Kind)
+	m := &mirror{header: header, newList: func() (runtime.Object, error) {
+		listGVK := gvk.GroupVersion().WithKind(gvk.Kind + "List")
+		switch obj.(type) {
+		case runtime.Unstructured:
+			list := &unstructured.UnstructuredList{}
+			list.SetGroupVersionKind(listGVK)
+			return list, nil
+		case *metav1.PartialObjectMetadata:
+			return &metav1.PartialObjectMetadataList{}, nil
+		default:
+			return scheme.New(listGVK)
+		}
+	}}
+
+	// a restarted informer replaces the mirror of the previous one.
+	s.lock.Lock()
+	s.mirrors[name] = m
+	s.lock.Unlock()
+
+	return &snapshotListerWatcher{ListerWatcher: lw, snapshots: s, name: name, mirror: m}
+}
+
+// restore returns the snapshot of the given name as a list and starts the
+// mirror with it. Every snapshot is restored at most once, later informers
+// of the same type list from the server. It returns nil if there is no
+// usable snapshot.
+func (s *snapshots) restore(name string, m *mirror) runtime.Object {
+	s.lock.Lock()
+	if s.restored.Has(name) {
+		s.lock.Unlock()
+		return nil
+	}
+	s.restored.Insert(name)
+	s.lock.Unlock()
+
+	data, err := os.ReadFile(filepath.Join(s.dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		utilruntime.HandleError(fmt.Errorf("failed to read snapshot %s: %w", name, err))
+		return nil
+	}
+	file := &snapshotFile{}
+	if err := json.Unmarshal(data, file); err != nil {
+		utilruntime.HandleError(fmt.Errorf("failed to decode snapshot %s: %w", name, err))
+		return nil
+	}
+	if !file.snapshotHeader.equal(m.header) {
+		// the snapshot was taken for another server or other selectors.
+		return nil
+	}
+	list, err := m.newList()
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("failed to restore snapshot %s: %w", name, err))
+		return nil
+	}
+	if err := json.Unmarshal(file.List, list); err != nil {
+		utilruntime.HandleError(fmt.Errorf("failed to decode snapshot %s: %w", name, err))
+		return nil
+	}
+	if acc, err := apimeta.ListAccessor(list); err != nil || acc.GetResourceVersion() == "" || acc.GetContinue() != "" {
+		utilruntime.HandleError(fmt.Errorf("snapshot %s has no resource version", name))
+		return nil
+	}
+	if err := m.list(list, false); err != nil {
+		utilruntime.HandleError(fmt.Errorf("failed to restore snapshot %s: %w", name, err))
+		return nil
+	}
+	return list
+}
+
+// run saves the snapshots every interval until the context is done.
+func (s *snapshots) run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.save()
+		}
+	}
+}
+
+// save writes the snapshots of all informers with a complete state.
+func (s *snapshots) save() {
+	s.saveLock.Lock()
+	defer s.saveLock.Unlock()
+
+	s.lock.Lock()
+	mirrors := maps.Clone(s.mirrors)
+	s.lock.Unlock()
+
+	for name, m := range mirrors {
+		if err := m.save(filepath.Join(s.dir, name)); err != nil {
+			utilruntime.HandleError(fmt.Errorf("failed to save snapshot %s: %w", name, err))
+		}
+	}
+}
+
+// snapshotListerWatcher is the ListerWatcher of an informer of a wildcard
+// cache with snapshots.
+type snapshotListerWatcher struct {
+	k8scache.ListerWatcher
+
+	snapshots *snapshots
+	name      string
+	mirror    *mirror
+}
+
+// List implements k8scache.Lister.
+func (lw *snapshotListerWatcher) List(options metav1.ListOptions) (runtime.Object, error) {
+	if options.Continue == "" {
+		if list := lw.snapshots.restore(lw.name, lw.mirror); list != nil {
+			return list, nil
+		}
+	}
+
+	list, err := lw.ListerWatcher.List(options)
+	if err != nil {
+		return nil, err
+	}
+	if err := lw.mirror.list(list, options.Continue != ""); err != nil {
+		utilruntime.HandleError(fmt.Errorf("failed to record list for snapshot %s: %w", lw.name, err))
+	}
+	return list, nil
+}
+
+// Watch implements k8scache.Watcher.
+func (lw *snapshotListerWatcher) Watch(options metav1.ListOptions) (watch.Interface, error) {
+	w, err := lw.ListerWatcher.Watch(options)
+	if err != nil {
+		return nil, err
+	}
+	if options.SendInitialEvents != nil && *options.SendInitialEvents {
+		// the watch replaces the list, its initial events are the new state.
+		lw.mirror.startList()
+	}
+	return watch.Filter(w, func(e watch.Event) (watch.Event, bool) {
+		lw.mirror.apply(e)
+		return e, true
+	}), nil
+}
+
+// mirror follows the objects an informer receives from its ListerWatcher.
+// Unlike the store of the informer, its objects always match its resource
+// version, however far the informer has processed them. It keeps copies, as
+// informers may transform their objects in place.
+type mirror struct {
+	header  snapshotHeader
+	newList func() (runtime.Object, error)
+
+	lock sync.Mutex
+	// objects and resourceVersion are the last complete state, by key. They
+	// are nil until the first list completes.
+	objects         map[string]runtime.Object
+	resourceVersion string
+	// pending collects the objects of a paginated list or of the initial
+	// events of a watch until they are complete.
+	pending map[string]runtime.Object
+}
+
+// startList drops the objects of an unfinished list and starts a new one.
+func (m *mirror) startList() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.pending = map[string]runtime.Object{}
+}
+
+// list records a page of a list. The state is replaced once the last page
+// is recorded.
+func (m *mirror) list(list runtime.Object, continued bool) error {
+	acc, err := apimeta.ListAccessor(list)
+	if err != nil {
+		return err
+	}
+	items, err := apimeta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if !continued || m.pending == nil {
+		m.pending = map[string]runtime.Object{}
+	}
+	for _, item := range items {
+		key, err := kcpcache.MetaClusterNamespaceKeyFunc(item)
+		if err != nil {
+			m.pending = nil
+			return err
+		}
+		m.pending[key] = item.DeepCopyObject()
+	}
+	if acc.GetContinue() == "" {
+		m.objects, m.resourceVersion, m.pending = m.pending, acc.GetResourceVersion(), nil
+	}
+	return nil
+}
+
+// apply records a watch event.
+func (m *mirror) apply(e watch.Event) {
+	acc, err := apimeta.Accessor(e.Object)
+	if err != nil {
+		return
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	objects := m.objects
+	if m.pending != nil {
+		objects = m.pending
+	}
+	if objects == nil {
+		return
+	}
+
+	switch e.Type {
+	case watch.Added, watch.Modified, watch.Deleted:
+		key, err := kcpcache.MetaClusterNamespaceKeyFunc(e.Object)
+		if err != nil {
+			return
+		}
+		if e.Type == watch.Deleted {
+			delete(objects, key)
+		} else {
+			objects[key] = e.Object.DeepCopyObject()
+		}
+	case watch.Bookmark:
+		if m.pending != nil && acc.GetAnnotations()[metav1.InitialEventsAnnotationKey] == "true" {
+			m.objects, m.pending = m.pending, nil
+		}
+	case watch.Error:
+		return
+	}
+	if m.pending == nil {
+		m.resourceVersion = acc.GetResourceVersion()
+	}
+}
+
+// save writes the last complete state to the file at path.
+func (m *mirror) save(path string) error {
+	m.lock.Lock()
+	if m.objects == nil {
+		m.lock.Unlock()
+		return nil
+	}
+	items := make([]runtime.Object, 0, len(m.objects))
+	for _, obj := range m.objects {
+		items = append(items, obj)
+	}
+	resourceVersion := m.resourceVersion
+	m.lock.Unlock()
+
+	list, err := m.newList()
+	if err != nil {
+		return err
+	}
+	if err := apimeta.SetList(list, items); err != nil {
+		return err
+	}
+	acc, err := apimeta.ListAccessor(list)
+	if err != nil {
+		return err
+	}
+	acc.SetResourceVersion(resourceVersion)
+	data, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	data, err = json.Marshal(&snapshotFile{snapshotHeader: m.header, List: data})
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first to never leave a partial snapshot.
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
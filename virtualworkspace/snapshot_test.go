@@ -0,0 +1,138 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualworkspace
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kcp-dev/multicluster-provider/virtualworkspace/fakeserver"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestWildcardCacheSnapshot(t *testing.T) {
+	tests := map[string]struct {
+		obj  func() client.Object
+		file string
+	}{
+		"structured": {
+			obj:  func() client.Object { return &corev1.ConfigMap{} },
+			file: "structured__v1_ConfigMap.json",
+		},
+		"unstructured": {
+			obj: func() client.Object {
+				u := &unstructured.Unstructured{}
+				u.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+				return u
+			},
+			file: "unstructured__v1_ConfigMap.json",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := fakeserver.New(nil)
+			defer srv.Close()
+			createConfigMap(t, srv, "foo", "a")
+			createConfigMap(t, srv, "bar", "b")
+
+			// count the lists of configmaps, apart from watches.
+			var lists atomic.Int32
+			cfg := rest.CopyConfig(srv.Config())
+			cfg.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+				return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					if strings.HasSuffix(req.URL.Path, "/configmaps") && req.URL.Query().Get("watch") != "true" {
+						lists.Add(1)
+					}
+					return rt.RoundTrip(req)
+				})
+			})
+			dir := t.TempDir()
+
+			// run starts a wildcard cache with the given options, waits
+			// until it has the given objects and stops it again.
+			run := func(opts cache.Options, want ...string) {
+				t.Helper()
+
+				ctx, cancel := context.WithCancel(context.Background())
+				wc, err := NewWildcardCacheWithOptions(cfg, opts, WildcardCacheOptions{
+					Snapshot: &SnapshotOptions{Dir: dir, Interval: 10 * time.Millisecond},
+				})
+				require.NoError(t, err)
+				done := make(chan struct{})
+				go func() {
+					defer close(done)
+					_ = wc.Start(ctx)
+				}()
+				defer func() {
+					cancel()
+					<-done
+				}()
+
+				_, err = wc.GetInformer(ctx, tt.obj())
+				require.NoError(t, err)
+				inf, _, _, _, err := wc.getSharedInformer(tt.obj())
+				require.NoError(t, err)
+				require.Eventually(t, func() bool {
+					keys := inf.GetIndexer().ListKeys()
+					slices.Sort(keys)
+					return slices.Equal(keys, want)
+				}, wait.ForeverTestTimeout, 10*time.Millisecond, "cache must have %v", want)
+			}
+
+			run(cache.Options{}, "bar|default/b", "foo|default/a")
+			require.Equal(t, int32(1), lists.Load())
+			require.FileExists(t, filepath.Join(dir, tt.file))
+
+			// changes while the cache is stopped are watched from the
+			// resource version of the snapshot, without a list.
+			lists.Store(0)
+			createConfigMap(t, srv, "foo", "c")
+			cli, err := client.New(srv.ClusterConfig("bar"), client.Options{})
+			require.NoError(t, err)
+			require.NoError(t, cli.Delete(context.Background(), &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "b"}}))
+			run(cache.Options{}, "foo|default/a", "foo|default/c")
+			require.Equal(t, int32(0), lists.Load())
+
+			// after compaction, the resource version of the snapshot is
+			// too old and the cache relists.
+			createConfigMap(t, srv, "bar", "d")
+			srv.Compact()
+			run(cache.Options{}, "bar|default/d", "foo|default/a", "foo|default/c")
+			require.Equal(t, int32(1), lists.Load())
+
+			// a snapshot taken with other list options is discarded.
+			lists.Store(0)
+			run(cache.Options{DefaultNamespaces: map[string]cache.Config{"default": {}}}, "bar|default/d", "foo|default/a", "foo|default/c")
+			require.Equal(t, int32(1), lists.Load())
+		})
+	}
+}
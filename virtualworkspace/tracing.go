@@ -0,0 +1,72 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualworkspace
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/kcp-dev/logicalcluster/v3"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"k8s.io/client-go/rest"
+)
+
+const tracerName = "github.com/kcp-dev/multicluster-provider/virtualworkspace"
+
+const (
+	// LogicalClusterAttribute is the span attribute holding the name of the
+	// logical cluster, or "*" for requests of the wildcard cache.
+	LogicalClusterAttribute = attribute.Key("kcp.logicalcluster.name")
+	// WorkspacePathAttribute is the span attribute holding the workspace path
+	// of the logical cluster, if known.
+	WorkspacePathAttribute = attribute.Key("kcp.workspace.path")
+
+	// engagementActionAttribute records whether a logical cluster was engaged,
+	// disengaged or waits for the disengage grace period.
+	engagementActionAttribute = attribute.Key("kcp.engagement.action")
+)
+
+// clusterAttributes returns the span attributes of a logical cluster.
+func clusterAttributes(clusterName logicalcluster.Name, path logicalcluster.Path) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{LogicalClusterAttribute.String(clusterName.String())}
+	if !path.Empty() {
+		attrs = append(attrs, WorkspacePathAttribute.String(path.String()))
+	}
+	return attrs
+}
+
+// withTracing returns a copy of the config whose transport records a client
+// span with the given attributes for every request, and propagates the span
+// context to the server with the given propagator.
+func withTracing(cfg *rest.Config, tp trace.TracerProvider, propagator propagation.TextMapPropagator, attrs ...attribute.KeyValue) *rest.Config {
+	cfg = rest.CopyConfig(cfg)
+	cfg.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return otelhttp.NewTransport(rt,
+			otelhttp.WithTracerProvider(tp),
+			otelhttp.WithPropagators(propagator),
+			otelhttp.WithSpanOptions(trace.WithAttributes(attrs...)),
+			otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+				return fmt.Sprintf("kcp virtualworkspace %s", r.Method)
+			}),
+		)
+	})
+	return cfg
+}
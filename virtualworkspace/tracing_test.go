@@ -0,0 +1,130 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualworkspace
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/kcp-dev/multicluster-provider/virtualworkspace/fakeserver"
+
+	kcpcore "github.com/kcp-dev/kcp/sdk/apis/core"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// hasSpan returns whether a span with the given name, kind and attributes has
+// been recorded.
+func hasSpan(sr *tracetest.SpanRecorder, name string, kind trace.SpanKind, attrs ...attribute.KeyValue) bool {
+	for _, span := range sr.Ended() {
+		if (name != "" && span.Name() != name) || span.SpanKind() != kind {
+			continue
+		}
+		if !containsAll(span.Attributes(), attrs) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func containsAll(have, want []attribute.KeyValue) bool {
+	for _, attr := range want {
+		if !slices.Contains(have, attr) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestProviderTracing(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := fakeserver.New(nil)
+	defer srv.Close()
+	cli, err := client.New(srv.ClusterConfig("foo"), client.Options{})
+	require.NoError(t, err)
+	require.NoError(t, cli.Create(ctx, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   "default",
+		Name:        "a",
+		Annotations: map[string]string{kcpcore.LogicalClusterPathAnnotationKey: "root:org:foo"},
+	}}))
+
+	// record the trace context the server receives for configmap gets.
+	var (
+		lock        sync.Mutex
+		traceparent string
+	)
+	cfg := rest.CopyConfig(srv.Config())
+	cfg.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Method == http.MethodGet && strings.HasSuffix(req.URL.Path, "/configmaps/a") {
+				lock.Lock()
+				traceparent = req.Header.Get("traceparent")
+				lock.Unlock()
+			}
+			return rt.RoundTrip(req)
+		})
+	})
+
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	p, err := New(cfg, &corev1.ConfigMap{}, Options{TracerProvider: tp})
+	require.NoError(t, err)
+	defer p.Stop()
+
+	mgr := newEngagementRecorder()
+	go func() {
+		_ = p.Run(ctx, mgr)
+	}()
+	require.Eventually(t, func() bool {
+		return slices.Equal(mgr.active(), []string{"foo"})
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "existing cluster must be engaged")
+
+	fooAttrs := []attribute.KeyValue{
+		LogicalClusterAttribute.String("foo"),
+		WorkspacePathAttribute.String("root:org:foo"),
+	}
+	require.True(t, hasSpan(sr, "ReconcileCluster", trace.SpanKindInternal, append(fooAttrs, engagementActionAttribute.String("engage"))...),
+		"engagement must be traced")
+	require.True(t, hasSpan(sr, "", trace.SpanKindClient, LogicalClusterAttribute.String("*")),
+		"wildcard cache requests must be traced")
+
+	cl, err := p.Get(ctx, "foo")
+	require.NoError(t, err)
+	require.NoError(t, cl.GetClient().Get(ctx, client.ObjectKey{Namespace: "default", Name: "a"}, &corev1.ConfigMap{}))
+	require.True(t, hasSpan(sr, "", trace.SpanKindClient, fooAttrs...), "scoped client requests must be traced")
+	lock.Lock()
+	defer lock.Unlock()
+	require.NotEmpty(t, traceparent, "span context must be propagated to the server")
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualworkspace
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/kcp-dev/logicalcluster/v3"
+
+	mccontext "github.com/multicluster-runtime/multicluster-runtime/pkg/context"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// ClusterGetter returns engaged clusters by name. It is implemented by the
+// Provider.
+type ClusterGetter interface {
+	Get(ctx context.Context, clusterName string) (cluster.Cluster, error)
+}
+
+// AdmissionHandler handles admission requests for objects of a logical
+// cluster. The cluster can be used to read the state of the tenant, e.g.
+// through its cache.
+type AdmissionHandler interface {
+	Handle(ctx context.Context, clusterName logicalcluster.Name, cl cluster.Cluster, req admission.Request) admission.Response
+}
+
+// AdmissionHandlerFunc implements AdmissionHandler with a function.
+type AdmissionHandlerFunc func(ctx context.Context, clusterName logicalcluster.Name, cl cluster.Cluster, req admission.Request) admission.Response
+
+// Handle implements AdmissionHandler.
+func (f AdmissionHandlerFunc) Handle(ctx context.Context, clusterName logicalcluster.Name, cl cluster.Cluster, req admission.Request) admission.Response {
+	return f(ctx, clusterName, cl, req)
+}
+
+// NewAdmissionWebhook returns a validating or mutating webhook for objects
+// served by an APIExport virtual workspace. Every admission request is routed
+// to the handler together with the logical cluster of the object under
+// admission, as found in its kcp.io/cluster annotation, and the engaged
+// cluster the getter returns for it. The context passed to the handler
+// carries the cluster name like the one of a multicluster reconciler.
+//
+// Requests for objects without logical cluster are rejected. Requests for
+// clusters that are not engaged (yet) fail with HTTP status 503 instead of
+// an admission response, so that the failure policy of the webhook
+// configuration applies. Calling Handle directly returns an errored response
+// with code 503 for them.
+//
+// The webhook is registered with the webhook server of the manager as usual:
+//
+//	mgr.GetWebhookServer().Register("/validate-application", virtualworkspace.NewAdmissionWebhook(provider, handler))
+func NewAdmissionWebhook(clusters ClusterGetter, handler AdmissionHandler) *AdmissionWebhook {
+	return &AdmissionWebhook{
+		Webhook: &admission.Webhook{
+			Handler: &clusterAdmissionHandler{
+				clusters: clusters,
+				handler:  handler,
+			},
+		},
+	}
+}
+
+// AdmissionWebhook is an admission.Webhook that fails the HTTP request for
+// logical clusters that are not engaged. See NewAdmissionWebhook.
+type AdmissionWebhook struct {
+	*admission.Webhook
+}
+
+// unavailableKey is the context key of the *error an AdmissionWebhook
+// passes to its handler, to learn about clusters that are not engaged.
+type unavailableKey struct{}
+
+// ServeHTTP implements http.Handler.
+func (wh *AdmissionWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var unavailable error
+	r = r.WithContext(context.WithValue(r.Context(), unavailableKey{}, &unavailable))
+	wh.Webhook.ServeHTTP(&unavailableResponseWriter{ResponseWriter: w, unavailable: &unavailable}, r)
+}
+
+// unavailableResponseWriter replaces the admission response with HTTP status
+// 503 if the handler found the cluster unavailable. The handler has always
+// returned when the response is written.
+type unavailableResponseWriter struct {
+	http.ResponseWriter
+
+	unavailable *error
+	written     bool
+}
+
+func (w *unavailableResponseWriter) WriteHeader(code int) {
+	if *w.unavailable != nil {
+		w.writeUnavailable()
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *unavailableResponseWriter) Write(data []byte) (int, error) {
+	if *w.unavailable != nil {
+		w.writeUnavailable()
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *unavailableResponseWriter) writeUnavailable() {
+	if w.written {
+		return
+	}
+	w.written = true
+	http.Error(w.ResponseWriter, (*w.unavailable).Error(), http.StatusServiceUnavailable)
+}
+
+type clusterAdmissionHandler struct {
+	clusters ClusterGetter
+	handler  AdmissionHandler
+}
+
+// Handle implements admission.Handler.
+func (h *clusterAdmissionHandler) Handle(ctx context.Context, req admission.Request) admission.Response {
+	clusterName, err := admissionClusterName(req)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	cl, err := h.clusters.Get(ctx, clusterName.String())
+	if err != nil {
+		err = fmt.Errorf("logical cluster %q is not engaged: %w", clusterName, err)
+		if unavailable, ok := ctx.Value(unavailableKey{}).(*error); ok {
+			*unavailable = err
+		}
+		return admission.Errored(http.StatusServiceUnavailable, err)
+	}
+
+	ctx = mccontext.WithCluster(ctx, clusterName.String())
+	ctx = log.IntoContext(ctx, clusterLogger(log.FromContext(ctx), clusterName, logicalcluster.Path{}))
+
+	return h.handler.Handle(ctx, clusterName, cl, req)
+}
+
+// admissionClusterName returns the logical cluster of the object under
+// admission. For deletions, only the old object is set.
+func admissionClusterName(req admission.Request) (logicalcluster.Name, error) {
+	raw := req.Object
+	if req.Operation == admissionv1.Delete || (len(raw.Raw) == 0 && raw.Object == nil) {
+		raw = req.OldObject
+	}
+
+	clusterName, err := rawClusterName(raw)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode object: %w", err)
+	}
+	if clusterName.Empty() {
+		return "", fmt.Errorf("object has no %s annotation", logicalcluster.AnnotationKey)
+	}
+	return clusterName, nil
+}
+
+func rawClusterName(raw runtime.RawExtension) (logicalcluster.Name, error) {
+	if raw.Object != nil {
+		obj, ok := raw.Object.(metav1.Object)
+		if !ok {
+			return "", fmt.Errorf("object of type %T has no metadata", raw.Object)
+		}
+		return logicalcluster.From(obj), nil
+	}
+	if len(raw.Raw) == 0 {
+		return "", fmt.Errorf("request has no object")
+	}
+
+	obj := &metav1.PartialObjectMetadata{}
+	if err := json.Unmarshal(raw.Raw, obj); err != nil {
+		return "", err
+	}
+	return logicalcluster.From(obj), nil
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2025 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualworkspace
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kcp-dev/logicalcluster/v3"
+	"github.com/stretchr/testify/require"
+
+	mccontext "github.com/multicluster-runtime/multicluster-runtime/pkg/context"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+type namedCluster struct {
+	cluster.Cluster
+	name string
+}
+
+type clusterMap map[string]cluster.Cluster
+
+func (m clusterMap) Get(_ context.Context, name string) (cluster.Cluster, error) {
+	if cl, ok := m[name]; ok {
+		return cl, nil
+	}
+	return nil, fmt.Errorf("cluster %q not found", name)
+}
+
+func TestAdmissionWebhook(t *testing.T) {
+	clusters := clusterMap{
+		"foo": &namedCluster{name: "foo"},
+		"bar": &namedCluster{name: "bar"},
+	}
+
+	rawConfigMap := func(clusterName string) runtime.RawExtension {
+		cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "a"}}
+		if clusterName != "" {
+			cm.Annotations = map[string]string{logicalcluster.AnnotationKey: clusterName}
+		}
+		raw, err := json.Marshal(cm)
+		require.NoError(t, err)
+		return runtime.RawExtension{Raw: raw}
+	}
+
+	tests := []struct {
+		name      string
+		operation admissionv1.Operation
+		object    runtime.RawExtension
+		oldObject runtime.RawExtension
+
+		wantCluster string
+		wantCode    int32
+	}{
+		{
+			name:        "create",
+			operation:   admissionv1.Create,
+			object:      rawConfigMap("foo"),
+			wantCluster: "foo",
+		},
+		{
+			name:        "update",
+			operation:   admissionv1.Update,
+			object:      rawConfigMap("bar"),
+			oldObject:   rawConfigMap("bar"),
+			wantCluster: "bar",
+		},
+		{
+			name:        "delete",
+			operation:   admissionv1.Delete,
+			oldObject:   rawConfigMap("foo"),
+			wantCluster: "foo",
+		},
+		{
+			name:      "object without cluster",
+			operation: admissionv1.Create,
+			object:    rawConfigMap(""),
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "request without object",
+			operation: admissionv1.Create,
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "malformed object",
+			operation: admissionv1.Create,
+			object:    runtime.RawExtension{Raw: []byte("{")},
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "cluster not engaged",
+			operation: admissionv1.Create,
+			object:    rawConfigMap("baz"),
+			wantCode:  http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var called bool
+			wh := NewAdmissionWebhook(clusters, AdmissionHandlerFunc(func(ctx context.Context, clusterName logicalcluster.Name, cl cluster.Cluster, req admission.Request) admission.Response {
+				called = true
+				require.Equal(t, tt.wantCluster, clusterName.String())
+				require.Equal(t, tt.wantCluster, cl.(*namedCluster).name)
+				fromCtx, ok := mccontext.ClusterFrom(ctx)
+				require.True(t, ok, "cluster must be in the context")
+				require.Equal(t, tt.wantCluster, fromCtx)
+				return admission.Allowed("")
+			}))
+
+			resp := wh.Handle(context.Background(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+				UID:       "uid",
+				Operation: tt.operation,
+				Object:    tt.object,
+				OldObject: tt.oldObject,
+			}})
+
+			if tt.wantCode != 0 {
+				require.False(t, called, "handler must not be called")
+				require.False(t, resp.Allowed)
+				require.Equal(t, tt.wantCode, resp.Result.Code)
+				return
+			}
+			require.True(t, called, "handler must be called")
+			require.True(t, resp.Allowed)
+		})
+	}
+}
+
+func TestAdmissionWebhookServeHTTP(t *testing.T) {
+	wh := NewAdmissionWebhook(clusterMap{"foo": &namedCluster{name: "foo"}}, AdmissionHandlerFunc(func(context.Context, logicalcluster.Name, cluster.Cluster, admission.Request) admission.Response {
+		return admission.Allowed("")
+	}))
+
+	tests := map[string]struct {
+		annotations map[string]string
+
+		wantStatus  int
+		wantAllowed bool
+	}{
+		"engaged cluster": {
+			annotations: map[string]string{logicalcluster.AnnotationKey: "foo"},
+			wantStatus:  http.StatusOK,
+			wantAllowed: true,
+		},
+		"object without cluster": {
+			wantStatus: http.StatusOK,
+		},
+		"cluster not engaged": {
+			annotations: map[string]string{logicalcluster.AnnotationKey: "baz"},
+			wantStatus:  http.StatusServiceUnavailable,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			raw, err := json.Marshal(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "a", Annotations: tt.annotations}})
+			require.NoError(t, err)
+			body, err := json.Marshal(&admissionv1.AdmissionReview{
+				TypeMeta: metav1.TypeMeta{APIVersion: admissionv1.SchemeGroupVersion.String(), Kind: "AdmissionReview"},
+				Request: &admissionv1.AdmissionRequest{
+					UID:       "uid",
+					Operation: admissionv1.Create,
+					Object:    runtime.RawExtension{Raw: raw},
+				},
+			})
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodPost, "/validate", strings.NewReader(string(body)))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			wh.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.wantStatus, rec.Code, rec.Body.String())
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			review := &admissionv1.AdmissionReview{}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), review))
+			require.Equal(t, tt.wantAllowed, review.Response.Allowed)
+		})
+	}
+}
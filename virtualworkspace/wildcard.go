@@ -27,8 +27,10 @@ import (
 	kcpinformers "github.com/kcp-dev/apimachinery/v2/third_party/informers"
 	"github.com/kcp-dev/logicalcluster/v3"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
@@ -43,13 +45,70 @@ import (
 // WildcardCache is a cache that operates on a /clusters/* endpoint.
 type WildcardCache interface {
 	cache.Cache
+
+	// getSharedInformer returns the informer for the type of the given object
+	// or list, its GroupVersionKind and REST scope, and whether the informer
+	// exists. It does not create informers. The informer is indexed by
+	// kcpcache.ClusterIndexName and kcpcache.ClusterAndNamespaceIndexName.
 	getSharedInformer(obj runtime.Object) (k8scache.SharedIndexInformer, schema.GroupVersionKind, apimeta.RESTScopeName, bool, error)
 }
 
+// SharedInformerFunc returns the informer of a wildcard cache for the type of
+// the given object or list, like the informers of WildcardCache. See
+// WildcardCacheFor.
+type SharedInformerFunc func(obj runtime.Object) (k8scache.SharedIndexInformer, schema.GroupVersionKind, apimeta.RESTScopeName, bool, error)
+
+// WildcardCacheFor returns a WildcardCache for a cache implemented outside of
+// this package, e.g. an in-memory fake. getSharedInformer returns the informer
+// for the type of the given object or list, its GroupVersionKind and REST
+// scope, and whether the informer exists. It must not create informers, and
+// the informers must be indexed by kcpcache.ClusterIndexName and
+// kcpcache.ClusterAndNamespaceIndexName.
+func WildcardCacheFor(c cache.Cache, getSharedInformer SharedInformerFunc) WildcardCache {
+	return &customWildcardCache{Cache: c, sharedInformer: getSharedInformer}
+}
+
+type customWildcardCache struct {
+	cache.Cache
+	sharedInformer SharedInformerFunc
+}
+
+func (c *customWildcardCache) getSharedInformer(obj runtime.Object) (k8scache.SharedIndexInformer, schema.GroupVersionKind, apimeta.RESTScopeName, bool, error) {
+	return c.sharedInformer(obj)
+}
+
+// WildcardCacheOptions are the options of NewWildcardCacheWithOptions that go
+// beyond the controller-runtime cache options.
+type WildcardCacheOptions struct {
+	// DeferredClaims are resources claimed by the APIExport whose informers
+	// are only started once the APIBinding of any engaged logical cluster
+	// accepts the claim, and are stopped again when none does. Logical
+	// clusters count while a Provider using the cache engages them, so the
+	// informers never start for a cache used without one. Until then, the
+	// cache reads no objects of them, and informers handed out keep their
+	// event handlers and indexers across restarts. APIBinding must be
+	// registered in the scheme.
+	DeferredClaims []schema.GroupResource
+
+	// Snapshot persists the objects of all informers with their resource
+	// version on disk. After a restart, informers start from the snapshot and
+	// watch from its resource version instead of listing the objects of all
+	// logical clusters, and relist if the resource version is too old. The
+	// snapshots hold all objects of the cache, including Secrets, and the
+	// cache keeps a copy of its objects to take them.
+	Snapshot *SnapshotOptions
+}
+
 // NewWildcardCache returns a cache.Cache that handles multi-cluster watches
 // against a /clusters/* endpoint. It wires SharedIndexInformers with additional
 // indexes for cluster and cluster+namespace.
 func NewWildcardCache(config *rest.Config, opts cache.Options) (WildcardCache, error) {
+	return NewWildcardCacheWithOptions(config, opts, WildcardCacheOptions{})
+}
+
+// NewWildcardCacheWithOptions returns a wildcard cache like NewWildcardCache,
+// with the given additional options.
+func NewWildcardCacheWithOptions(config *rest.Config, opts cache.Options, wildcardOpts WildcardCacheOptions) (WildcardCache, error) {
 	config = rest.CopyConfig(config)
 	config.Host = strings.TrimSuffix(config.Host, "/") + "/clusters/*"
 
@@ -82,11 +141,22 @@ func NewWildcardCache(config *rest.Config, opts cache.Options) (WildcardCache, e
 		},
 	}
 
+	if wildcardOpts.Snapshot != nil {
+		var err error
+		ret.snapshots, err = newSnapshots(*wildcardOpts.Snapshot, config.Host)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	opts.NewInformer = func(watcher k8scache.ListerWatcher, obj runtime.Object, duration time.Duration, indexers k8scache.Indexers) k8scache.SharedIndexInformer {
 		gvk, err := apiutil.GVKForObject(obj, opts.Scheme)
 		if err != nil {
 			panic(err)
 		}
+		if ret.snapshots != nil {
+			watcher = ret.snapshots.listerWatcher(watcher, obj, gvk, opts.Scheme, ret.snapshots.header(gvk, opts))
+		}
 
 		inf := kcpinformers.NewSharedIndexInformer(watcher, obj, duration, indexers)
 		if err := inf.AddIndexers(k8scache.Indexers{
@@ -113,6 +183,13 @@ func NewWildcardCache(config *rest.Config, opts cache.Options) (WildcardCache, e
 		return nil, err
 	}
 
+	if len(wildcardOpts.DeferredClaims) > 0 {
+		ret.deferred = newDeferredClaims(ret, wildcardOpts.DeferredClaims)
+		if err := ret.deferred.watchBindings(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+
 	return ret, nil
 }
 
@@ -123,13 +200,63 @@ type wildcardCache struct {
 	scheme  *runtime.Scheme
 	mapper  apimeta.RESTMapper
 	tracker informerTracker
+
+	// deferred starts and stops the informers of claimed resources, if set.
+	deferred *deferredClaims
+	// snapshots persists the informers on disk, if set.
+	snapshots *snapshots
+}
+
+// engagementTracker is implemented by wildcard caches that depend on the
+// logical clusters engaged by the provider.
+type engagementTracker interface {
+	// trackEngagement records the engagement of the logical cluster, which
+	// ends when the context is done.
+	trackEngagement(ctx context.Context, clusterName logicalcluster.Name)
+}
+
+var _ engagementTracker = &wildcardCache{}
+
+// trackEngagement counts the APIBindings of the logical cluster for the
+// deferred claims while it is engaged.
+func (c *wildcardCache) trackEngagement(ctx context.Context, clusterName logicalcluster.Name) {
+	if c.deferred == nil {
+		return
+	}
+	disengage := c.deferred.engage(clusterName)
+	context.AfterFunc(ctx, disengage)
+}
+
+// Start runs the cache until the context is done. With snapshots, they are
+// saved periodically and once more when the cache stops.
+func (c *wildcardCache) Start(ctx context.Context) error {
+	if c.snapshots == nil {
+		return c.Cache.Start(ctx)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.snapshots.run(ctx)
+	}()
+	err := c.Cache.Start(ctx)
+	cancel()
+	<-done
+
+	c.snapshots.save()
+	return err
 }
 
+// getSharedInformer implements WildcardCache.
 func (c *wildcardCache) getSharedInformer(obj runtime.Object) (k8scache.SharedIndexInformer, schema.GroupVersionKind, apimeta.RESTScopeName, bool, error) {
 	gvk, err := apiutil.GVKForObject(obj, c.scheme)
 	if err != nil {
 		return nil, gvk, "", false, err
 	}
+	if apimeta.IsListType(obj) {
+		gvk.Kind = strings.TrimSuffix(gvk.Kind, "List")
+	}
 
 	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
 	if err != nil {
@@ -141,20 +268,136 @@ func (c *wildcardCache) getSharedInformer(obj runtime.Object) (k8scache.SharedIn
 	inf, ok := infs[gvk]
 	c.tracker.lock.RUnlock()
 
+	if !ok && c.deferred != nil {
+		inf, ok = c.deferred.placeholder(informerKey{gvk: gvk, flavour: informerFlavour(obj), resource: mapping.Resource.GroupResource()})
+	}
+
 	return inf, gvk, mapping.Scope.Name(), ok, nil
 }
 
-// IndexField adds an index for the given object kind.
-func (c *wildcardCache) IndexField(ctx context.Context, obj client.Object, field string, extractValue client.IndexerFunc) error {
-	return c.Cache.IndexField(ctx, obj, "cluster/"+field, func(obj client.Object) []string {
-		keys := extractValue(obj)
-		withCluster := make([]string, len(keys)*2)
-		for i, key := range keys {
-			withCluster[i] = fmt.Sprintf("%s/%s", logicalcluster.From(obj), key)
-			withCluster[i+len(keys)] = fmt.Sprintf("*/%s", key)
+// deferredInformerKey returns the key of the informer for the type of the
+// given object or list, and whether it is a deferred claimed resource.
+func (c *wildcardCache) deferredInformerKey(obj runtime.Object) (informerKey, bool, error) {
+	if c.deferred == nil {
+		return informerKey{}, false, nil
+	}
+	gvk, err := apiutil.GVKForObject(obj, c.scheme)
+	if err != nil {
+		return informerKey{}, false, err
+	}
+	if apimeta.IsListType(obj) {
+		gvk.Kind = strings.TrimSuffix(gvk.Kind, "List")
+	}
+	var resource schema.GroupResource
+	if mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version); err == nil {
+		resource = mapping.Resource.GroupResource()
+	} else {
+		// the resource might not be discoverable before the claim is accepted.
+		plural, _ := apimeta.UnsafeGuessKindToResource(gvk)
+		resource = plural.GroupResource()
+	}
+	key := informerKey{gvk: gvk, flavour: informerFlavour(obj), resource: resource}
+	return key, c.deferred.isDeferred(key.resource), nil
+}
+
+// deferredInformer returns the deferred informer for the type of the given
+// object or list.
+func (c *wildcardCache) deferredInformer(key informerKey, obj runtime.Object) (*deferredInformer, error) {
+	var proto client.Object
+	switch obj.(type) {
+	case runtime.Unstructured:
+		u := &unstructured.Unstructured{}
+		u.SetGroupVersionKind(key.gvk)
+		proto = u
+	case *metav1.PartialObjectMetadata, *metav1.PartialObjectMetadataList:
+		proto = &metav1.PartialObjectMetadata{TypeMeta: metav1.TypeMeta{APIVersion: key.gvk.GroupVersion().String(), Kind: key.gvk.Kind}}
+	default:
+		robj, err := c.scheme.New(key.gvk)
+		if err != nil {
+			return nil, err
+		}
+		cobj, ok := robj.(client.Object)
+		if !ok {
+			return nil, fmt.Errorf("%T is not a client.Object", robj)
+		}
+		proto = cobj
+	}
+	return c.deferred.informer(key, proto), nil
+}
+
+// GetInformer returns the informer for the type of the given object. For
+// deferred claimed resources, it returns an informer that only runs while the
+// claim is accepted.
+func (c *wildcardCache) GetInformer(ctx context.Context, obj client.Object, opts ...cache.InformerGetOption) (cache.Informer, error) {
+	key, deferred, err := c.deferredInformerKey(obj)
+	if err != nil || !deferred {
+		return c.Cache.GetInformer(ctx, obj, opts...)
+	}
+	return c.deferredInformer(key, obj)
+}
+
+// GetInformerForKind returns the informer for the given GroupVersionKind. For
+// deferred claimed resources, it returns an informer that only runs while the
+// claim is accepted.
+func (c *wildcardCache) GetInformerForKind(ctx context.Context, gvk schema.GroupVersionKind, opts ...cache.InformerGetOption) (cache.Informer, error) {
+	if c.deferred != nil {
+		if obj, err := c.scheme.New(gvk); err == nil {
+			if cobj, ok := obj.(client.Object); ok {
+				return c.GetInformer(ctx, cobj, opts...)
+			}
 		}
-		return withCluster
-	})
+	}
+	return c.Cache.GetInformerForKind(ctx, gvk, opts...)
+}
+
+// Get reads an object from the cache. Deferred claimed resources are not
+// found while no APIBinding accepts the claim.
+func (c *wildcardCache) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	infKey, deferred, err := c.deferredInformerKey(obj)
+	if err != nil || !deferred {
+		return c.Cache.Get(ctx, key, obj, opts...)
+	}
+	if _, err := c.deferredInformer(infKey, obj); err != nil {
+		return err
+	}
+
+	c.deferred.lock.RLock()
+	defer c.deferred.lock.RUnlock()
+	if !c.deferred.accepted.Has(infKey.resource) {
+		return apierrors.NewNotFound(infKey.resource, key.Name)
+	}
+	return c.Cache.Get(ctx, key, obj, opts...)
+}
+
+// List reads objects from the cache. Deferred claimed resources have no
+// objects while no APIBinding accepts the claim.
+func (c *wildcardCache) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	infKey, deferred, err := c.deferredInformerKey(list)
+	if err != nil || !deferred {
+		return c.Cache.List(ctx, list, opts...)
+	}
+	if _, err := c.deferredInformer(infKey, list); err != nil {
+		return err
+	}
+
+	c.deferred.lock.RLock()
+	defer c.deferred.lock.RUnlock()
+	if !c.deferred.accepted.Has(infKey.resource) {
+		return apimeta.SetList(list, nil)
+	}
+	return c.Cache.List(ctx, list, opts...)
+}
+
+// IndexField adds an index for the given object kind. Besides the values of
+// the controller-runtime cache, the index holds the values prefixed with the
+// logical cluster of the object, so that scoped caches only see their own
+// cluster. See ClusterFieldIndexFunc.
+func (c *wildcardCache) IndexField(ctx context.Context, obj client.Object, field string, extractValue client.IndexerFunc) error {
+	inf, err := c.GetInformer(ctx, obj, cache.BlockUntilSynced(false))
+	if err != nil {
+		return err
+	}
+	return inf.AddIndexers(k8scache.Indexers{fieldIndexName(field): ClusterFieldIndexFunc(extractValue)})
 }
 
 type informerTracker struct {
@@ -164,6 +407,14 @@ type informerTracker struct {
 	Metadata     map[schema.GroupVersionKind]k8scache.SharedIndexInformer
 }
 
+// remove forgets the informer of a stopped deferred claimed resource.
+func (t *informerTracker) remove(obj runtime.Object, gvk schema.GroupVersionKind) {
+	infs := t.informersByType(obj)
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(infs, gvk)
+}
+
 func (t *informerTracker) informersByType(obj runtime.Object) map[schema.GroupVersionKind]k8scache.SharedIndexInformer {
 	switch obj.(type) {
 	case runtime.Unstructured:
@@ -174,3 +425,16 @@ func (t *informerTracker) informersByType(obj runtime.Object) map[schema.GroupVe
 		return t.Structured
 	}
 }
+
+// informerFlavour returns which kind of informer serves the given object,
+// matching informerTracker.informersByType.
+func informerFlavour(obj runtime.Object) string {
+	switch obj.(type) {
+	case runtime.Unstructured:
+		return "unstructured"
+	case *metav1.PartialObjectMetadata, *metav1.PartialObjectMetadataList:
+		return "metadata"
+	default:
+		return "structured"
+	}
+}